@@ -0,0 +1,230 @@
+package meow
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Types of alert channels.
+const (
+	// AlertWebhook posts the alert as JSON to the target URL.
+	AlertWebhook = "webhook"
+
+	// AlertSlack posts the alert's message to the target URL of a Slack
+	// incoming webhook.
+	AlertSlack = "slack"
+
+	// AlertPagerDuty triggers an incident in PagerDuty when the endpoint goes
+	// offline and resolves it once it comes back online. The target is the
+	// routing key of the service's Events API v2 integration.
+	AlertPagerDuty = "pagerduty"
+
+	// AlertEmail sends the alert by email to the target, a comma-separated list
+	// of recipients, through the SMTP server of the Alerter.
+	AlertEmail = "email"
+)
+
+// DefaultAlertTemplate renders the message of alerts about endpoints without an
+// alert template.
+const DefaultAlertTemplate = `{{.Endpoint.Identifier}} is {{if eq .State "down"}}offline ({{.FailedAttempts}} failed attempts){{else}}online again{{end}}`
+
+// PagerDutyEventsURL is where events of PagerDuty alert channels are sent to.
+var PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// AlertChannel is where alerts about an endpoint are sent to.
+type AlertChannel struct {
+	Type   string `json:"type"`
+	Target string `json:"target"`
+}
+
+// Alert informs about an endpoint going offline or coming back online. The
+// status and error of the last failed check are only set for the former. A test
+// alert only checks the alert channels and says nothing about the endpoint.
+type Alert struct {
+	Identifier string    `json:"identifier"`
+	State      string    `json:"state"`
+	At         time.Time `json:"at"`
+	Message    string    `json:"message"`
+	Status     int       `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Test       bool      `json:"test,omitempty"`
+
+	// WebhookSecret is the secret alerts sent to webhook channels are signed
+	// with, if any. It is never sent itself.
+	WebhookSecret string `json:"-"`
+}
+
+// Headers of signed webhook alerts.
+const (
+	WebhookTimestampHeader = "X-Meow-Timestamp"
+	WebhookNonceHeader     = "X-Meow-Nonce"
+	WebhookSignatureHeader = "X-Meow-Signature"
+)
+
+// SignWebhook returns the signature of a webhook alert's body sent at the given
+// Unix timestamp with the given nonce: the hex-encoded HMAC-SHA256 of the
+// timestamp, a dot, the nonce, a dot, and the body, keyed with the secret,
+// prefixed with "sha256=". Receivers compute it likewise to verify alerts.
+func SignWebhook(secret, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + nonce + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// AlertData is what alert templates are rendered with. The status and error of
+// the last failed check are only set for alerts about the endpoint going
+// offline.
+type AlertData struct {
+	Endpoint       Endpoint
+	State          string
+	At             time.Time
+	FailedAttempts int
+	Status         int
+	Error          string
+}
+
+// RenderAlertMessage renders the alert template tmpl, or DefaultAlertTemplate if
+// it is empty, with data.
+func RenderAlertMessage(tmpl string, data AlertData) (string, error) {
+	if tmpl == "" {
+		tmpl = DefaultAlertTemplate
+	}
+	t, err := template.New("alert").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("parse alert template: %v", err)
+	}
+	var buf strings.Builder
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render alert template: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// validateAlertTemplate renders the alert template with sample data to detect
+// references to fields that do not exist.
+func validateAlertTemplate(tmpl string, e Endpoint) error {
+	data := AlertData{
+		Endpoint:       e,
+		State:          StateDown,
+		At:             time.Now(),
+		FailedAttempts: int(e.FailAfter),
+		Status:         http.StatusServiceUnavailable,
+		Error:          "sample error",
+	}
+	_, err := RenderAlertMessage(tmpl, data)
+	return err
+}
+
+func validateAlertChannel(channel AlertChannel) error {
+	switch channel.Type {
+	case AlertWebhook, AlertSlack:
+		target, err := url.Parse(channel.Target)
+		if err != nil {
+			return fmt.Errorf(`parse target "%s" of %s alert channel: %v`, channel.Target, channel.Type, err)
+		}
+		if target.Scheme != "http" && target.Scheme != "https" || target.Host == "" {
+			return fmt.Errorf(`target "%s" of %s alert channel is not an HTTP URL`, channel.Target, channel.Type)
+		}
+		return nil
+	case AlertPagerDuty:
+		if channel.Target == "" {
+			return fmt.Errorf("%s alert channel needs a routing key as target", channel.Type)
+		}
+		return nil
+	case AlertEmail:
+		if _, err := mail.ParseAddressList(channel.Target); err != nil {
+			return fmt.Errorf(`parse recipients "%s" of %s alert channel: %v`, channel.Target, channel.Type, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf(`"%s" is not a supported alert channel type`, channel.Type)
+	}
+}
+
+// Alerter sends alerts to alert channels.
+type Alerter struct {
+	// Client sends the alerts of channels posting them via HTTP.
+	Client *http.Client
+
+	// SMTP is the server to send alerts by email through, if any.
+	SMTP *SMTPServer
+}
+
+// Notifier returns the notifier sending alerts to the channel.
+func (a *Alerter) Notifier(channel AlertChannel) Notifier {
+	switch channel.Type {
+	case AlertWebhook:
+		return &WebhookNotifier{Client: a.Client, URL: channel.Target}
+	case AlertSlack:
+		return &SlackNotifier{Client: a.Client, URL: channel.Target}
+	case AlertPagerDuty:
+		return &PagerDutyNotifier{Client: a.Client, RoutingKey: channel.Target}
+	case AlertEmail:
+		return &EmailNotifier{SMTP: a.SMTP, Recipients: channel.Target}
+	default:
+		return unsupportedNotifier(channel.Type)
+	}
+}
+
+// Notifiers returns the notifier sending alerts to all the channels, with the
+// notifier of each channel at its index.
+func (a *Alerter) Notifiers(channels []AlertChannel) MultiNotifier {
+	notifiers := make(MultiNotifier, 0, len(channels))
+	for _, channel := range channels {
+		notifiers = append(notifiers, a.Notifier(channel))
+	}
+	return notifiers
+}
+
+// pagerDutyEvent is an event of the PagerDuty Events API v2.
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+// pagerDutyPayload describes the incident triggered by a PagerDuty event.
+type pagerDutyPayload struct {
+	Summary   string `json:"summary"`
+	Source    string `json:"source"`
+	Severity  string `json:"severity"`
+	Timestamp string `json:"timestamp"`
+}
+
+// newPagerDutyEvent returns the event triggering an incident for an alert about
+// an endpoint going offline, and resolving it otherwise. Both refer to the same
+// incident by a deduplication key derived from the endpoint's identifier. Test
+// alerts trigger an incident of their own.
+func newPagerDutyEvent(routingKey string, alert Alert) pagerDutyEvent {
+	event := pagerDutyEvent{
+		RoutingKey:  routingKey,
+		EventAction: "resolve",
+		DedupKey:    "meow-" + alert.Identifier,
+	}
+	if alert.Test {
+		event.DedupKey = "meow-test-" + alert.Identifier
+	}
+	if alert.State == StateDown {
+		event.EventAction = "trigger"
+		event.Payload = &pagerDutyPayload{
+			Summary:   alert.Message,
+			Source:    alert.Identifier,
+			Severity:  "critical",
+			Timestamp: alert.At.Format(time.RFC3339),
+		}
+		if alert.Test {
+			event.Payload.Severity = "info"
+		}
+	}
+	return event
+}
@@ -0,0 +1,81 @@
+package meow
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRenderAlertMessage(t *testing.T) {
+	data := AlertData{
+		Endpoint:       Endpoint{Identifier: "libvirt", Labels: map[string]string{"env": "prod"}},
+		State:          StateDown,
+		At:             time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC),
+		FailedAttempts: 3,
+		Status:         503,
+		Error:          "service unavailable",
+	}
+	up := data
+	up.State = StateUp
+
+	tests := []struct {
+		name string
+		tmpl string
+		data AlertData
+		want string
+	}{
+		{"default down", "", data, "libvirt is offline (3 failed attempts)"},
+		{"default up", "", up, "libvirt is online again"},
+		{"custom", `[{{index .Endpoint.Labels "env"}}] {{.Endpoint.Identifier}} {{.State}}: {{.Status}} {{.Error}}`, data,
+			"[prod] libvirt down: 503 service unavailable"},
+		{"time", `{{.Endpoint.Identifier}} since {{.At.Format "15:04"}}`, data, "libvirt since 12:00"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := RenderAlertMessage(test.tmpl, test.data)
+			if err != nil {
+				t.Fatalf("got error %v, want none", err)
+			}
+			if got != test.want {
+				t.Errorf("got message %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRenderAlertMessageFailsOnInvalidTemplates(t *testing.T) {
+	tests := map[string]string{
+		"unclosed action": `{{.Endpoint.Identifier`,
+		"unknown field":   `{{.Endpoint.Name}} is down`,
+		"unknown func":    `{{shout .State}}`,
+	}
+	for name, tmpl := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got, err := RenderAlertMessage(tmpl, AlertData{}); err == nil {
+				t.Errorf("got message %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestEndpointFromPayloadRejectsInvalidAlertTemplates(t *testing.T) {
+	payload := EndpointPayload{
+		Identifier:    "libvirt",
+		URL:           "https://libvirt.org/",
+		Method:        "GET",
+		StatusOnline:  200,
+		Frequency:     "1m",
+		FailAfter:     3,
+		AlertTemplate: `{{.Endpoint.Name}} is down`,
+	}
+	_, err := EndpointFromPayload(payload)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "alert_template" {
+		t.Errorf("got error %v, want one about the alert template", err)
+	}
+
+	payload.AlertTemplate = `{{.Endpoint.Identifier}} failed {{.FailedAttempts}} times`
+	if _, err := EndpointFromPayload(payload); err != nil {
+		t.Errorf("got error %v for a valid alert template, want none", err)
+	}
+}
@@ -0,0 +1,179 @@
+package meow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// StateBatch buffers the writes recording the outcome of checks, which are sent
+// to each shard in pipelined batches once size commands are buffered for it, or
+// every interval, rather than one by one. State changes, which are published,
+// are not buffered, but written once the writes buffered before them are. It is
+// safe for concurrent use.
+type StateBatch struct {
+	shards *Shards
+	size   int
+
+	mu      sync.Mutex
+	pending []valkey.Commands
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewStateBatch creates a batch flushing the writes to shards. The writes
+// flushed every interval that fail are reported to report. A size of 1 or less
+// disables batching.
+func NewStateBatch(shards *Shards, size int, interval time.Duration, report func(error)) *StateBatch {
+	b := &StateBatch{
+		shards:  shards,
+		size:    max(size, 1),
+		pending: make([]valkey.Commands, len(shards.clients)),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(b.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := b.Flush(context.Background()); err != nil {
+					report(err)
+				}
+			case <-b.stop:
+				return
+			}
+		}
+	}()
+	return b
+}
+
+// RecordConsecutiveFailures buffers the write of RecordConsecutiveFailures.
+func (b *StateBatch) RecordConsecutiveFailures(ctx context.Context, identifier string, at time.Time, failures int, reason FailureReason) error {
+	vk := b.shards.For(identifier)
+	return b.add(ctx, identifier, consecutiveFailuresCommand(vk, identifier, at, failures, reason))
+}
+
+// RecordFlapping buffers the write of RecordFlapping.
+func (b *StateBatch) RecordFlapping(ctx context.Context, identifier string, flapping bool) error {
+	vk := b.shards.For(identifier)
+	return b.add(ctx, identifier, flappingCommand(vk, identifier, flapping))
+}
+
+// RecordServingStatus buffers the write of RecordServingStatus.
+func (b *StateBatch) RecordServingStatus(ctx context.Context, identifier string, status string) error {
+	vk := b.shards.For(identifier)
+	return b.add(ctx, identifier, servingStatusCommand(vk, identifier, status))
+}
+
+// RecordLatency buffers the writes of RecordLatency.
+func (b *StateBatch) RecordLatency(ctx context.Context, identifier string, at time.Time, latency time.Duration) error {
+	vk := b.shards.For(identifier)
+	return b.add(ctx, identifier, latencyCommands(vk, identifier, at, latency)...)
+}
+
+// RecordAlert buffers the write of RecordAlert.
+func (b *StateBatch) RecordAlert(ctx context.Context, identifier string, at time.Time) error {
+	vk := b.shards.For(identifier)
+	return b.add(ctx, identifier, alertCommand(vk, identifier, at))
+}
+
+// RecordFailure buffers the writes of RecordFailure.
+func (b *StateBatch) RecordFailure(ctx context.Context, identifier string, length uint16, failure Failure) error {
+	cmds, err := failureCommands(b.shards.For(identifier), identifier, length, failure)
+	if err != nil {
+		return err
+	}
+	return b.add(ctx, identifier, cmds...)
+}
+
+// RecordStateChange flushes the writes buffered for the shard holding the
+// endpoint, so that they are not written after the state change, and records
+// the state change right away (see RecordStateChange).
+func (b *StateBatch) RecordStateChange(ctx context.Context, change StateChange) error {
+	i := b.shards.index(change.Identifier)
+	b.mu.Lock()
+	pending := b.pending[i]
+	b.pending[i] = nil
+	b.mu.Unlock()
+	if err := b.send(ctx, i, pending); err != nil {
+		return err
+	}
+	return RecordStateChange(ctx, b.shards.clients[i], change)
+}
+
+// add buffers the commands for the shard holding the endpoint with identifier,
+// and flushes that shard's commands if the batch is full or already closed.
+func (b *StateBatch) add(ctx context.Context, identifier string, cmds ...valkey.Completed) error {
+	i := b.shards.index(identifier)
+	b.mu.Lock()
+	b.pending[i] = append(b.pending[i], cmds...)
+	var full valkey.Commands
+	if len(b.pending[i]) >= b.size || b.closed {
+		full, b.pending[i] = b.pending[i], nil
+	}
+	b.mu.Unlock()
+	return b.send(ctx, i, full)
+}
+
+// Flush sends the writes buffered for all shards.
+func (b *StateBatch) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make([]valkey.Commands, len(pending))
+	b.mu.Unlock()
+	var errs []error
+	for i, cmds := range pending {
+		if err := b.send(ctx, i, cmds); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("flush state writes: %v", errs)
+	}
+	return nil
+}
+
+// Close stops flushing periodically, and flushes the writes buffered. Writes
+// added afterwards are sent right away.
+func (b *StateBatch) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+	close(b.stop)
+	<-b.done
+	return b.Flush(ctx)
+}
+
+// send pipelines the commands to the shard with index i.
+func (b *StateBatch) send(ctx context.Context, i int, cmds valkey.Commands) error {
+	if len(cmds) == 0 {
+		return nil
+	}
+	vk := b.shards.clients[i]
+	failed := 0
+	var first error
+	for _, result := range vk.DoMulti(ctx, cmds...) {
+		if err := result.Error(); err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+	if first != nil {
+		return fmt.Errorf("write batch to db %d: %d of %d commands failed: %v", b.shards.dbs[i], failed, len(cmds), first)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package meow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/valkey-io/valkey-go"
+)
+
+// newTestBatch returns a batch writing to a single shard of an in-memory
+// Valkey server, which only flushes the writes when told to.
+func newTestBatch(t *testing.T) (*StateBatch, *Shards, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	// miniredis does not support client-side caching
+	options := valkey.ClientOption{InitAddress: []string{server.Addr()}, DisableCache: true}
+	shards, err := NewShardsWithOptions(options, 1)
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	t.Cleanup(shards.Close)
+	batch := NewStateBatch(shards, 1000, time.Hour, func(err error) { t.Error(err) })
+	t.Cleanup(func() { batch.Close(context.Background()) })
+	return batch, shards, server
+}
+
+func TestStateBatchFlushesOnClose(t *testing.T) {
+	batch, _, server := newTestBatch(t)
+	ctx := context.Background()
+	at := time.Now()
+
+	if err := batch.RecordConsecutiveFailures(ctx, "libvirt", at, 2, ReasonTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.RecordFailure(ctx, "libvirt", 0, Failure{At: at, Reason: ReasonTimeout}); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.RecordLatency(ctx, "libvirt", at, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.RecordAlert(ctx, "libvirt", at); err != nil {
+		t.Fatal(err)
+	}
+	if server.Exists(StateKey("libvirt")) {
+		t.Fatal("writes were not buffered")
+	}
+
+	if err := batch.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.HGet(StateKey("libvirt"), StateFieldConsecutiveFailures); got != "2" {
+		t.Errorf("got %q consecutive failures, want 2", got)
+	}
+	if got := server.HGet(StateKey("libvirt"), StateFieldLastAlerted); got != at.Format(time.RFC3339Nano) {
+		t.Errorf("got last alerted %q, want %s", got, at.Format(time.RFC3339Nano))
+	}
+	if failures, _ := server.List(HistoryKey("libvirt")); len(failures) != 1 {
+		t.Errorf("got %d failures, want 1", len(failures))
+	}
+	if latencies, _ := server.ZMembers(LatencyKey("libvirt")); len(latencies) != 1 {
+		t.Errorf("got %d latencies, want 1", len(latencies))
+	}
+
+	// writes after closing are sent right away
+	if err := batch.RecordConsecutiveFailures(ctx, "libvirt", at, 3, ReasonTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.HGet(StateKey("libvirt"), StateFieldConsecutiveFailures); got != "3" {
+		t.Errorf("got %q consecutive failures after closing, want 3", got)
+	}
+}
+
+func TestStateBatchDropsWritesOfChecksBeforeReset(t *testing.T) {
+	batch, shards, server := newTestBatch(t)
+	ctx := context.Background()
+	checked := time.Now()
+
+	if err := batch.RecordConsecutiveFailures(ctx, "libvirt", checked, 4, ReasonDNS); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.RecordAlert(ctx, "libvirt", checked); err != nil {
+		t.Fatal(err)
+	}
+	if err := ResetState(ctx, shards.For("libvirt"), "libvirt", checked.Add(time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.HGet(StateKey("libvirt"), StateFieldConsecutiveFailures); got != "0" {
+		t.Errorf("got %q consecutive failures after reset, want 0", got)
+	}
+	for _, field := range []string{StateFieldFailureReason, StateFieldLastAlerted} {
+		if got := server.HGet(StateKey("libvirt"), field); got != "" {
+			t.Errorf("got %s %q after reset, want none", field, got)
+		}
+	}
+
+	// checks after the reset are recorded
+	if err := batch.RecordConsecutiveFailures(ctx, "libvirt", checked.Add(time.Second), 1, ReasonDNS); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.HGet(StateKey("libvirt"), StateFieldConsecutiveFailures); got != "1" {
+		t.Errorf("got %q consecutive failures after a check following the reset, want 1", got)
+	}
+}
+
+func TestStateBatchFlushesBeforeStateChange(t *testing.T) {
+	batch, _, server := newTestBatch(t)
+	ctx := context.Background()
+	at := time.Now()
+
+	if err := batch.RecordConsecutiveFailures(ctx, "libvirt", at, 3, ReasonStatus); err != nil {
+		t.Fatal(err)
+	}
+	change := StateChange{Identifier: "libvirt", State: StateDown, Previous: StateUp, At: at}
+	if err := batch.RecordStateChange(ctx, change); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.HGet(StateKey("libvirt"), StateFieldState); got != StateDown {
+		t.Errorf("got state %q, want %q", got, StateDown)
+	}
+	if got := server.HGet(StateKey("libvirt"), StateFieldConsecutiveFailures); got != "3" {
+		t.Errorf("got %q consecutive failures written with the state change, want 3", got)
+	}
+}
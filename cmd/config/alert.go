@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/patrickbucher/meow"
+)
+
+// testAlertResult reports whether a test alert was sent to a channel.
+type testAlertResult struct {
+	Type   string `json:"type"`
+	Target string `json:"target"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+}
+
+// postTestAlert sends a test alert about the endpoint going offline to all its
+// alert channels, leaving its state as it is.
+func postTestAlert(ctx context.Context, shards *meow.Shards, alerter *meow.Alerter, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	identifier := r.PathValue("id")
+	payload, err := fetchPayload(ctx, shards, identifier)
+	if err != nil {
+		slog.Error("fetch endpoint", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if payload == nil {
+		slog.Warn("no such endpoint", "identifier", identifier)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	endpoint, err := meow.EndpointFromPayload(*payload)
+	if err != nil {
+		slog.Error("convert payload to endpoint", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data := meow.AlertData{
+		Endpoint:       *endpoint,
+		State:          meow.StateDown,
+		At:             time.Now(),
+		FailedAttempts: int(endpoint.FailAfter),
+		Error:          "test alert",
+	}
+	message, err := meow.RenderAlertMessage(endpoint.AlertTemplate, data)
+	if err != nil {
+		slog.Error("render alert message", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	alert := meow.Alert{
+		Identifier: identifier,
+		State:      data.State,
+		At:         data.At,
+		Message:    "Test alert: " + message,
+		Error:      data.Error,
+		Test:       true,
+
+		WebhookSecret: endpoint.WebhookSecret,
+	}
+
+	errs := alerter.Notifiers(endpoint.Alerts).NotifyEach(r.Context(), alert)
+	results := make([]testAlertResult, len(endpoint.Alerts))
+	for i, channel := range endpoint.Alerts {
+		results[i] = testAlertResult{Type: channel.Type, Target: channel.Target, OK: true}
+		if err := errs[i]; err != nil {
+			slog.Warn("send test alert", "identifier", identifier, "type", channel.Type, "err", err)
+			results[i].OK = false
+			results[i].Error = err.Error()
+		}
+	}
+
+	out, err := marshalJSON(results, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal test alert results", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// getFailedAlerts lists the alerts whose delivery failed, oldest first, which
+// are kept in the first shard.
+func getFailedAlerts(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	failed, err := meow.FailedAlerts(ctx, shards.All()[0])
+	if err != nil {
+		slog.Error("get failed alerts", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	data, err := marshalJSON(failed, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal failed alerts", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// requireAPIKey wraps the handler so that it only serves requests providing
+// the API key, or the admin token, if any, as a bearer token. If apiKey is
+// empty, authentication is disabled, and all requests are served.
+func requireAPIKey(apiKey, adminToken string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		isAdmin := adminToken != "" && hasBearerToken(r, adminToken)
+		if apiKey != "" && !hasBearerToken(r, apiKey) && !isAdmin {
+			slog.Warn("request rejected: missing or wrong API key",
+				"remote", r.RemoteAddr, "url", r.URL)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// requireAdminToken wraps the handler of destructive operations so that it only
+// serves requests providing the admin token as a bearer token. Requests
+// providing the API key instead are forbidden. If adminToken is empty, the
+// handler requires the API key like requireAPIKey.
+func requireAdminToken(adminToken, apiKey string, handler http.HandlerFunc) http.HandlerFunc {
+	if adminToken == "" {
+		return requireAPIKey(apiKey, "", handler)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if hasBearerToken(r, adminToken) {
+			handler(w, r)
+			return
+		}
+		if apiKey != "" && hasBearerToken(r, apiKey) {
+			slog.Warn("request rejected: admin token required",
+				"remote", r.RemoteAddr, "url", r.URL)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		slog.Warn("request rejected: missing or wrong admin token",
+			"remote", r.RemoteAddr, "url", r.URL)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+}
+
+// hasBearerToken reports whether the request's Authorization header carries
+// the given bearer token.
+func hasBearerToken(r *http.Request, token string) bool {
+	provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenTiers(t *testing.T) {
+	const apiKey, adminToken = "key", "admin"
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		token      string
+		status     int
+		challenged bool
+	}{
+		{"normal route without token", requireAPIKey(apiKey, adminToken, ok), "", http.StatusUnauthorized, true},
+		{"normal route with wrong token", requireAPIKey(apiKey, adminToken, ok), "wrong", http.StatusUnauthorized, true},
+		{"normal route with API key", requireAPIKey(apiKey, adminToken, ok), apiKey, http.StatusOK, false},
+		{"normal route with admin token", requireAPIKey(apiKey, adminToken, ok), adminToken, http.StatusOK, false},
+		{"destructive route without token", requireAdminToken(adminToken, apiKey, ok), "", http.StatusUnauthorized, true},
+		{"destructive route with wrong token", requireAdminToken(adminToken, apiKey, ok), "wrong", http.StatusUnauthorized, true},
+		{"destructive route with API key", requireAdminToken(adminToken, apiKey, ok), apiKey, http.StatusForbidden, false},
+		{"destructive route with admin token", requireAdminToken(adminToken, apiKey, ok), adminToken, http.StatusOK, false},
+		{"destructive route without admin token configured", requireAdminToken("", apiKey, ok), apiKey, http.StatusOK, false},
+		{"destructive route without credentials configured", requireAdminToken("", "", ok), "", http.StatusOK, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/reset?prefix=shop-", nil)
+			if test.token != "" {
+				r.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			w := httptest.NewRecorder()
+			test.handler(w, r)
+			if w.Code != test.status {
+				t.Errorf("got status %d, want %d", w.Code, test.status)
+			}
+			if challenged := w.Header().Get("WWW-Authenticate") != ""; challenged != test.challenged {
+				t.Errorf("got WWW-Authenticate header %q, want one: %t", w.Header().Get("WWW-Authenticate"), test.challenged)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// listingCache holds the serialized listings of all endpoints for a short time,
+// which saves reading all the endpoints from Valkey for every request. The
+// listings differ by variant, e.g. JSON or CSV. Writes must invalidate the
+// cache. Listings are cached along with the version of the endpoints they were
+// read at, so that writes of other instances of the config server, which bump
+// the version, become visible right away.
+type listingCache struct {
+	ttl        time.Duration
+	mu         sync.Mutex
+	generation uint64
+	entries    map[string]cachedListing
+}
+
+// cachedListing is a serialized listing with its content type, which was read
+// at the version of the endpoints.
+type cachedListing struct {
+	data        []byte
+	contentType string
+	version     int64
+	expires     time.Time
+}
+
+// newListingCache creates a cache holding listings for ttl, which disables
+// caching if it is not positive.
+func newListingCache(ttl time.Duration) *listingCache {
+	return &listingCache{ttl: ttl, entries: make(map[string]cachedListing)}
+}
+
+// get returns the unexpired listing of the variant read at the version, if
+// any, and the current generation to be passed to put otherwise.
+func (c *listingCache) get(variant string, version int64) (cachedListing, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	listing, ok := c.entries[variant]
+	if !ok || listing.version != version || time.Now().After(listing.expires) {
+		return cachedListing{}, c.generation, false
+	}
+	return listing, c.generation, true
+}
+
+// put caches the listing of the variant read at the version, unless the cache
+// was invalidated since the generation was obtained, since the listing might be
+// outdated then.
+func (c *listingCache) put(variant string, generation uint64, version int64, data []byte, contentType string) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	c.entries[variant] = cachedListing{data, contentType, version, time.Now().Add(c.ttl)}
+}
+
+// invalidate drops all cached listings.
+func (c *listingCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	clear(c.entries)
+}
+
+// invalidating wraps the handler writing endpoints, so that the cache is
+// invalidated once it is done.
+func (c *listingCache) invalidating(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer c.invalidate()
+		handler(w, r)
+	}
+}
+
+// responseBuffer collects a response to be cached instead of sending it.
+type responseBuffer struct {
+	bytes.Buffer
+	header http.Header
+	status int
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header), status: http.StatusOK}
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	b.status = status
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/patrickbucher/meow"
+	"github.com/valkey-io/valkey-go"
+)
+
+// compareAndSet sets the field ARGV[1] of the endpoint hash KEYS[1] to ARGV[3],
+// or removes it if ARGV[3] is empty, if it still has the value ARGV[2], which
+// is empty for a field not set, and stores the modification time ARGV[4] if the
+// value changed. It returns 1 if the field was set, 0 if it had another value,
+// and -1 if there is no such endpoint.
+var compareAndSet = valkey.NewLuaScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+local current = redis.call("HGET", KEYS[1], ARGV[1]) or ""
+if current ~= ARGV[2] then
+	return 0
+end
+if current == ARGV[3] then
+	return 1
+end
+if ARGV[3] == "" then
+	redis.call("HDEL", KEYS[1], ARGV[1])
+else
+	redis.call("HSET", KEYS[1], ARGV[1], ARGV[3])
+end
+redis.call("HSET", KEYS[1], "modified_at", ARGV[4])
+return 1
+`)
+
+// casRequest asks to set a field of an endpoint, in the representation of its
+// hash as returned by /raw, to New if it still has the value Expected, which is
+// empty for a field not set.
+type casRequest struct {
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	New      string `json:"new"`
+}
+
+// postEndpointCAS sets a single field of an endpoint atomically if it still has
+// the value expected, and rejects the request with 409 Conflict otherwise. The
+// endpoint must remain valid with the new value, which is normalized like the
+// values of posted endpoints, e.g. 1m0s instead of 1m.
+func postEndpointCAS(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	var cas casRequest
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&cas); err != nil {
+		slog.Warn("parse JSON body", "err", err)
+		describeProblem(r, fmt.Errorf("parse JSON body: %v", err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if cas.Field == meow.FieldIdentifier || cas.Field == meow.FieldModifiedAt {
+		slog.Warn("request rejected: field cannot be set", "field", cas.Field)
+		describeProblem(r, &meow.ValidationError{Field: cas.Field, Message: fmt.Sprintf("%s cannot be set", cas.Field)})
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	identifier := r.PathValue("id")
+	key := meow.EndpointKey(identifier)
+	vk := shards.For(identifier)
+	kvs, err := vk.Do(ctx, vk.B().Hgetall().Key(key).Build()).AsStrMap()
+	if err != nil {
+		slog.Error("hgetall", "key", key, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(kvs) == 0 {
+		slog.Warn("no such endpoint", "identifier", identifier)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// validate the endpoint as it would be with the new value
+	changed := maps.Clone(kvs)
+	changed[cas.Field] = cas.New
+	payload, err := payloadFromValkeyMap(changed)
+	if err != nil {
+		slog.Warn("convert changed hash to payload", "key", key, "err", err)
+		describeProblem(r, &meow.ValidationError{Field: cas.Field, Message: err.Error()})
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	endpoint, err := meow.EndpointFromPayload(payload)
+	if err != nil {
+		slog.Warn("convert changed payload to endpoint", "key", key, "err", err)
+		describeProblem(r, err)
+		w.WriteHeader(statusForEndpointError(err))
+		return
+	}
+	invalid, err := checkDependencies(ctx, shards, endpoint)
+	if err != nil {
+		slog.Error("check dependencies", "identifier", endpoint.Identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if invalid != nil {
+		slog.Warn("endpoint rejected: invalid dependencies", "identifier", endpoint.Identifier, "err", invalid)
+		describeProblem(r, invalid)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	fields := endpointHashFields(endpoint)
+	i := slices.IndexFunc(fields, func(field hashField) bool { return field.name == cas.Field })
+	if i < 0 && cas.New != "" {
+		slog.Warn("request rejected: no such field", "field", cas.Field)
+		describeProblem(r, &meow.ValidationError{Field: cas.Field, Message: fmt.Sprintf(`"%s" is not a field`, cas.Field)})
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	normalized := ""
+	if i >= 0 {
+		normalized = fields[i].value
+	}
+
+	args := []string{cas.Field, cas.Expected, normalized, modifiedAt()}
+	result, err := compareAndSet.Exec(ctx, vk, []string{key}, args).AsInt64()
+	if err != nil {
+		slog.Error("compare and set", "key", key, "field", cas.Field, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	switch result {
+	case -1:
+		slog.Warn("no such endpoint", "identifier", identifier)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case 0:
+		slog.Warn("request rejected: field changed", "identifier", identifier, "field", cas.Field)
+		describeProblem(r, fmt.Errorf(`%s of "%s" does not have the value expected`, cas.Field, identifier))
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	bumpVersion(ctx, shards)
+
+	// report the change like an update does
+	existing := map[string]string{cas.Field: cas.Expected}
+	data, err := json.Marshal(diffHashFields(existing, []hashField{{cas.Field, normalized}}))
+	if err != nil {
+		slog.Error("marshal changes", "key", key, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
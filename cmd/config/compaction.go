@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/patrickbucher/meow"
+	"github.com/valkey-io/valkey-go"
+)
+
+// compactionInterval is how often the histories are compacted.
+const compactionInterval = time.Hour
+
+// compactionLease names the lease on compacting the histories, which is held
+// in the first shard.
+const compactionLease = "meow:compaction"
+
+// compactHistories compacts the failed checks older than retention into hourly
+// aggregates for all endpoints, right away and then every compactionInterval.
+// Hourly aggregates older than hourlyRetention are deleted, unless it is 0.
+// Only the instance of the config server holding the lease on compacting, for
+// which owner competes, does so.
+func compactHistories(ctx context.Context, shards *meow.Shards, owner string, retention, hourlyRetention time.Duration) {
+	ticker := time.NewTicker(compactionInterval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		held, _, err := meow.HoldLease(ctx, shards.All()[0], compactionLease, owner, 2*compactionInterval)
+		if err != nil {
+			slog.Error("hold compaction lease", "err", err)
+			continue
+		} else if !held {
+			continue
+		}
+		identifiers, err := listIdentifiers(ctx, shards)
+		if err != nil {
+			slog.Error("list identifiers", "err", err)
+		}
+		now := time.Now()
+		for _, identifier := range identifiers {
+			vk := shards.For(identifier)
+			frequency := meow.DefaultFrequency
+			cmd := vk.B().Hget().Key(meow.EndpointKey(identifier)).Field(meow.FieldFrequency).Build()
+			if raw, err := vk.Do(ctx, cmd).ToString(); err == nil {
+				if parsed, err := time.ParseDuration(raw); err == nil {
+					frequency = parsed
+				}
+			} else if !valkey.IsValkeyNil(err) {
+				slog.Error("hget", "key", meow.EndpointKey(identifier), "err", err)
+				continue
+			}
+			compacted, err := meow.CompactHistory(ctx, vk, identifier, now.Add(-retention), frequency)
+			if err != nil {
+				slog.Error("compact history", "identifier", identifier, "err", err)
+			}
+			if compacted > 0 {
+				slog.Info("compacted history", "identifier", identifier, "failures", compacted)
+			}
+			if hourlyRetention > 0 {
+				if _, err := meow.PruneHourlyHistory(ctx, vk, identifier, now.Add(-hourlyRetention)); err != nil {
+					slog.Error("prune hourly history", "identifier", identifier, "err", err)
+				}
+			}
+		}
+	}
+}
+
+func getEndpointHourlyHistory(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	identifier := r.PathValue("id")
+	vk := shards.For(identifier)
+	exists, err := vk.Do(ctx, vk.B().Exists().Key(meow.EndpointKey(identifier)).Build()).AsInt64()
+	if err != nil {
+		slog.Error("exists", "key", meow.EndpointKey(identifier), "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if exists == 0 {
+		slog.Warn("no such endpoint", "identifier", identifier)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	hourly, err := meow.HourlyHistory(ctx, vk, identifier)
+	if err != nil {
+		slog.Error("hourly history", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	data, err := marshalJSON(hourly, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal hourly history", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
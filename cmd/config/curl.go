@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/patrickbucher/meow"
+)
+
+// curlCommand returns a shell command reproducing the request the probe
+// performs to check the endpoint, preceded by a comment stating the expected
+// status. The passwords of the URL and proxy are redacted unless reveal is set.
+func curlCommand(e *meow.Endpoint, reveal bool) string {
+	if e.Protocol == meow.ProtocolGRPC {
+		return grpcurlCommand(e)
+	}
+	rawURL := e.RawURL()
+	if !reveal {
+		rawURL = redactURL(rawURL)
+	}
+	method := e.RequestMethod()
+	options := "--request " + method
+	if method == http.MethodHead {
+		options = "--head"
+	}
+	if e.Proxy != nil {
+		proxyURL := e.Proxy.String()
+		if !reveal {
+			proxyURL = redactURL(proxyURL)
+		}
+		options += " --proxy " + shellQuote(proxyURL)
+	}
+	userAgent := e.UserAgent
+	if userAgent == "" {
+		// the probe's -user-agent flag is unknown here
+		userAgent = meow.DefaultUserAgent()
+	}
+	options += " --user-agent " + shellQuote(userAgent)
+	if e.Timeout > 0 {
+		// the probe's -timeout flag applies otherwise
+		options += fmt.Sprintf(" --max-time %g", e.Timeout.Seconds())
+	}
+	if len(e.QueryParams) > 0 {
+		// the tokens are rendered now rather than when the command is run
+		now := time.Now()
+		options += " --get"
+		for _, name := range slices.Sorted(maps.Keys(e.QueryParams)) {
+			param := name + "=" + meow.RenderQueryParam(e.QueryParams[name], now)
+			options += " --data-urlencode " + shellQuote(param)
+		}
+	}
+	expectation := fmt.Sprintf("status %d", e.StatusOnline)
+	writeOut := `%{http_code}\n`
+	if e.ExpectRedirectTo != nil {
+		expectation += " redirecting to " + e.ExpectRedirectTo.String()
+		writeOut = `%{http_code} %{redirect_url}\n`
+	} else {
+		maxRedirects := int(e.MaxRedirects)
+		if maxRedirects == 0 {
+			maxRedirects = meow.DefaultMaxRedirects
+		}
+		options = fmt.Sprintf("--location --max-redirs %d %s", maxRedirects, options)
+	}
+	curl := func(rawURL string) string {
+		return fmt.Sprintf("curl --silent %s --output /dev/null --write-out '%s' %s\n",
+			options, writeOut, shellQuoteURL(rawURL))
+	}
+	command := fmt.Sprintf("# %s is online if it responds with %s\n", e.Identifier, expectation) + curl(rawURL)
+	for _, u := range e.FailoverURLs {
+		failoverURL := u.String()
+		if !reveal {
+			failoverURL = redactURL(failoverURL)
+		}
+		command += "# otherwise, failing over to\n" + curl(failoverURL)
+	}
+	return command
+}
+
+// grpcurlCommand returns a grpcurl command performing the gRPC health check of
+// the endpoint like the probe does.
+func grpcurlCommand(e *meow.Endpoint) string {
+	options := ""
+	if e.URL.Scheme == "grpc" {
+		options = "-plaintext "
+	}
+	if service := strings.TrimPrefix(e.URL.Path, "/"); service != "" {
+		options += "-d " + shellQuote(fmt.Sprintf(`{"service":%q}`, service)) + " "
+	}
+	return fmt.Sprintf("# %s is online if it responds with status SERVING\n"+
+		"grpcurl %s%s grpc.health.v1.Health/Check\n", e.Identifier, options, shellQuote(e.URL.Host))
+}
+
+// redactURL replaces the password of the URL's user information, if any.
+func redactURL(rawURL string) string {
+	scheme, rest, ok := strings.Cut(rawURL, "://")
+	if !ok {
+		return rawURL
+	}
+	authority := rest
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		authority = rest[:i]
+	}
+	i := strings.LastIndex(authority, "@")
+	if i < 0 {
+		return rawURL
+	}
+	user, _, hasPassword := strings.Cut(authority[:i], ":")
+	if !hasPassword {
+		return rawURL
+	}
+	return scheme + "://" + user + ":xxxxx" + rest[i:]
+}
+
+var shellVarPattern = regexp.MustCompile(`\$\{[A-Za-z_][A-Za-z0-9_]*\}`)
+
+// shellQuoteURL quotes the URL for the shell. References to variables of a URL
+// template are left unquoted, so that the shell expands them like the probe.
+func shellQuoteURL(rawURL string) string {
+	var quoted strings.Builder
+	last := 0
+	for _, loc := range shellVarPattern.FindAllStringIndex(rawURL, -1) {
+		quoted.WriteString(shellQuote(rawURL[last:loc[0]]))
+		quoted.WriteString(`"` + rawURL[loc[0]:loc[1]] + `"`)
+		last = loc[1]
+	}
+	quoted.WriteString(shellQuote(rawURL[last:]))
+	return quoted.String()
+}
+
+func shellQuote(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/patrickbucher/meow"
+)
+
+// defaults are the values of the fields endpoints are created with if their
+// payload omits them, as configured by flags of the config server.
+type defaults struct {
+	Frequency     string `json:"frequency"`
+	AlertCooldown string `json:"alert_cooldown"`
+	Timeout       string `json:"timeout,omitempty"`
+	Retries       uint8  `json:"retries,omitempty"`
+}
+
+func getDefaults(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	current := defaults{
+		Frequency:     meow.DefaultFrequency.String(),
+		AlertCooldown: meow.DefaultAlertCooldown.String(),
+		Retries:       meow.DefaultRetries,
+	}
+	if meow.DefaultTimeout > 0 {
+		current.Timeout = meow.DefaultTimeout.String()
+	}
+	data, err := marshalJSON(current, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal defaults", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
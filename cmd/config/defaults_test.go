@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patrickbucher/meow"
+)
+
+// setTestDefaults sets the defaults of endpoints until the test is done.
+func setTestDefaults(t *testing.T, frequency, timeout time.Duration, retries uint8) {
+	t.Helper()
+	previousFrequency, previousTimeout, previousRetries := meow.DefaultFrequency, meow.DefaultTimeout, meow.DefaultRetries
+	t.Cleanup(func() {
+		meow.DefaultFrequency, meow.DefaultTimeout, meow.DefaultRetries = previousFrequency, previousTimeout, previousRetries
+	})
+	meow.DefaultFrequency, meow.DefaultTimeout, meow.DefaultRetries = frequency, timeout, retries
+}
+
+func TestGetDefaults(t *testing.T) {
+	get := func(_ context.Context, w http.ResponseWriter, r *http.Request) {
+		getDefaults(w, r)
+	}
+
+	setTestDefaults(t, time.Minute, 0, 0)
+	w := handle(get, http.MethodGet, "/defaults", "")
+	if want := `{"frequency":"1m0s","alert_cooldown":"30m0s"}`; w.Body.String() != want {
+		t.Errorf("defaults left to the probe: got %s, want %s", w.Body.String(), want)
+	}
+
+	setTestDefaults(t, 5*time.Minute, 5*time.Second, 3)
+	w = handle(get, http.MethodGet, "/defaults", "")
+	if want := `{"frequency":"5m0s","alert_cooldown":"30m0s","timeout":"5s","retries":3}`; w.Body.String() != want {
+		t.Errorf("defaults set: got %s, want %s", w.Body.String(), want)
+	}
+}
+
+func TestPostEndpointMergesDefaults(t *testing.T) {
+	shards, server := newTestShards(t, 1)
+	setTestDefaults(t, 5*time.Minute, 5*time.Second, 3)
+	omitted := `{"identifier":"libvirt","url":"https://libvirt.org/","method":"GET","status_online":200,"fail_after":3}`
+	overridden := `{"identifier":"go-dev","url":"https://go.dev/","method":"GET","status_online":200,"fail_after":3,"frequency":"1m","timeout":"2s","retries":1}`
+	postTestEndpoint(t, shards, omitted)
+	postTestEndpoint(t, shards, overridden)
+
+	// changing the defaults does not affect the endpoints stored already
+	setTestDefaults(t, time.Hour, time.Second, 5)
+
+	tests := []struct {
+		identifier string
+		want       map[string]string
+	}{
+		{"libvirt", map[string]string{meow.FieldFrequency: "5m0s", meow.FieldTimeout: "5s", meow.FieldRetries: "3"}},
+		{"go-dev", map[string]string{meow.FieldFrequency: "1m0s", meow.FieldTimeout: "2s", meow.FieldRetries: "1"}},
+	}
+	for _, test := range tests {
+		for field, want := range test.want {
+			if got := server.HGet(meow.EndpointKey(test.identifier), field); got != want {
+				t.Errorf("%s of %s: got %q, want %q", field, test.identifier, got, want)
+			}
+		}
+	}
+
+	get := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		m := http.NewServeMux()
+		m.HandleFunc("GET /endpoints/{id}", func(w http.ResponseWriter, r *http.Request) {
+			getEndpoint(ctx, shards, http.StatusNotFound, w, r)
+		})
+		m.ServeHTTP(w, r)
+	}
+	w := handle(get, http.MethodGet, "/endpoints/libvirt", "")
+	if body := w.Body.String(); !strings.Contains(body, `"timeout":"5s","retries":3`) {
+		t.Errorf("get endpoint created with defaults: got %s", body)
+	}
+}
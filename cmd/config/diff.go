@@ -0,0 +1,277 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/patrickbucher/meow"
+)
+
+// configDiff lists the changes required to make the stored endpoints match a
+// desired config.
+type configDiff struct {
+	Create    []string         `json:"create"`
+	Update    []endpointUpdate `json:"update"`
+	Delete    []string         `json:"delete"`
+	Unchanged int              `json:"unchanged"`
+}
+
+// endpointUpdate describes the changes of a stored endpoint's hash fields.
+type endpointUpdate struct {
+	Identifier string                 `json:"identifier"`
+	Changes    map[string]fieldChange `json:"changes"`
+}
+
+// configPlan is the diff of a desired config along with what it was computed
+// from, so that it can be applied.
+type configPlan struct {
+	diff     configDiff
+	desired  map[string]*meow.Endpoint
+	existing map[string]map[string]string
+}
+
+func postDiff(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	desired, status, err := desiredConfigFromRequest(r)
+	if err != nil {
+		slog.Warn("desired config rejected", "err", err)
+		w.WriteHeader(status)
+		return
+	}
+	plan, err := planConfig(ctx, shards, desired)
+	if err != nil {
+		slog.Error("plan config", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	data, err := marshalJSON(plan.diff, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal diff", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// desiredConfigFromRequest parses the array of endpoints in the request's body.
+// Every endpoint must be valid, have an identifier of its own, and depend only
+// on endpoints of the desired config without forming cycles. If this fails,
+// the HTTP status to respond with is returned along with the error.
+func desiredConfigFromRequest(r *http.Request) ([]*meow.Endpoint, int, error) {
+	defer r.Body.Close()
+	var payloads []meow.EndpointPayload
+	if err := json.NewDecoder(r.Body).Decode(&payloads); err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("parse JSON body: %v", err)
+	}
+	endpoints := make([]*meow.Endpoint, 0, len(payloads))
+	identifiers := make(map[string]*meow.Endpoint)
+	for _, payload := range payloads {
+		endpoint, err := meow.EndpointFromPayload(payload)
+		if err != nil {
+			return nil, statusForEndpointError(err), fmt.Errorf("endpoint %q: %v", payload.Identifier, err)
+		}
+		if identifiers[endpoint.Identifier] != nil {
+			return nil, http.StatusUnprocessableEntity, fmt.Errorf("endpoint %q is listed twice", endpoint.Identifier)
+		}
+		identifiers[endpoint.Identifier] = endpoint
+		endpoints = append(endpoints, endpoint)
+	}
+	for _, endpoint := range endpoints {
+		for _, dependency := range endpoint.DependsOn {
+			if identifiers[dependency] == nil {
+				return nil, http.StatusUnprocessableEntity,
+					fmt.Errorf("endpoint %q depends on %q, which is not listed", endpoint.Identifier, dependency)
+			}
+		}
+	}
+	for _, endpoint := range endpoints {
+		cycle, _ := dependencyCycle(endpoint.Identifier, func(identifier string) ([]string, error) {
+			return identifiers[identifier].DependsOn, nil
+		})
+		if cycle != nil {
+			return nil, http.StatusUnprocessableEntity,
+				fmt.Errorf("dependencies of endpoint %q form a cycle: %s", endpoint.Identifier, strings.Join(cycle, " -> "))
+		}
+	}
+	return endpoints, 0, nil
+}
+
+// planConfig compares the desired endpoints to the stored ones. Stored
+// endpoints not desired are to be deleted.
+func planConfig(ctx context.Context, shards *meow.Shards, desired []*meow.Endpoint) (*configPlan, error) {
+	identifiers, err := listIdentifiers(ctx, shards)
+	if err != nil {
+		return nil, fmt.Errorf("list identifiers: %v", err)
+	}
+	plan := &configPlan{
+		diff: configDiff{
+			Create: make([]string, 0),
+			Update: make([]endpointUpdate, 0),
+			Delete: make([]string, 0),
+		},
+		desired:  make(map[string]*meow.Endpoint),
+		existing: make(map[string]map[string]string),
+	}
+	for _, endpoint := range desired {
+		plan.desired[endpoint.Identifier] = endpoint
+	}
+	for _, identifier := range identifiers {
+		key := meow.EndpointKey(identifier)
+		vk := shards.For(identifier)
+		kvs, err := vk.Do(ctx, vk.B().Hgetall().Key(key).Build()).AsStrMap()
+		if err != nil {
+			return nil, fmt.Errorf("hgetall %s: %v", key, err)
+		}
+		if len(kvs) == 0 {
+			continue
+		}
+		plan.existing[identifier] = kvs
+		if _, ok := plan.desired[identifier]; !ok {
+			plan.diff.Delete = append(plan.diff.Delete, identifier)
+		}
+	}
+	for _, endpoint := range desired {
+		existing, ok := plan.existing[endpoint.Identifier]
+		if !ok {
+			plan.diff.Create = append(plan.diff.Create, endpoint.Identifier)
+			continue
+		}
+		changes := diffHashFields(existing, endpointHashFields(endpoint))
+		if len(changes) == 0 {
+			plan.diff.Unchanged++
+			continue
+		}
+		plan.diff.Update = append(plan.diff.Update, endpointUpdate{endpoint.Identifier, changes})
+	}
+	slices.Sort(plan.diff.Create)
+	slices.SortFunc(plan.diff.Update, func(a, b endpointUpdate) int {
+		return cmp.Compare(a.Identifier, b.Identifier)
+	})
+	return plan, nil
+}
+
+// applyResult lists the actions taken to apply a desired config. Retained lists
+// the endpoints not part of the desired config, which were kept since deletes
+// were not enabled.
+type applyResult struct {
+	Created   []string         `json:"created"`
+	Updated   []endpointUpdate `json:"updated"`
+	Deleted   []string         `json:"deleted"`
+	Retained  []string         `json:"retained"`
+	Unchanged int              `json:"unchanged"`
+}
+
+// postApply reconciles the stored endpoints with the desired config. Endpoints
+// not part of it are only deleted if the delete query parameter is true.
+func postApply(ctx context.Context, shards *meow.Shards, maxEndpoints int, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	deletes := r.URL.Query().Get("delete") == "true"
+	desired, status, err := desiredConfigFromRequest(r)
+	if err != nil {
+		slog.Warn("desired config rejected", "err", err)
+		w.WriteHeader(status)
+		return
+	}
+	plan, err := planConfig(ctx, shards, desired)
+	if err != nil {
+		slog.Error("plan config", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	total := len(desired)
+	if !deletes {
+		total += len(plan.diff.Delete)
+	}
+	if maxEndpoints > 0 && len(plan.diff.Create) > 0 && total > maxEndpoints {
+		slog.Warn("desired config rejected: limit reached", "total", total, "max", maxEndpoints)
+		w.WriteHeader(http.StatusInsufficientStorage)
+		return
+	}
+
+	result, err := applyPlan(ctx, shards, plan, deletes)
+	if len(result.Created)+len(result.Updated)+len(result.Deleted) > 0 {
+		bumpVersion(ctx, shards)
+	}
+	if err != nil {
+		slog.Error("apply config", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	data, err := marshalJSON(result, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal apply result", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// applyPlan creates and updates the endpoints of the plan before deleting the
+// ones to be deleted, if deletes are enabled, so that dependencies are stored
+// before the endpoints depending on them. Applying the same plan again changes
+// nothing. On error, the result lists the actions taken so far.
+func applyPlan(ctx context.Context, shards *meow.Shards, plan *configPlan, deletes bool) (*applyResult, error) {
+	result := &applyResult{
+		Created:   make([]string, 0),
+		Updated:   make([]endpointUpdate, 0),
+		Deleted:   make([]string, 0),
+		Retained:  make([]string, 0),
+		Unchanged: plan.diff.Unchanged,
+	}
+	for _, identifier := range plan.diff.Create {
+		if err := storePlanned(ctx, shards, plan, identifier); err != nil {
+			return result, err
+		}
+		result.Created = append(result.Created, identifier)
+	}
+	for _, update := range plan.diff.Update {
+		if err := storePlanned(ctx, shards, plan, update.Identifier); err != nil {
+			return result, err
+		}
+		result.Updated = append(result.Updated, update)
+	}
+	if !deletes {
+		result.Retained = append(result.Retained, plan.diff.Delete...)
+		return result, nil
+	}
+	for _, identifier := range plan.diff.Delete {
+		if err := deleteEndpoint(ctx, shards, identifier); err != nil {
+			return result, err
+		}
+		result.Deleted = append(result.Deleted, identifier)
+	}
+	return result, nil
+}
+
+// storePlanned stores the desired endpoint with identifier of the plan.
+func storePlanned(ctx context.Context, shards *meow.Shards, plan *configPlan, identifier string) error {
+	key := meow.EndpointKey(identifier)
+	fields := endpointHashFields(plan.desired[identifier])
+	if err := storeEndpoint(ctx, shards.For(identifier), key, fields, plan.existing[identifier]); err != nil {
+		return fmt.Errorf("store endpoint %s: %v", identifier, err)
+	}
+	return nil
+}
+
+// deleteEndpoint deletes the endpoint with identifier along with its state,
+// history, including the compacted one, and latencies, which share its hash
+// tag.
+func deleteEndpoint(ctx context.Context, shards *meow.Shards, identifier string) error {
+	vk := shards.For(identifier)
+	keys := []string{meow.EndpointKey(identifier), meow.StateKey(identifier), meow.HistoryKey(identifier),
+		meow.HourlyHistoryKey(identifier), meow.LatencyKey(identifier)}
+	if err := vk.Do(ctx, vk.B().Del().Key(keys...).Build()).Error(); err != nil {
+		return fmt.Errorf("del %v: %v", keys, err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDesiredConfigFromRequestRejectsDependencyCycles(t *testing.T) {
+	endpoint := func(identifier, dependsOn string) string {
+		return `{"identifier":"` + identifier + `","url":"https://` + identifier + `.example.com/","method":"GET","status_online":200,"frequency":"1m","fail_after":1,"depends_on":` + dependsOn + `}`
+	}
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"acyclic", "[" + endpoint("alpha", `["beta"]`) + "," + endpoint("beta", `["gamma"]`) + "," + endpoint("gamma", "[]") + "]", 0},
+		{"cycle", "[" + endpoint("alpha", `["beta"]`) + "," + endpoint("beta", `["gamma"]`) + "," + endpoint("gamma", `["alpha"]`) + "]", http.StatusUnprocessableEntity},
+		{"cycle off the first endpoint", "[" + endpoint("alpha", `["beta"]`) + "," + endpoint("beta", `["gamma"]`) + "," + endpoint("gamma", `["beta"]`) + "]", http.StatusUnprocessableEntity},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/apply", strings.NewReader(test.body))
+			_, status, err := desiredConfigFromRequest(r)
+			if status != test.status {
+				t.Fatalf("got status %d (%v), want %d", status, err, test.status)
+			}
+			if test.status != 0 && !strings.Contains(err.Error(), "form a cycle") {
+				t.Errorf("got error %v, want a cycle", err)
+			}
+		})
+	}
+}
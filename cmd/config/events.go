@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/patrickbucher/meow"
+	"github.com/valkey-io/valkey-go"
+)
+
+// event is a state change or latency update as JSON data, whose name is state
+// or latency, respectively.
+type event struct {
+	name string
+	data string
+}
+
+// eventNames are the names of the events published on the Valkey channels.
+var eventNames = map[string]string{
+	meow.StateChannel:   "state",
+	meow.LatencyChannel: "latency",
+}
+
+// broker fans out the state changes and latency updates published by the probe
+// to the clients connected to the config server.
+type broker struct {
+	mu      sync.Mutex
+	clients map[chan event]struct{}
+	closed  bool
+}
+
+func newBroker() *broker {
+	return &broker{clients: make(map[chan event]struct{})}
+}
+
+// run subscribes to the state changes and latency updates published on Valkey
+// and forwards them to the clients until ctx is done, resubscribing after
+// connection errors.
+func (b *broker) run(ctx context.Context, vk valkey.Client) {
+	subscribe := vk.B().Subscribe().Channel(meow.StateChannel, meow.LatencyChannel).Build()
+	for {
+		err := vk.Receive(ctx, subscribe, func(msg valkey.PubSubMessage) {
+			b.publish(event{name: eventNames[msg.Channel], data: msg.Message})
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Error("receive events, resubscribing", "err", err)
+		time.Sleep(time.Second)
+	}
+}
+
+// subscribe registers a client, whose channel receives the events published
+// from now on, and is closed when the broker is closed.
+func (b *broker) subscribe() chan event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	messages := make(chan event, 16)
+	if b.closed {
+		close(messages)
+		return messages
+	}
+	b.clients[messages] = struct{}{}
+	return messages
+}
+
+// unsubscribe removes the client with the given channel.
+func (b *broker) unsubscribe(messages chan event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.clients[messages]; ok {
+		delete(b.clients, messages)
+		close(messages)
+	}
+}
+
+// publish sends the event to all clients. Clients lagging behind miss the
+// event rather than blocking the others.
+func (b *broker) publish(e event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for messages := range b.clients {
+		select {
+		case messages <- e:
+		default:
+		}
+	}
+}
+
+// close disconnects all clients, which is required to shut down the server.
+func (b *broker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for messages := range b.clients {
+		delete(b.clients, messages)
+		close(messages)
+	}
+}
+
+func getEvents(events *broker, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	// the stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Error("clear write deadline", "remote", r.RemoteAddr, "err", err)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		slog.Warn("flush event stream", "remote", r.RemoteAddr, "err", err)
+		return
+	}
+
+	messages := events.subscribe()
+	defer events.unsubscribe(messages)
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			slog.Debug("event stream closed by client", "remote", r.RemoteAddr)
+			return
+		case e, ok := <-messages:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.name, e.data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			slog.Warn("flush event stream", "remote", r.RemoteAddr, "err", err)
+			return
+		}
+	}
+}
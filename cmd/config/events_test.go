@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/patrickbucher/meow"
+	"github.com/valkey-io/valkey-go"
+)
+
+func TestBrokerForwardsStateChangesAndLatencies(t *testing.T) {
+	shards, server := newTestShards(t, 1)
+	events := newBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go events.run(ctx, shards.All()[0])
+	messages := events.subscribe()
+	defer events.unsubscribe(messages)
+
+	// miniredis rejects commands on a connection receiving messages, which
+	// Valkey allows using RESP3
+	publisher, err := valkey.NewClient(valkey.ClientOption{InitAddress: []string{server.Addr()}, DisableCache: true})
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	defer publisher.Close()
+	update := meow.LatencyUpdate{Identifier: "libvirt", LatencyMS: 42, At: time.Date(2025, 11, 20, 17, 3, 12, 0, time.UTC)}
+	change := `{"identifier":"libvirt","state":"down","previous":"up","at":"2025-11-20T17:03:12Z"}`
+	want := []event{
+		{name: "latency", data: `{"identifier":"libvirt","latency_ms":42,"at":"2025-11-20T17:03:12Z"}`},
+		{name: "state", data: change},
+	}
+	// the subscription is established asynchronously
+	deadline := time.After(2 * time.Second)
+	for {
+		if err := meow.PublishLatency(ctx, publisher, update); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case e := <-messages:
+			if e != want[0] {
+				t.Fatalf("got event %+v, want %+v", e, want[0])
+			}
+		case <-time.After(50 * time.Millisecond):
+			continue
+		case <-deadline:
+			t.Fatal("no latency update received")
+		}
+		break
+	}
+	server.Publish(meow.StateChannel, change)
+	for {
+		select {
+		case e := <-messages:
+			if e == want[0] {
+				// published again while waiting for the subscription
+				continue
+			}
+			if e != want[1] {
+				t.Errorf("got event %+v, want %+v", e, want[1])
+			}
+		case <-deadline:
+			t.Error("no state change received")
+		}
+		return
+	}
+}
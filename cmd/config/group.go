@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/patrickbucher/meow"
+)
+
+// groupStatus is the state of a group derived from the states of its members.
+type groupStatus struct {
+	Identifier string            `json:"identifier"`
+	Policy     string            `json:"policy"`
+	State      string            `json:"state"`
+	Members    map[string]string `json:"members"`
+}
+
+func getGroups(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	keys, err := shards.Keys(ctx, "groups:*")
+	if err != nil {
+		slog.Error("list groups", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	identifiers := make([]string, 0, len(keys))
+	for _, key := range keys {
+		identifiers = append(identifiers, meow.KeyIdentifier(key))
+	}
+	slices.Sort(identifiers)
+	groups := make([]meow.Group, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		group, err := fetchGroup(ctx, shards, identifier)
+		if err != nil {
+			slog.Error("fetch group", "identifier", identifier, "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if group != nil {
+			groups = append(groups, *group)
+		}
+	}
+	data, err := marshalJSON(groups, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal groups", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func getGroup(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	identifier := r.PathValue("id")
+	group, err := fetchGroup(ctx, shards, identifier)
+	if err != nil {
+		slog.Error("fetch group", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if group == nil {
+		slog.Warn("no such group", "identifier", identifier)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	data, err := marshalJSON(group, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal group", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// putGroup creates or replaces a group, whose members must be stored
+// endpoints.
+func putGroup(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	var group meow.Group
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+		slog.Warn("parse JSON body", "err", err)
+		describeProblem(r, fmt.Errorf("parse JSON body: %v", err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if group.Identifier != r.PathValue("id") {
+		slog.Warn("identifier mismatch", "resource", r.PathValue("id"), "body", group.Identifier)
+		describeProblem(r, fmt.Errorf("identifier mismatch: (resource: %s, body: %s)", r.PathValue("id"), group.Identifier))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := group.Validate(); err != nil {
+		slog.Warn("group rejected", "identifier", group.Identifier, "err", err)
+		describeProblem(r, err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	for _, member := range group.Members {
+		vk := shards.For(member)
+		exists, err := vk.Do(ctx, vk.B().Exists().Key(meow.EndpointKey(member)).Build()).AsInt64()
+		if err != nil {
+			slog.Error("exists", "key", meow.EndpointKey(member), "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if exists == 0 {
+			slog.Warn("group rejected: no such member", "identifier", group.Identifier, "member", member)
+			describeProblem(r, &meow.ValidationError{
+				Field:   "members",
+				Message: fmt.Sprintf(`member "%s" does not exist`, member),
+			})
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	key := meow.GroupKey(group.Identifier)
+	vk := shards.For(group.Identifier)
+	builder := vk.B().Hset().Key(key).FieldValue().
+		FieldValue("identifier", group.Identifier).
+		FieldValue("members", strings.Join(group.Members, ",")).
+		FieldValue("policy", group.Policy)
+	if group.Quorum > 0 {
+		builder = builder.FieldValue("quorum", strconv.Itoa(group.Quorum))
+	}
+	results := vk.DoMulti(ctx,
+		vk.B().Multi().Build(),
+		vk.B().Del().Key(key).Build(),
+		builder.Build(),
+		vk.B().Exec().Build())
+	replies, err := results[len(results)-1].ToArray()
+	if err != nil {
+		slog.Error("replace", "key", key, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	deleted, err := replies[0].AsInt64()
+	if err != nil {
+		slog.Error("del", "key", key, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if deleted > 0 {
+		w.WriteHeader(http.StatusOK) // replaced
+	} else {
+		w.WriteHeader(http.StatusCreated) // created
+	}
+}
+
+func deleteGroup(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	identifier := r.PathValue("id")
+	key := meow.GroupKey(identifier)
+	vk := shards.For(identifier)
+	deleted, err := vk.Do(ctx, vk.B().Del().Key(key).Build()).AsInt64()
+	if err != nil {
+		slog.Error("del", "key", key, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if deleted == 0 {
+		slog.Warn("no such group", "identifier", identifier)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getGroupStatus derives the state of a group from the states of its members
+// as last recorded by the probe. Members deleted in the meantime are unknown.
+func getGroupStatus(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	identifier := r.PathValue("id")
+	group, err := fetchGroup(ctx, shards, identifier)
+	if err != nil {
+		slog.Error("fetch group", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if group == nil {
+		slog.Warn("no such group", "identifier", identifier)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	states, err := fetchStates(ctx, shards, group.Members)
+	if err != nil {
+		slog.Error("fetch states", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	status := groupStatus{
+		Identifier: group.Identifier,
+		Policy:     group.Policy,
+		State:      group.State(states),
+		Members:    states,
+	}
+	data, err := marshalJSON(status, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal group status", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// fetchGroup reads the group with identifier, or returns nil if there is no
+// such group.
+func fetchGroup(ctx context.Context, shards *meow.Shards, identifier string) (*meow.Group, error) {
+	key := meow.GroupKey(identifier)
+	vk := shards.For(identifier)
+	kvs, err := vk.Do(ctx, vk.B().Hgetall().Key(key).Build()).AsStrMap()
+	if err != nil {
+		return nil, fmt.Errorf("hgetall %s: %v", key, err)
+	}
+	if len(kvs) == 0 {
+		return nil, nil
+	}
+	group := meow.Group{Identifier: kvs["identifier"], Policy: kvs["policy"]}
+	if members := kvs["members"]; members != "" {
+		group.Members = strings.Split(members, ",")
+	}
+	if quorum := kvs["quorum"]; quorum != "" {
+		if group.Quorum, err = strconv.Atoi(quorum); err != nil {
+			return nil, fmt.Errorf("quorum of %s not a number: %q: %v", key, quorum, err)
+		}
+	}
+	return &group, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/patrickbucher/meow"
+	"github.com/valkey-io/valkey-go"
+)
+
+// maxIdempotencyKeyLength limits the length of Idempotency-Key headers.
+const maxIdempotencyKeyLength = 255
+
+// idempotency stores the responses to requests carrying an Idempotency-Key
+// header in Valkey for ttl, so that a client retrying a request, e.g. after a
+// network error, gets the same response without the request being processed
+// again. The keys are scoped per endpoint.
+type idempotency struct {
+	shards *meow.Shards
+	ttl    time.Duration
+}
+
+// storedResponse is a response stored for an Idempotency-Key, whose status is
+// 0 while the request is still being processed. The fingerprint is the digest
+// of the request body, which must not differ for the same key.
+type storedResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// wrap makes the handler of requests concerning a single endpoint idempotent
+// for requests carrying an Idempotency-Key header. A ttl that is not positive
+// disables idempotency.
+func (i *idempotency) wrap(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestKey := r.Header.Get("Idempotency-Key")
+		if requestKey == "" || i.ttl <= 0 {
+			handler(w, r)
+			return
+		}
+		if len(requestKey) > maxIdempotencyKeyLength || strings.ContainsFunc(requestKey, unicode.IsControl) {
+			slog.Warn("request rejected: invalid Idempotency-Key", "remote", r.RemoteAddr, "url", r.URL)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		identifier := r.PathValue("id")
+		if identifier == "" {
+			var err error
+			if identifier, err = extractEndpointIdentifier(r.URL.Path); err != nil {
+				handler(w, r)
+				return
+			}
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			slog.Warn("request rejected: read body", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		digest := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(digest[:])
+
+		ctx := requestContext(r)
+		key := meow.IdempotencyKey(identifier, requestKey)
+		vk := i.shards.For(identifier)
+		pending, _ := json.Marshal(storedResponse{Fingerprint: fingerprint})
+		cmd := vk.B().Set().Key(key).Value(string(pending)).Nx().Px(i.ttl).Build()
+		if err := vk.Do(ctx, cmd).Error(); valkey.IsValkeyNil(err) {
+			i.replay(vk, key, fingerprint, w, r)
+			return
+		} else if err != nil {
+			slog.Error("set", "key", key, "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		buf := newResponseBuffer()
+		handler(buf, r)
+		if buf.status >= 500 {
+			// let the client retry requests that failed on our side
+			if err := vk.Do(ctx, vk.B().Del().Key(key).Build()).Error(); err != nil {
+				slog.Error("del", "key", key, "err", err)
+			}
+		} else {
+			stored, _ := json.Marshal(storedResponse{
+				Status:      buf.status,
+				ContentType: buf.Header().Get("Content-Type"),
+				Body:        buf.Bytes(),
+				Fingerprint: fingerprint,
+			})
+			cmd := vk.B().Set().Key(key).Value(string(stored)).Xx().Px(i.ttl).Build()
+			if err := vk.Do(ctx, cmd).Error(); err != nil && !valkey.IsValkeyNil(err) {
+				slog.Error("set", "key", key, "err", err)
+			}
+		}
+		for name, values := range buf.Header() {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(buf.status)
+		w.Write(buf.Bytes())
+	}
+}
+
+// replay responds with the response stored under key. A request with another
+// body than the original one is unprocessable, and a request whose original
+// one is still being processed conflicts with it.
+func (i *idempotency) replay(vk valkey.Client, key, fingerprint string, w http.ResponseWriter, r *http.Request) {
+	data, err := vk.Do(requestContext(r), vk.B().Get().Key(key).Build()).AsBytes()
+	if valkey.IsValkeyNil(err) {
+		// expired in the meantime
+		slog.Warn("request rejected: Idempotency-Key expired", "key", key)
+		w.WriteHeader(http.StatusConflict)
+		return
+	} else if err != nil {
+		slog.Error("get", "key", key, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var stored storedResponse
+	if err := json.Unmarshal(data, &stored); err != nil {
+		slog.Error("unmarshal stored response", "key", key, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if stored.Fingerprint != fingerprint {
+		slog.Warn("request rejected: Idempotency-Key reused for another request", "key", key)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	if stored.Status == 0 {
+		slog.Warn("request rejected: request with same Idempotency-Key in progress", "key", key)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	slog.Debug("replay response", "key", key, "status", stored.Status)
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.Status)
+	w.Write(stored.Body)
+}
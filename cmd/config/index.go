@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// apiVersion is the version of the HTTP API offered by the config server.
+const apiVersion = "1"
+
+// routes lists the routes of the HTTP API, which must be kept in sync with the
+// handlers registered by api.register; a test checks that each is registered.
+var routes = []string{
+	"GET /",
+	"GET /healthz",
+	"GET /readyz",
+	"GET /endpoints",
+	"GET /endpoints/ids",
+	"GET /endpoints/{id}",
+	"POST /endpoints/{id}",
+	"PUT /endpoints/{id}",
+	"POST /endpoints/{id}/clone",
+	"POST /endpoints/{id}/cas",
+	"GET /endpoints/{id}/config.curl",
+	"GET /endpoints/{id}/raw",
+	"GET /endpoints/{id}/status",
+	"GET /endpoints/{id}/history",
+	"DELETE /endpoints/{id}/history",
+	"GET /endpoints/{id}/history/hourly",
+	"GET /endpoints/{id}/latency",
+	"POST /endpoints/{id}/reset",
+	"POST /endpoints/{id}/test-alert",
+	"POST /reset",
+	"GET /groups",
+	"GET /groups/{id}",
+	"PUT /groups/{id}",
+	"DELETE /groups/{id}",
+	"GET /groups/{id}/status",
+	"GET /summary",
+	"GET /defaults",
+	"GET /alerts/failed",
+	"POST /diff",
+	"POST /apply",
+	"GET /snapshots",
+	"POST /snapshots/{version}/restore",
+	"GET /validate",
+	"GET /logs",
+	"GET /events",
+	"GET /ws",
+}
+
+// index describes the HTTP API for clients discovering it.
+type index struct {
+	Version string   `json:"version"`
+	Routes  []string `json:"routes"`
+}
+
+func getIndex(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	data, err := marshalJSON(index{apiVersion, routes}, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal index", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
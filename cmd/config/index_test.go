@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/patrickbucher/meow"
+)
+
+func TestRoutesAreRegistered(t *testing.T) {
+	shards, _ := newTestShards(t, 1)
+	var ready atomic.Bool
+	handlers := &api{
+		shards:         shards,
+		notFoundStatus: http.StatusNotFound,
+		alerter:        &meow.Alerter{Client: http.DefaultClient},
+		listings:       newListingCache(0),
+		idempotent:     &idempotency{shards: shards, ttl: time.Hour},
+		events:         newBroker(),
+		ready:          &ready,
+	}
+	// the handlers can only be registered once on http.DefaultServeMux
+	handlers.register()
+
+	replacer := strings.NewReplacer("{id}", "libvirt", "{version}", "1")
+	for _, route := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		r := httptest.NewRequest(method, replacer.Replace(path), nil)
+		if _, pattern := http.DefaultServeMux.Handler(r); pattern == "" {
+			t.Errorf("route %s is not registered", route)
+		}
+	}
+}
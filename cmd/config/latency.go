@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/patrickbucher/meow"
+)
+
+// defaultLatencyWindow is the window of checks whose latencies are reported if
+// the request does not give one.
+const defaultLatencyWindow = time.Hour
+
+// latencyReport describes the distribution of the latencies of the checks of an
+// endpoint within a window. The percentiles are 0 without samples.
+type latencyReport struct {
+	Window  string `json:"window"`
+	Samples int    `json:"samples"`
+	P50     int64  `json:"p50_ms"`
+	P95     int64  `json:"p95_ms"`
+	P99     int64  `json:"p99_ms"`
+}
+
+// getEndpointLatency reports the percentiles of the latencies of the checks of
+// an endpoint within the window given as query parameter, which is at most
+// meow.LatencyRetention.
+func getEndpointLatency(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	window := defaultLatencyWindow
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		var err error
+		window, err = time.ParseDuration(raw)
+		if err != nil || window <= 0 || window > meow.LatencyRetention {
+			slog.Warn("request rejected: invalid window", "window", raw)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	identifier := r.PathValue("id")
+	vk := shards.For(identifier)
+	exists, err := vk.Do(ctx, vk.B().Exists().Key(meow.EndpointKey(identifier)).Build()).AsInt64()
+	if err != nil {
+		slog.Error("exists", "key", meow.EndpointKey(identifier), "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if exists == 0 {
+		slog.Warn("no such endpoint", "identifier", identifier)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	latencies, err := meow.Latencies(ctx, vk, identifier, time.Now().Add(-window))
+	if err != nil {
+		slog.Error("get latencies", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	slices.Sort(latencies)
+	report := latencyReport{
+		Window:  window.String(),
+		Samples: len(latencies),
+		P50:     percentile(latencies, 50),
+		P95:     percentile(latencies, 95),
+		P99:     percentile(latencies, 99),
+	}
+	data, err := marshalJSON(report, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal latency report", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// percentile returns the p-th percentile of the sorted values using the
+// nearest-rank method, or 0 if there are no values.
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
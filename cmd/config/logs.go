@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// logRing keeps the last log lines written to it, dropping the oldest ones
+// once it is full. It is safe for concurrent use.
+type logRing struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+// newLogRing creates a ring keeping the last size lines.
+func newLogRing(size int) *logRing {
+	return &logRing{lines: make([]string, size)}
+}
+
+// Write adds the lines written, as done by slog.TextHandler once per record.
+func (l *logRing) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for line := range bytes.Lines(p) {
+		l.lines[l.next] = string(line)
+		l.next = (l.next + 1) % len(l.lines)
+		if l.next == 0 {
+			l.full = true
+		}
+	}
+	return len(p), nil
+}
+
+// last returns up to n of the most recent lines, oldest first.
+func (l *logRing) last(n int) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	count := l.next
+	if l.full {
+		count = len(l.lines)
+	}
+	n = min(n, count)
+	lines := make([]string, 0, n)
+	for i := l.next - n; i < l.next; i++ {
+		lines = append(lines, l.lines[(i+len(l.lines))%len(l.lines)])
+	}
+	return lines
+}
+
+// ringHandler passes log records on to the next handler and additionally
+// records them as text in a ring.
+type ringHandler struct {
+	next slog.Handler
+	ring slog.Handler
+}
+
+// newRingHandler creates a handler passing records to next, which also writes
+// the records to ring formatted according to options.
+func newRingHandler(next slog.Handler, ring *logRing, options *slog.HandlerOptions) *ringHandler {
+	return &ringHandler{next: next, ring: slog.NewTextHandler(ring, options)}
+}
+
+func (h *ringHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level) || h.ring.Enabled(ctx, level)
+}
+
+func (h *ringHandler) Handle(ctx context.Context, record slog.Record) error {
+	var err error
+	if h.next.Enabled(ctx, record.Level) {
+		err = h.next.Handle(ctx, record.Clone())
+	}
+	if h.ring.Enabled(ctx, record.Level) {
+		h.ring.Handle(ctx, record)
+	}
+	return err
+}
+
+func (h *ringHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ringHandler{next: h.next.WithAttrs(attrs), ring: h.ring.WithAttrs(attrs)}
+}
+
+func (h *ringHandler) WithGroup(name string) slog.Handler {
+	return &ringHandler{next: h.next.WithGroup(name), ring: h.ring.WithGroup(name)}
+}
+
+// defaultLogLines is the number of lines returned by getLogs by default.
+const defaultLogLines = 100
+
+// getLogs responds with the last n log lines as plain text, where n is given as
+// query parameter, or defaults to defaultLogLines.
+func getLogs(ring *logRing, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	if ring == nil {
+		slog.Warn("request rejected: log buffer disabled")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	n := defaultLogLines
+	if raw := r.URL.Query().Get("n"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			slog.Warn("request rejected: invalid number of lines", "n", raw)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n = parsed
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, line := range ring.last(n) {
+		w.Write([]byte(line))
+	}
+}
@@ -3,17 +3,28 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
+	"iter"
+	"log/slog"
+	"maps"
+	"mime"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/patrickbucher/meow"
 	"github.com/valkey-io/valkey-go"
@@ -22,125 +33,453 @@ import (
 func main() {
 	addrFlag := flag.String("addr", "0.0.0.0", "listen to address")
 	port := flag.Uint("port", 8000, "listen on port")
+	readHeaderTimeout := flag.Duration("read-header-timeout", 5*time.Second, "timeout for reading request headers")
+	readTimeout := flag.Duration("read-timeout", 10*time.Second, "timeout for reading the entire request")
+	writeTimeout := flag.Duration("write-timeout", 10*time.Second, "timeout for writing the response")
+	idleTimeout := flag.Duration("idle-timeout", 60*time.Second, "timeout for idle keep-alive connections")
+	socket := flag.String("socket", "", "listen on unix domain socket (instead of -addr and -port)")
+	rebalance := flag.Bool("rebalance", false, "move endpoints to their shards on startup")
+	createOnly := flag.Bool("create-only", false, "reject POST of existing endpoints with 409 (use PUT to update)")
+	maxEndpoints := flag.Int("max-endpoints", 0, "maximum number of endpoints to be stored (0: unlimited)")
+	listCacheTTL := flag.Duration("list-cache-ttl", 2*time.Second, "how long to cache the listing of all endpoints (0: disabled)")
+	flag.DurationVar(&meow.DefaultFrequency, "default-frequency", meow.DefaultFrequency, "frequency of endpoints posted without one")
+	flag.DurationVar(&meow.DefaultAlertCooldown, "default-alert-cooldown", meow.DefaultAlertCooldown, "alert cooldown of endpoints posted without one")
+	flag.DurationVar(&meow.DefaultTimeout, "default-timeout", 0, "timeout of endpoints posted without one (0: the probe's timeout)")
+	defaultRetries := flag.Uint("default-retries", 0, "retries of endpoints posted without them (0: the probe's retries)")
+	flag.DurationVar(&meow.ProbeTimeout, "probe-timeout", meow.ProbeTimeout, "timeout of the probe's requests, which the frequency of endpoints must not be shorter than")
+	tracing := flag.Bool("tracing", false, "export traces using OTLP as configured by the OTEL_* environment variables")
+	idempotencyTTL := flag.Duration("idempotency-ttl", time.Hour, "how long to keep responses to requests with an Idempotency-Key header (0: disabled)")
+	historyRetention := flag.Duration("history-retention", 0, "age of failed checks compacted into hourly aggregates (0: disabled)")
+	hourlyRetention := flag.Duration("hourly-retention", 90*24*time.Hour, "age of hourly aggregates of failed checks deleted (0: kept forever)")
+	snapshotInterval := flag.Duration("snapshot-interval", time.Hour, "interval of taking snapshots of the endpoints, if they changed")
+	snapshots := flag.Int("snapshots", 24, "number of snapshots of the endpoints kept (0: disabled)")
+	logBuffer := flag.Int("log-buffer", 1000, "number of recent log lines kept for GET /logs (0: disabled)")
+	notFoundStatus := flag.Int("not-found-status", http.StatusNotFound, "status of the response to GET /endpoints/{id} for unknown endpoints, whose body is empty")
+	logLevel := slog.LevelError
+	flag.TextVar(&logLevel, "log-level", logLevel, "minimum level of log messages (debug, info, warn, error)")
 	flag.Parse()
 
-	log.SetOutput(os.Stderr)
+	options := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, options)
+	var logs *logRing
+	if *logBuffer > 0 {
+		logs = newLogRing(*logBuffer)
+		handler = newRingHandler(handler, logs, options)
+	}
+	slog.SetDefault(slog.New(handler))
+
+	if *socket != "" {
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "addr" || f.Name == "port" {
+				fatal("flag -socket cannot be combined with -" + f.Name)
+			}
+		})
+	}
+
+	if *notFoundStatus < 200 || *notFoundStatus > 599 {
+		fatal("flag -not-found-status must be a status from 200 to 599", "status", *notFoundStatus)
+	}
+
+	if meow.DefaultTimeout < 0 || meow.DefaultTimeout > meow.ProbeTimeout {
+		fatal("flag -default-timeout must not exceed -probe-timeout", "timeout", meow.DefaultTimeout)
+	}
+	if *defaultRetries > meow.MaxRetries {
+		fatal("flag -default-retries exceeds the maximum", "retries", *defaultRetries, "max", meow.MaxRetries)
+	}
+	meow.DefaultRetries = uint8(*defaultRetries)
 
-	rawValkeyURL, ok := os.LookupEnv("VALKEY_URL")
-	if !ok || strings.TrimSpace(rawValkeyURL) == "" {
-		log.Fatalf("environment variable VALKEY_URL must be set (example: valkey.frickelcloud.ch:6379/4)")
+	if err := checkSchema(); err != nil {
+		fatal("check schema of endpoint hashes", "err", err)
 	}
 
-	valkeyAddr, valkeyDB, err := parseValkeyURL(rawValkeyURL)
+	shards, err := meow.ShardsFromEnv()
 	if err != nil {
-		log.Fatalf("parse VALKEY_URL %q: %v", rawValkeyURL, err)
+		fatal("connect to valkey", "err", err)
 	}
 
 	ctx := context.Background()
 
-	options := valkey.ClientOption{
-		InitAddress: []string{valkeyAddr},
-		SelectDB:    valkeyDB,
+	shutdownTracing := func(context.Context) error { return nil }
+	if *tracing {
+		if shutdownTracing, err = setupTracing(ctx); err != nil {
+			fatal("set up tracing", "err", err)
+		}
+		shards.Wrap(newTracedClient)
+	}
+
+	legacy, err := meow.LegacyKeys(ctx, shards)
+	if err != nil {
+		fatal("get legacy keys", "err", err)
+	}
+	if len(legacy) > 0 {
+		fatal("keys stored without hash tag must be renamed using cmd/migrate", "keys", legacy)
+	}
+
+	// before serving any request, which could miss keys being moved
+	if *rebalance {
+		conflicts := 0
+		for _, prefix := range []string{"endpoints:", "state:", "history:", "hourly:", "latency:", "groups:"} {
+			moved, conflicting, err := shards.Rebalance(ctx, prefix)
+			if err != nil {
+				fatal("rebalance shards", "err", err)
+			}
+			for _, key := range conflicting {
+				slog.Error("key exists in its shard already, not moved", "key", key)
+			}
+			conflicts += len(conflicting)
+			slog.Info("rebalanced shards", "moved", moved, "prefix", prefix)
+		}
+		if conflicts > 0 {
+			fatal("rebalance shards: resolve the conflicting keys, then rebalance again", "conflicts", conflicts)
+		}
+	}
+
+	apiKey := os.Getenv("API_KEY")
+	adminToken := os.Getenv("ADMIN_TOKEN")
+
+	smtpServer, err := meow.SMTPServerFromEnv()
+	if err != nil {
+		fatal("configure SMTP server", "err", err)
+	}
+	alerter := &meow.Alerter{Client: &http.Client{Timeout: 10 * time.Second}, SMTP: smtpServer}
+
+	listings := newListingCache(*listCacheTTL)
+	idempotent := &idempotency{shards: shards, ttl: *idempotencyTTL}
+
+	if *historyRetention > 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "unknown"
+		}
+		owner := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+		go compactHistories(ctx, shards, owner, *historyRetention, *hourlyRetention)
+	}
+	if *snapshots > 0 {
+		go snapshotConfig(ctx, shards, *snapshotInterval, *snapshots)
+	}
+
+	events := newBroker()
+	go events.run(ctx, shards.All()[0])
+
+	// ready is set once the connectivity check succeeded
+	var ready atomic.Bool
+	go func() {
+		// quick connectivity check
+		for _, vk := range shards.All() {
+			if err := vk.Do(ctx, vk.B().Set().Key("purpose").Value("meow").Build()).Error(); err != nil {
+				fatal("valkey SET purpose=meow failed", "err", err)
+			}
+		}
+		ready.Store(true)
+	}()
+
+	handlers := &api{
+		shards:         shards,
+		notFoundStatus: *notFoundStatus,
+		createOnly:     *createOnly,
+		maxEndpoints:   *maxEndpoints,
+		snapshots:      *snapshots,
+		apiKey:         apiKey,
+		adminToken:     adminToken,
+		alerter:        alerter,
+		listings:       listings,
+		idempotent:     idempotent,
+		logs:           logs,
+		events:         events,
+		ready:          &ready,
+	}
+	handlers.register()
+
+	listenTo := fmt.Sprintf("%s:%d", *addrFlag, *port)
+	if *socket != "" {
+		listenTo = *socket
 	}
-	vk, err := valkey.NewClient(options)
+	listener, err := listen(*socket, listenTo)
 	if err != nil {
-		log.Fatalf("connect to valkey at %s (db %d): %v", valkeyAddr, valkeyDB, err)
+		fatal("listen", "addr", listenTo, "err", err)
 	}
+	server := &http.Server{
+		ReadHeaderTimeout: *readHeaderTimeout,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+	}
+	var serverHandler http.Handler = http.DefaultServeMux
+	if *tracing {
+		serverHandler = traceRequests(http.DefaultServeMux)
+	}
+	server.Handler = problemDetails(serverHandler)
+	server.RegisterOnShutdown(events.close)
+	shutdown := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		s := <-signals
+		slog.Info("signal received, shutting down", "signal", s)
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Error("shut down server", "err", err)
+		}
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("shut down tracing", "err", err)
+		}
+		close(shutdown)
+	}()
 
-	// quick connectivity check
-	if err := vk.Do(ctx, vk.B().Set().Key("purpose").Value("meow").Build()).Error(); err != nil {
-		log.Fatalf("valkey SET purpose=meow failed: %v", err)
+	slog.Info("listen", "addr", listenTo, "valkey", shards)
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal("serve", "addr", listenTo, "err", err)
 	}
+	<-shutdown
+	if *socket != "" {
+		if err := os.Remove(*socket); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("remove socket", "path", *socket, "err", err)
+		}
+	}
+}
+
+// api holds what the handlers of the HTTP API depend on.
+type api struct {
+	shards         *meow.Shards
+	notFoundStatus int
+	createOnly     bool
+	maxEndpoints   int
+	snapshots      int
+	apiKey         string
+	adminToken     string
+	alerter        *meow.Alerter
+	listings       *listingCache
+	idempotent     *idempotency
+	logs           *logRing
+	events         *broker
+	ready          *atomic.Bool
+}
+
+// register registers the handlers of the routes listed in routes on
+// http.DefaultServeMux.
+func (a *api) register() {
+	http.HandleFunc("GET /{$}", getIndex)
+
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK\n"))
+	})
+
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !a.ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("OK\n"))
+	})
 
 	http.HandleFunc("/endpoints/", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			getEndpoint(ctx, vk, w, r)
+			getEndpoint(requestContext(r), a.shards, a.notFoundStatus, w, r)
 		case http.MethodPost:
-			postEndpoint(ctx, vk, w, r)
+			a.idempotent.wrap(func(w http.ResponseWriter, r *http.Request) {
+				postEndpoint(requestContext(r), a.shards, a.createOnly, a.maxEndpoints, w, r)
+			})(w, r)
+			a.listings.invalidate()
+		case http.MethodPut:
+			putEndpoint(requestContext(r), a.shards, a.maxEndpoints, w, r)
+			a.listings.invalidate()
 		// TODO: support http.MethodDelete to delete endpoints (optional task)
 		default:
-			log.Printf("request from %s rejected: method %s not allowed",
-				r.RemoteAddr, r.Method)
+			slog.Warn("request rejected: method not allowed",
+				"remote", r.RemoteAddr, "method", r.Method)
 			w.WriteHeader(http.StatusMethodNotAllowed)
 		}
 	})
 
-	http.HandleFunc("/endpoints", func(w http.ResponseWriter, r *http.Request) {
-		getEndpoints(ctx, vk, w, r)
+	http.HandleFunc("POST /endpoints/{id}/clone", a.listings.invalidating(a.idempotent.wrap(func(w http.ResponseWriter, r *http.Request) {
+		cloneEndpoint(requestContext(r), a.shards, a.maxEndpoints, w, r)
+	})))
+
+	http.HandleFunc("POST /endpoints/{id}/cas", a.listings.invalidating(func(w http.ResponseWriter, r *http.Request) {
+		postEndpointCAS(requestContext(r), a.shards, w, r)
+	}))
+
+	http.HandleFunc("GET /endpoints/{id}/config.curl", func(w http.ResponseWriter, r *http.Request) {
+		getEndpointCurl(requestContext(r), a.shards, w, r)
 	})
 
-	listenTo := fmt.Sprintf("%s:%d", *addrFlag, *port)
-	log.Printf("listen to %s (valkey=%s db=%d)", listenTo, valkeyAddr, valkeyDB)
-	http.ListenAndServe(listenTo, nil)
-}
+	http.HandleFunc("GET /endpoints/ids", func(w http.ResponseWriter, r *http.Request) {
+		getEndpointIDs(requestContext(r), a.shards, w, r)
+	})
 
-func parseValkeyURL(raw string) (addr string, db int, err error) {
-	raw = strings.TrimSpace(raw)
+	http.HandleFunc("GET /endpoints/{id}/raw", requireAPIKey(a.apiKey, a.adminToken, func(w http.ResponseWriter, r *http.Request) {
+		getEndpointRaw(requestContext(r), a.shards, w, r)
+	}))
 
-	// Strip scheme if present
-	raw = strings.TrimPrefix(raw, "redis://")
-	raw = strings.TrimPrefix(raw, "valkey://")
+	http.HandleFunc("GET /logs", requireAPIKey(a.apiKey, a.adminToken, func(w http.ResponseWriter, r *http.Request) {
+		getLogs(a.logs, w, r)
+	}))
 
-	db = 0
+	http.HandleFunc("GET /validate", func(w http.ResponseWriter, r *http.Request) {
+		getValidation(requestContext(r), a.shards, w, r)
+	})
 
-	// Extract db from trailing /<number>
-	if i := strings.LastIndex(raw, "/"); i >= 0 {
-		dbStr := raw[i+1:]
-		raw = raw[:i]
-		if dbStr != "" {
-			db, err = strconv.Atoi(dbStr)
-			if err != nil {
-				return "", 0, fmt.Errorf("invalid DB number in VALKEY_URL: %v", err)
-			}
+	http.HandleFunc("GET /endpoints/{id}/status", func(w http.ResponseWriter, r *http.Request) {
+		getEndpointStatus(requestContext(r), a.shards, w, r)
+	})
+
+	http.HandleFunc("GET /endpoints/{id}/history", func(w http.ResponseWriter, r *http.Request) {
+		getEndpointHistory(requestContext(r), a.shards, w, r)
+	})
+
+	http.HandleFunc("DELETE /endpoints/{id}/history", requireAdminToken(a.adminToken, a.apiKey, func(w http.ResponseWriter, r *http.Request) {
+		deleteEndpointHistory(requestContext(r), a.shards, w, r)
+	}))
+
+	http.HandleFunc("GET /endpoints/{id}/latency", func(w http.ResponseWriter, r *http.Request) {
+		getEndpointLatency(requestContext(r), a.shards, w, r)
+	})
+
+	http.HandleFunc("GET /endpoints/{id}/history/hourly", func(w http.ResponseWriter, r *http.Request) {
+		getEndpointHourlyHistory(requestContext(r), a.shards, w, r)
+	})
+
+	http.HandleFunc("POST /endpoints/{id}/reset", a.idempotent.wrap(func(w http.ResponseWriter, r *http.Request) {
+		postEndpointReset(requestContext(r), a.shards, w, r)
+	}))
+
+	http.HandleFunc("POST /endpoints/{id}/test-alert", a.idempotent.wrap(func(w http.ResponseWriter, r *http.Request) {
+		postTestAlert(requestContext(r), a.shards, a.alerter, w, r)
+	}))
+
+	http.HandleFunc("POST /reset", requireAdminToken(a.adminToken, a.apiKey, func(w http.ResponseWriter, r *http.Request) {
+		postReset(requestContext(r), a.shards, w, r)
+	}))
+
+	http.HandleFunc("POST /diff", func(w http.ResponseWriter, r *http.Request) {
+		postDiff(requestContext(r), a.shards, w, r)
+	})
+
+	http.HandleFunc("POST /apply", a.listings.invalidating(func(w http.ResponseWriter, r *http.Request) {
+		apply := func(w http.ResponseWriter, r *http.Request) {
+			postApply(requestContext(r), a.shards, a.maxEndpoints, w, r)
 		}
-	}
+		if r.URL.Query().Get("delete") == "true" {
+			// deleting endpoints in bulk is destructive
+			apply = requireAdminToken(a.adminToken, a.apiKey, apply)
+		}
+		apply(w, r)
+	}))
 
-	// Ensure host:port
-	if _, _, splitErr := net.SplitHostPort(raw); splitErr != nil {
-		raw = raw + ":6379"
-	}
+	http.HandleFunc("GET /snapshots", func(w http.ResponseWriter, r *http.Request) {
+		getSnapshots(requestContext(r), a.shards, w, r)
+	})
+
+	http.HandleFunc("POST /snapshots/{version}/restore", a.listings.invalidating(requireAdminToken(a.adminToken, a.apiKey, func(w http.ResponseWriter, r *http.Request) {
+		postSnapshotRestore(requestContext(r), a.shards, a.snapshots, w, r)
+	})))
+
+	http.HandleFunc("GET /groups", func(w http.ResponseWriter, r *http.Request) {
+		getGroups(requestContext(r), a.shards, w, r)
+	})
+
+	http.HandleFunc("GET /groups/{id}", func(w http.ResponseWriter, r *http.Request) {
+		getGroup(requestContext(r), a.shards, w, r)
+	})
+
+	http.HandleFunc("PUT /groups/{id}", func(w http.ResponseWriter, r *http.Request) {
+		putGroup(requestContext(r), a.shards, w, r)
+	})
+
+	http.HandleFunc("DELETE /groups/{id}", func(w http.ResponseWriter, r *http.Request) {
+		deleteGroup(requestContext(r), a.shards, w, r)
+	})
+
+	http.HandleFunc("GET /groups/{id}/status", func(w http.ResponseWriter, r *http.Request) {
+		getGroupStatus(requestContext(r), a.shards, w, r)
+	})
+
+	http.HandleFunc("GET /summary", func(w http.ResponseWriter, r *http.Request) {
+		getSummary(requestContext(r), a.shards, w, r)
+	})
 
-	return raw, db, nil
+	http.HandleFunc("GET /defaults", getDefaults)
+
+	http.HandleFunc("GET /alerts/failed", requireAPIKey(a.apiKey, a.adminToken, func(w http.ResponseWriter, r *http.Request) {
+		getFailedAlerts(requestContext(r), a.shards, w, r)
+	}))
+
+	http.HandleFunc("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		getEvents(a.events, w, r)
+	})
+
+	http.HandleFunc("GET /ws", func(w http.ResponseWriter, r *http.Request) {
+		getWebSocket(a.events, w, r)
+	})
+
+	http.HandleFunc("/endpoints", func(w http.ResponseWriter, r *http.Request) {
+		getEndpoints(requestContext(r), a.shards, a.listings, w, r)
+	})
 }
 
-func endpointKey(identifier string) string {
-	return fmt.Sprintf("endpoints:%s", identifier)
+// fatal logs the message with the given attributes as an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
-func getEndpoint(ctx context.Context, vk valkey.Client, w http.ResponseWriter, r *http.Request) {
-	log.Printf("GET %s from %s", r.URL, r.RemoteAddr)
+// listen opens a listener on the unix domain socket, if given, or on the TCP
+// address otherwise. A stale socket file left behind is removed beforehand.
+func listen(socket, addr string) (net.Listener, error) {
+	if socket == "" {
+		return net.Listen("tcp", addr)
+	}
+	info, err := os.Lstat(socket)
+	if err == nil {
+		// never remove anything else given as the socket by mistake
+		if info.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", socket)
+		}
+		if err := os.Remove(socket); err != nil {
+			return nil, fmt.Errorf("remove stale socket %s: %v", socket, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("stat socket %s: %v", socket, err)
+	}
+	return net.Listen("unix", socket)
+}
+
+// getEndpoint responds with the endpoint, or with notFoundStatus and an empty
+// body if there is no such endpoint.
+func getEndpoint(ctx context.Context, shards *meow.Shards, notFoundStatus int, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
 
-	identifier, err := extractEndpointIdentifier(r.URL.String())
+	identifier, err := extractEndpointIdentifier(r.URL.Path)
 	if err != nil {
-		log.Printf("extract endpoint identifier of %s: %v", r.URL, err)
+		slog.Warn("extract endpoint identifier", "url", r.URL, "err", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	key := endpointKey(identifier)
+	key := meow.EndpointKey(identifier)
+	vk := shards.For(identifier)
 	kvs, err := vk.Do(ctx, vk.B().Hgetall().Key(key).Build()).AsStrMap()
 	if err != nil {
-		log.Printf("hgetall %s: %v", key, err)
+		slog.Error("hgetall", "key", key, "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	if len(kvs) == 0 {
-		log.Printf(`no such endpoint "%s"`, identifier)
-		w.WriteHeader(http.StatusNotFound)
+		slog.Warn("no such endpoint", "identifier", identifier)
+		w.WriteHeader(notFoundStatus)
 		return
 	}
 
 	payload, err := payloadFromValkeyMap(kvs)
 	if err != nil {
-		log.Printf("convert valkey hash %s to payload: %v", key, err)
+		slog.Error("convert valkey hash to payload", "key", key, "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	data, err := json.Marshal(payload)
+	data, err := marshalPayload(payload, "", isPretty(r), isCamelCase(r))
 	if err != nil {
-		log.Printf("marshal payload to JSON: %v", err)
+		slog.Error("marshal payload to JSON", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -148,145 +487,1817 @@ func getEndpoint(ctx context.Context, vk valkey.Client, w http.ResponseWriter, r
 	w.Write(data)
 }
 
-func postEndpoint(ctx context.Context, vk valkey.Client, w http.ResponseWriter, r *http.Request) {
-	log.Printf("POST %s from %s", r.URL, r.RemoteAddr)
+func postEndpoint(ctx context.Context, shards *meow.Shards, createOnly bool, maxEndpoints int, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
 
-	identifierPathParam, err := extractEndpointIdentifier(r.URL.String())
+	endpoint, status, err := endpointFromRequest(r)
 	if err != nil {
-		log.Printf("extract endpoint identifier of %s: %v", r.URL, err)
-		w.WriteHeader(http.StatusBadRequest)
+		slog.Warn("endpoint from request", "err", err)
+		describeProblem(r, err)
+		w.WriteHeader(status)
 		return
 	}
-
-	buf := bytes.NewBufferString("")
-	_, _ = io.Copy(buf, r.Body)
-	defer r.Body.Close()
-
-	endpoint, err := meow.EndpointFromJSON(buf.String())
+	invalid, err := checkDependencies(ctx, shards, endpoint)
 	if err != nil {
-		log.Printf("parse JSON body: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
+		slog.Error("check dependencies", "identifier", endpoint.Identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-
-	// Must match, otherwise reject
-	if identifierPathParam != endpoint.Identifier {
-		log.Printf("identifier mismatch: (resource: %s, body: %s)",
-			identifierPathParam, endpoint.Identifier)
-		w.WriteHeader(http.StatusBadRequest)
+	if invalid != nil {
+		slog.Warn("endpoint rejected: invalid dependencies", "identifier", endpoint.Identifier, "err", invalid)
+		describeProblem(r, invalid)
+		w.WriteHeader(http.StatusUnprocessableEntity)
 		return
 	}
 
-	key := endpointKey(endpoint.Identifier)
+	key := meow.EndpointKey(endpoint.Identifier)
+	vk := shards.For(endpoint.Identifier)
 
 	// existence check for correct status code
 	existing, err := vk.Do(ctx, vk.B().Hgetall().Key(key).Build()).AsStrMap()
 	if err != nil {
-		log.Printf("hgetall %s (exists check): %v", key, err)
+		slog.Error("hgetall (exists check)", "key", key, "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	exists := len(existing) > 0
+	if exists && createOnly {
+		slog.Warn("endpoint already exists", "identifier", endpoint.Identifier)
+		describeProblem(r, fmt.Errorf(`endpoint "%s" already exists`, endpoint.Identifier))
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if !exists {
+		full, err := capacityReached(ctx, shards, maxEndpoints)
+		if err != nil {
+			slog.Error("check endpoint capacity", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if full {
+			slog.Warn("endpoint rejected: limit reached", "identifier", endpoint.Identifier, "max", maxEndpoints)
+			w.WriteHeader(http.StatusInsufficientStorage)
+			return
+		}
+	}
 
-	// store endpoint as hash (all fields as strings)
-	cmd := vk.B().Hset().Key(key).
-		FieldValue().
-		FieldValue("identifier", endpoint.Identifier).
-		FieldValue("url", endpoint.URL.String()).
-		FieldValue("method", endpoint.Method).
-		FieldValue("status_online", strconv.Itoa(int(endpoint.StatusOnline))).
-		FieldValue("frequency", endpoint.Frequency.String()).
-		FieldValue("fail_after", strconv.Itoa(int(endpoint.FailAfter))).
-		Build()
-
-	if err := vk.Do(ctx, cmd).Error(); err != nil {
-		log.Printf("hset %s: %v", key, err)
+	fields := endpointHashFields(endpoint)
+	if err := storeEndpoint(ctx, vk, key, fields, existing); err != nil {
+		slog.Error("store endpoint", "key", key, "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	bumpVersion(ctx, shards)
 
-	if exists {
-		w.WriteHeader(http.StatusNoContent) // updated
-	} else {
+	if !exists {
 		w.WriteHeader(http.StatusCreated) // created
+		return
 	}
-}
 
-func getEndpoints(ctx context.Context, vk valkey.Client, w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		log.Printf("request from %s rejected: method %s not allowed",
-			r.RemoteAddr, r.Method)
-		w.WriteHeader(http.StatusMethodNotAllowed)
+	// updated: report the fields that changed
+	data, err := json.Marshal(diffHashFields(existing, fields))
+	if err != nil {
+		slog.Error("marshal changes", "key", key, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
 
-	log.Printf("GET %s from %s", r.URL, r.RemoteAddr)
+func putEndpoint(ctx context.Context, shards *meow.Shards, maxEndpoints int, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
 
-	keys, err := vk.Do(ctx, vk.B().Keys().Pattern("endpoints:*").Build()).AsStrSlice()
+	endpoint, status, err := endpointFromRequest(r)
 	if err != nil {
-		log.Printf("get keys for endpoints:*: %v", err)
+		slog.Warn("endpoint from request", "err", err)
+		describeProblem(r, err)
+		w.WriteHeader(status)
+		return
+	}
+	invalid, err := checkDependencies(ctx, shards, endpoint)
+	if err != nil {
+		slog.Error("check dependencies", "identifier", endpoint.Identifier, "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if invalid != nil {
+		slog.Warn("endpoint rejected: invalid dependencies", "identifier", endpoint.Identifier, "err", invalid)
+		describeProblem(r, invalid)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
 
-	payloads := make([]meow.EndpointPayload, 0)
-	for _, key := range keys {
-		kvs, err := vk.Do(ctx, vk.B().Hgetall().Key(key).Build()).AsStrMap()
+	key := meow.EndpointKey(endpoint.Identifier)
+	vk := shards.For(endpoint.Identifier)
+	if maxEndpoints > 0 {
+		exists, err := vk.Do(ctx, vk.B().Exists().Key(key).Build()).AsInt64()
 		if err != nil {
-			log.Printf("hgetall %s: %v", key, err)
+			slog.Error("exists", "key", key, "err", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		if len(kvs) == 0 {
-			continue
-		}
-		payload, err := payloadFromValkeyMap(kvs)
-		if err != nil {
-			log.Printf("convert valkey hash %s to payload: %v", key, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		if exists == 0 {
+			full, err := capacityReached(ctx, shards, maxEndpoints)
+			if err != nil {
+				slog.Error("check endpoint capacity", "err", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if full {
+				slog.Warn("endpoint rejected: limit reached", "identifier", endpoint.Identifier, "max", maxEndpoints)
+				w.WriteHeader(http.StatusInsufficientStorage)
+				return
+			}
 		}
-		payloads = append(payloads, payload)
 	}
 
-	data, err := json.Marshal(payloads)
+	// replace the hash atomically, so that no stale fields remain; the fields
+	// are written in the fixed order of endpointHashFields, and FieldValue()
+	// without arguments only starts the list of pairs, adding no empty field
+	builder := vk.B().Hset().Key(key).FieldValue()
+	for _, field := range endpointHashFields(endpoint) {
+		builder = builder.FieldValue(field.name, field.value)
+	}
+	builder = builder.FieldValue(meow.FieldModifiedAt, modifiedAt())
+	results := vk.DoMulti(ctx,
+		vk.B().Multi().Build(),
+		vk.B().Del().Key(key).Build(),
+		builder.Build(),
+		vk.B().Exec().Build())
+	replies, err := results[len(results)-1].ToArray()
 	if err != nil {
-		log.Printf("serialize payloads: %v", err)
+		slog.Error("replace", "key", key, "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	w.Write(data)
+	deleted, err := replies[0].AsInt64()
+	if err != nil {
+		slog.Error("del", "key", key, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := replies[1].Error(); err != nil {
+		slog.Error("hset", "key", key, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	bumpVersion(ctx, shards)
+
+	if deleted > 0 {
+		w.WriteHeader(http.StatusOK) // replaced
+	} else {
+		w.WriteHeader(http.StatusCreated) // created
+	}
 }
 
-func payloadFromValkeyMap(kvs map[string]string) (meow.EndpointPayload, error) {
-	id := kvs["identifier"]
-	url := kvs["url"]
-	method := kvs["method"]
-	freq := kvs["frequency"]
+// endpointFromRequest parses the endpoint from the request's body, which must
+// match the identifier of the requested resource. If this fails, the HTTP
+// status to respond with is returned along with the error.
+func endpointFromRequest(r *http.Request) (*meow.Endpoint, int, error) {
+	identifierPathParam, err := extractEndpointIdentifier(r.URL.Path)
+	if err != nil {
+		return nil, http.StatusBadRequest,
+			fmt.Errorf("extract endpoint identifier of %s: %v", r.URL, err)
+	}
+
+	buf := bytes.NewBufferString("")
+	_, _ = io.Copy(buf, r.Body)
+	defer r.Body.Close()
 
-	statusStr := kvs["status_online"]
-	failStr := kvs["fail_after"]
+	endpoint, err := meow.EndpointFromJSON(buf.String())
+	if err != nil {
+		return nil, statusForEndpointError(err), fmt.Errorf("parse JSON body: %w", err)
+	}
 
-	if id == "" || url == "" || method == "" || freq == "" || statusStr == "" || failStr == "" {
-		return meow.EndpointPayload{}, fmt.Errorf("missing fields in valkey hash: %v", kvs)
+	// Must match, otherwise reject
+	if identifierPathParam != endpoint.Identifier {
+		return nil, http.StatusBadRequest, fmt.Errorf("identifier mismatch: (resource: %s, body: %s)",
+			identifierPathParam, endpoint.Identifier)
 	}
+	return endpoint, 0, nil
+}
 
-	statusInt, err := strconv.Atoi(statusStr)
+func cloneEndpoint(ctx context.Context, shards *meow.Shards, maxEndpoints int, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	source, err := fetchPayload(ctx, shards, r.PathValue("id"))
 	if err != nil {
-		return meow.EndpointPayload{}, fmt.Errorf("status_online not a number: %q: %v", statusStr, err)
+		slog.Error("fetch endpoint", "identifier", r.PathValue("id"), "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
-	failInt, err := strconv.Atoi(failStr)
+	if source == nil {
+		slog.Warn("no such endpoint", "identifier", r.PathValue("id"))
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// the body overrides the fields it contains, and must name the clone
+	payload := *source
+	payload.Identifier = ""
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		slog.Warn("parse JSON body", "err", err)
+		describeProblem(r, fmt.Errorf("parse JSON body: %v", err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if payload.Identifier == "" {
+		slog.Warn("clone lacks an identifier", "source", source.Identifier)
+		describeProblem(r, &meow.ValidationError{Field: "identifier", Message: "clone lacks an identifier"})
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	endpoint, err := meow.EndpointFromPayload(payload)
 	if err != nil {
-		return meow.EndpointPayload{}, fmt.Errorf("fail_after not a number: %q: %v", failStr, err)
+		slog.Warn("convert payload to endpoint", "payload", payload, "err", err)
+		describeProblem(r, err)
+		w.WriteHeader(statusForEndpointError(err))
+		return
+	}
+	invalid, err := checkDependencies(ctx, shards, endpoint)
+	if err != nil {
+		slog.Error("check dependencies", "identifier", endpoint.Identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if invalid != nil {
+		slog.Warn("endpoint rejected: invalid dependencies", "identifier", endpoint.Identifier, "err", invalid)
+		describeProblem(r, invalid)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
 	}
 
-	return meow.EndpointPayload{
-		Identifier:   id,
-		URL:          url,
-		Method:       method,
-		StatusOnline: uint16(statusInt),
-		Frequency:    freq,
-		FailAfter:    uint8(failInt),
+	key := meow.EndpointKey(endpoint.Identifier)
+	vk := shards.For(endpoint.Identifier)
+	exists, err := vk.Do(ctx, vk.B().Exists().Key(key).Build()).AsInt64()
+	if err != nil {
+		slog.Error("exists", "key", key, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if exists > 0 {
+		slog.Warn("clone target already exists", "identifier", endpoint.Identifier)
+		describeProblem(r, fmt.Errorf(`endpoint "%s" already exists`, endpoint.Identifier))
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	full, err := capacityReached(ctx, shards, maxEndpoints)
+	if err != nil {
+		slog.Error("check endpoint capacity", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if full {
+		slog.Warn("endpoint rejected: limit reached", "identifier", endpoint.Identifier, "max", maxEndpoints)
+		w.WriteHeader(http.StatusInsufficientStorage)
+		return
+	}
+
+	if err := storeEndpoint(ctx, vk, key, endpointHashFields(endpoint), nil); err != nil {
+		slog.Error("store endpoint", "key", key, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	bumpVersion(ctx, shards)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func getEndpointCurl(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	payload, err := fetchPayload(ctx, shards, r.PathValue("id"))
+	if err != nil {
+		slog.Error("fetch endpoint", "identifier", r.PathValue("id"), "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if payload == nil {
+		slog.Warn("no such endpoint", "identifier", r.PathValue("id"))
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	endpoint, err := meow.EndpointFromPayload(*payload)
+	if err != nil {
+		slog.Error("convert payload to endpoint", "payload", payload, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	reveal := r.URL.Query().Get("reveal") == "true"
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(curlCommand(endpoint, reveal)))
+}
+
+func getEndpointIDs(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	identifiers, err := listIdentifiers(ctx, shards)
+	if err != nil {
+		slog.Error("list identifiers", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	data, err := marshalJSON(identifiers, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal identifiers", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// endpointStatus is the state of an endpoint as last recorded by the probe.
+type endpointStatus struct {
+	Identifier string `json:"identifier"`
+	State      string `json:"state"`
+	Since      string `json:"since,omitempty"`
+	Flapping   bool   `json:"flapping,omitempty"`
+
+	// ConsecutiveFailures is the number of failed checks since the last
+	// successful one.
+	ConsecutiveFailures int `json:"consecutive_failures,omitempty"`
+
+	// FailureReason is the reason the last check failed for, if it did.
+	FailureReason meow.FailureReason `json:"failure_reason,omitempty"`
+
+	// ServingStatus is only recorded for endpoints checked using the gRPC
+	// health protocol.
+	ServingStatus string `json:"serving_status,omitempty"`
+
+	// Regions holds the outcomes of the last checks from the regions probes
+	// run in, which are aggregated into RegionState.
+	Regions     map[string]meow.RegionState `json:"regions,omitempty"`
+	RegionState string                      `json:"region_state,omitempty"`
+}
+
+func getEndpointStatus(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	identifier := r.PathValue("id")
+	vk := shards.For(identifier)
+	results := vk.DoMulti(ctx,
+		vk.B().Exists().Key(meow.EndpointKey(identifier)).Build(),
+		vk.B().Hgetall().Key(meow.StateKey(identifier)).Build())
+	exists, err := results[0].AsInt64()
+	if err != nil {
+		slog.Error("exists", "key", meow.EndpointKey(identifier), "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if exists == 0 {
+		slog.Warn("no such endpoint", "identifier", identifier)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	kvs, err := results[1].AsStrMap()
+	if err != nil {
+		slog.Error("hgetall", "key", meow.StateKey(identifier), "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	status := endpointStatus{Identifier: identifier, State: meow.StateUnknown}
+	if state := kvs[meow.StateFieldState]; state != "" {
+		status.State = state
+		status.Since = kvs[meow.StateFieldSince]
+	}
+	status.Flapping = kvs[meow.StateFieldFlapping] == "true"
+	status.ConsecutiveFailures, _ = strconv.Atoi(kvs[meow.StateFieldConsecutiveFailures])
+	status.FailureReason = meow.FailureReason(kvs[meow.StateFieldFailureReason])
+	status.ServingStatus = kvs[meow.StateFieldServingStatus]
+	regions, err := meow.RegionStates(ctx, shards, identifier)
+	if err != nil {
+		slog.Error("get region states", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(regions) > 0 {
+		status.Regions = regions
+		status.RegionState = meow.AggregateRegionStates(regions)
+	}
+	data, err := marshalJSON(status, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal status", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// postEndpointReset resets the state of the endpoint to unknown and zeroes its
+// consecutive failed checks, so that the probe evaluates it afresh.
+func postEndpointReset(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	identifier := r.PathValue("id")
+	vk := shards.For(identifier)
+	exists, err := vk.Do(ctx, vk.B().Exists().Key(meow.EndpointKey(identifier)).Build()).AsInt64()
+	if err != nil {
+		slog.Error("exists", "key", meow.EndpointKey(identifier), "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if exists == 0 {
+		slog.Warn("no such endpoint", "identifier", identifier)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := meow.ResetState(ctx, vk, identifier, time.Now()); err != nil {
+		slog.Error("reset state", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	slog.Info("reset state", "identifier", identifier)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// postReset resets the states of all endpoints whose identifier starts with the
+// given prefix, and whose labels match the selector given as tag, at once, e.g.
+// after recovering from an incident. Either is required, so that not all
+// endpoints are reset by accident.
+func postReset(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	prefix := r.URL.Query().Get("prefix")
+	tag := r.URL.Query().Get("tag")
+	if prefix == "" && tag == "" {
+		slog.Warn("request rejected: reset without prefix or tag", "remote", r.RemoteAddr)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var identifiers []string
+	if tag != "" {
+		selector, err := meow.ParseSelector(tag)
+		if err != nil {
+			slog.Warn("request rejected: invalid tag", "tag", tag, "err", err)
+			describeProblem(r, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for payload, err := range selected(allPayloads(ctx, shards), selector) {
+			if err != nil {
+				slog.Error("list endpoints", "err", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			identifiers = append(identifiers, payload.Identifier)
+		}
+	} else {
+		var err error
+		if identifiers, err = listIdentifiers(ctx, shards); err != nil {
+			slog.Error("list identifiers", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	identifiers = slices.DeleteFunc(identifiers, func(identifier string) bool {
+		return !strings.HasPrefix(identifier, prefix)
+	})
+	if err := meow.ResetStates(ctx, shards, identifiers, time.Now()); err != nil {
+		slog.Error("reset states", "prefix", prefix, "tag", tag, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	slog.Info("reset states", "prefix", prefix, "tag", tag, "endpoints", len(identifiers))
+	data, err := marshalJSON(map[string]int{"reset": len(identifiers)}, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal reset count", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func getEndpointHistory(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	var since time.Time
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, raw); err != nil {
+			slog.Warn("request rejected: invalid since", "since", raw)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	identifier := r.PathValue("id")
+	vk := shards.For(identifier)
+	results := vk.DoMulti(ctx,
+		vk.B().Exists().Key(meow.EndpointKey(identifier)).Build(),
+		vk.B().Lrange().Key(meow.HistoryKey(identifier)).Start(0).Stop(-1).Build())
+	exists, err := results[0].AsInt64()
+	if err != nil {
+		slog.Error("exists", "key", meow.EndpointKey(identifier), "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if exists == 0 {
+		slog.Warn("no such endpoint", "identifier", identifier)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	records, err := results[1].AsStrSlice()
+	if err != nil {
+		slog.Error("lrange", "key", meow.HistoryKey(identifier), "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	failures := make([]meow.Failure, 0, len(records))
+	for _, record := range records {
+		var failure meow.Failure
+		if err := json.Unmarshal([]byte(record), &failure); err != nil {
+			slog.Error("unmarshal failure", "key", meow.HistoryKey(identifier), "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if failure.At.Before(since) {
+			// the history is ordered by time, most recent first
+			break
+		}
+		failures = append(failures, failure)
+	}
+	if accepts(r, "text/csv") {
+		writeHistoryCSV(w, failures)
+		return
+	}
+	data, err := marshalJSON(failures, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal history", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// deleteEndpointHistory deletes the failed checks of an endpoint, including
+// their hourly aggregates, leaving its config and state untouched.
+func deleteEndpointHistory(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	identifier := r.PathValue("id")
+	vk := shards.For(identifier)
+	exists, err := vk.Do(ctx, vk.B().Exists().Key(meow.EndpointKey(identifier)).Build()).AsInt64()
+	if err != nil {
+		slog.Error("exists", "key", meow.EndpointKey(identifier), "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if exists == 0 {
+		slog.Warn("no such endpoint", "identifier", identifier)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	del := vk.B().Del().Key(meow.HistoryKey(identifier), meow.HourlyHistoryKey(identifier)).Build()
+	if err := vk.Do(ctx, del).Error(); err != nil {
+		slog.Error("delete history", "identifier", identifier, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	slog.Info("deleted history", "identifier", identifier)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeHistoryCSV writes the failed checks as CSV with a header row. The
+// failover URL is only set for checks that succeeded using one.
+func writeHistoryCSV(w http.ResponseWriter, failures []meow.Failure) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	out := csv.NewWriter(w)
+	out.Write([]string{"timestamp", "status_code", "latency_ms", "failover_url"})
+	for _, failure := range failures {
+		latency := ""
+		if failure.LatencyMS > 0 {
+			latency = strconv.FormatInt(failure.LatencyMS, 10)
+		}
+		out.Write([]string{
+			failure.At.Format(time.RFC3339Nano),
+			strconv.Itoa(failure.Status),
+			latency,
+			failure.FailoverURL,
+		})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		slog.Warn("write history as CSV", "err", err)
+	}
+}
+
+// summary counts the endpoints by their state.
+type summary struct {
+	Total    int `json:"total"`
+	Up       int `json:"up"`
+	Down     int `json:"down"`
+	Degraded int `json:"degraded"`
+	Unknown  int `json:"unknown"`
+	Paused   int `json:"paused"`
+	Blocked  int `json:"blocked"`
+}
+
+func getSummary(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	identifiers, err := listIdentifiers(ctx, shards)
+	if err != nil {
+		slog.Error("list identifiers", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	states, err := fetchStates(ctx, shards, identifiers)
+	if err != nil {
+		slog.Error("fetch states", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s := summary{Total: len(identifiers)}
+	for _, state := range states {
+		switch state {
+		case meow.StateUp:
+			s.Up++
+		case meow.StateDown:
+			s.Down++
+		case meow.StateDegraded:
+			s.Degraded++
+		case meow.StatePaused, meow.StatePausedOffHours:
+			s.Paused++
+		case meow.StateBlocked:
+			s.Blocked++
+		default:
+			s.Unknown++
+		}
+	}
+	data, err := marshalJSON(s, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal summary", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func getEndpointRaw(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	identifier := r.PathValue("id")
+	key := meow.EndpointKey(identifier)
+	vk := shards.For(identifier)
+	kvs, err := vk.Do(ctx, vk.B().Hgetall().Key(key).Build()).AsStrMap()
+	if err != nil {
+		slog.Error("hgetall", "key", key, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(kvs) == 0 {
+		slog.Warn("no such endpoint", "identifier", identifier)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if secret, ok := kvs[meow.FieldWebhookSecret]; ok {
+		kvs[meow.FieldWebhookSecret] = redactSecret(secret)
+	}
+
+	data, err := marshalJSON(kvs, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal hash to JSON", "key", key, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// checkDependencies returns a validation error if a dependency of endpoint does
+// not exist, or if its dependencies form a cycle with the ones of the stored
+// endpoints, which would keep the endpoints in the cycle blocked for good once
+// one of them goes down.
+func checkDependencies(ctx context.Context, shards *meow.Shards, endpoint *meow.Endpoint) (*meow.ValidationError, error) {
+	for _, dependency := range endpoint.DependsOn {
+		key := meow.EndpointKey(dependency)
+		vk := shards.For(dependency)
+		exists, err := vk.Do(ctx, vk.B().Exists().Key(key).Build()).AsInt64()
+		if err != nil {
+			return nil, fmt.Errorf("exists %s: %v", key, err)
+		}
+		if exists == 0 {
+			return &meow.ValidationError{
+				Field:   "depends_on",
+				Message: fmt.Sprintf(`dependency "%s" does not exist`, dependency),
+			}, nil
+		}
+	}
+	cycle, err := dependencyCycle(endpoint.Identifier, func(identifier string) ([]string, error) {
+		if identifier == endpoint.Identifier {
+			return endpoint.DependsOn, nil
+		}
+		key := meow.EndpointKey(identifier)
+		vk := shards.For(identifier)
+		deps, err := vk.Do(ctx, vk.B().Hget().Key(key).Field(meow.FieldDependsOn).Build()).ToString()
+		if valkey.IsValkeyNil(err) || deps == "" {
+			return nil, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("get dependencies of %s: %v", identifier, err)
+		}
+		return strings.Split(deps, ","), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cycle != nil {
+		return &meow.ValidationError{
+			Field:   "depends_on",
+			Message: fmt.Sprintf("dependencies form a cycle: %s", strings.Join(cycle, " -> ")),
+		}, nil
+	}
+	return nil, nil
+}
+
+// dependencyCycle returns the identifiers of the endpoints on a cycle of
+// dependencies through the endpoint with identifier, beginning and ending with
+// it, or nil if there is no such cycle. The dependencies of an endpoint are
+// looked up using dependsOn.
+func dependencyCycle(identifier string, dependsOn func(string) ([]string, error)) ([]string, error) {
+	visited := map[string]bool{identifier: true}
+	path := []string{identifier}
+	var visit func(string) (bool, error)
+	visit = func(current string) (bool, error) {
+		deps, err := dependsOn(current)
+		if err != nil {
+			return false, err
+		}
+		for _, dependency := range deps {
+			if dependency == identifier {
+				path = append(path, dependency)
+				return true, nil
+			}
+			if visited[dependency] {
+				continue
+			}
+			visited[dependency] = true
+			path = append(path, dependency)
+			if found, err := visit(dependency); found || err != nil {
+				return found, err
+			}
+			path = path[:len(path)-1]
+		}
+		return false, nil
+	}
+	if found, err := visit(identifier); !found {
+		return nil, err
+	}
+	return path, nil
+}
+
+// fetchPayload reads the endpoint with the given identifier, or returns nil if
+// there is no such endpoint.
+func fetchPayload(ctx context.Context, shards *meow.Shards, identifier string) (*meow.EndpointPayload, error) {
+	key := meow.EndpointKey(identifier)
+	vk := shards.For(identifier)
+	kvs, err := vk.Do(ctx, vk.B().Hgetall().Key(key).Build()).AsStrMap()
+	if err != nil {
+		return nil, fmt.Errorf("hgetall %s: %v", key, err)
+	}
+	if len(kvs) == 0 {
+		return nil, nil
+	}
+	payload, err := payloadFromValkeyMap(kvs)
+	if err != nil {
+		return nil, fmt.Errorf("convert valkey hash %s to payload: %v", key, err)
+	}
+	return &payload, nil
+}
+
+// capacityReached reports whether the number of endpoints stored has reached
+// maxEndpoints, in which case no more endpoints may be created. A maximum of 0
+// means that there is no limit.
+func capacityReached(ctx context.Context, shards *meow.Shards, maxEndpoints int) (bool, error) {
+	if maxEndpoints <= 0 {
+		return false, nil
+	}
+	n, err := shards.CountKeys(ctx, "endpoints:*", maxEndpoints)
+	if err != nil {
+		return false, err
+	}
+	return n >= maxEndpoints, nil
+}
+
+// listIdentifiers returns the sorted identifiers of the endpoints of all shards.
+func listIdentifiers(ctx context.Context, shards *meow.Shards) ([]string, error) {
+	keys, err := shards.Keys(ctx, "endpoints:*")
+	if err != nil {
+		return nil, err
+	}
+	identifiers := make([]string, 0, len(keys))
+	for _, key := range keys {
+		identifiers = append(identifiers, meow.KeyIdentifier(key))
+	}
+	slices.Sort(identifiers)
+	return identifiers, nil
+}
+
+// statusForEndpointError maps an error converting a request into an endpoint to
+// an HTTP status: invalid field values are unprocessable, anything else, e.g.
+// malformed JSON, is a bad request.
+func statusForEndpointError(err error) int {
+	var validationErr *meow.ValidationError
+	if errors.As(err, &validationErr) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusBadRequest
+}
+
+// storeEndpoint writes the fields to the hash under key. The fields of the
+// existing hash that are no longer set are removed in the same transaction. The
+// modification time is only updated if any field changed.
+func storeEndpoint(ctx context.Context, vk valkey.Client, key string, fields []hashField, existing map[string]string) error {
+	if len(diffHashFields(existing, fields)) > 0 {
+		fields = append(slices.Clone(fields), hashField{meow.FieldModifiedAt, modifiedAt()})
+	}
+	builder := vk.B().Hset().Key(key).FieldValue()
+	for _, field := range fields {
+		builder = builder.FieldValue(field.name, field.value)
+	}
+	stale := staleHashFields(existing, fields)
+	if len(stale) == 0 {
+		if err := vk.Do(ctx, builder.Build()).Error(); err != nil {
+			return fmt.Errorf("hset %s: %v", key, err)
+		}
+		return nil
+	}
+	results := vk.DoMulti(ctx,
+		vk.B().Multi().Build(),
+		builder.Build(),
+		vk.B().Hdel().Key(key).Field(stale...).Build(),
+		vk.B().Exec().Build())
+	replies, err := results[len(results)-1].ToArray()
+	if err != nil {
+		return fmt.Errorf("update %s: %v", key, err)
+	}
+	if err := replies[0].Error(); err != nil {
+		return fmt.Errorf("hset %s: %v", key, err)
+	}
+	if err := replies[1].Error(); err != nil {
+		return fmt.Errorf("hdel %s %v: %v", key, stale, err)
+	}
+	return nil
+}
+
+// staleHashFields returns the names of the existing fields not to be written.
+func staleHashFields(existing map[string]string, fields []hashField) []string {
+	var stale []string
+	for name := range existing {
+		if name == meow.FieldModifiedAt {
+			continue
+		}
+		if !slices.ContainsFunc(fields, func(field hashField) bool { return field.name == name }) {
+			stale = append(stale, name)
+		}
+	}
+	slices.Sort(stale)
+	return stale
+}
+
+// hashField is a single field of an endpoint's valkey hash.
+type hashField struct {
+	name  string
+	value string
+}
+
+// modifiedAt returns the current time as the value of meow.FieldModifiedAt.
+func modifiedAt() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+// endpointHashFields returns the hash fields representing the endpoint in the
+// order they are written. Fields without a value are omitted.
+func endpointHashFields(endpoint *meow.Endpoint) []hashField {
+	proxy := ""
+	if endpoint.Proxy != nil {
+		proxy = endpoint.Proxy.String()
+	}
+	expectRedirectTo := ""
+	if endpoint.ExpectRedirectTo != nil {
+		expectRedirectTo = endpoint.ExpectRedirectTo.String()
+	}
+	statusClasses := ""
+	if len(endpoint.StatusClasses) > 0 {
+		data, _ := json.Marshal(endpoint.StatusClasses)
+		statusClasses = string(data)
+	}
+	retryOnStatuses := make([]string, 0, len(endpoint.RetryOnStatuses))
+	for _, status := range endpoint.RetryOnStatuses {
+		retryOnStatuses = append(retryOnStatuses, strconv.Itoa(int(status)))
+	}
+	notifyOnRecovery := ""
+	if !endpoint.NotifyOnRecovery {
+		notifyOnRecovery = "false"
+	}
+	useHEADWhenPossible := ""
+	if endpoint.UseHEADWhenPossible {
+		useHEADWhenPossible = "true"
+	}
+	maxRedirects := ""
+	if endpoint.MaxRedirects > 0 {
+		maxRedirects = strconv.Itoa(int(endpoint.MaxRedirects))
+	}
+	captureBodyBytes := ""
+	if endpoint.CaptureBodyBytes > 0 {
+		captureBodyBytes = strconv.Itoa(int(endpoint.CaptureBodyBytes))
+	}
+	historySize := ""
+	if endpoint.HistorySize > 0 {
+		historySize = strconv.Itoa(int(endpoint.HistorySize))
+	}
+	queryParams := ""
+	if len(endpoint.QueryParams) > 0 {
+		data, _ := json.Marshal(endpoint.QueryParams)
+		queryParams = string(data)
+	}
+	labels := ""
+	if len(endpoint.Labels) > 0 {
+		data, _ := json.Marshal(endpoint.Labels)
+		labels = string(data)
+	}
+	minBodyBytes, maxBodyBytes := "", ""
+	if endpoint.MinBodyBytes > 0 {
+		minBodyBytes = strconv.FormatUint(uint64(endpoint.MinBodyBytes), 10)
+	}
+	if endpoint.MaxBodyBytes > 0 {
+		maxBodyBytes = strconv.FormatUint(uint64(endpoint.MaxBodyBytes), 10)
+	}
+	failoverURLs := ""
+	if len(endpoint.FailoverURLs) > 0 {
+		data, _ := json.Marshal(endpoint.URLs()[1:])
+		failoverURLs = string(data)
+	}
+	failWindow, failRatio := "", ""
+	if endpoint.FailWindow > 0 {
+		failWindow = strconv.Itoa(int(endpoint.FailWindow))
+		failRatio = strconv.FormatFloat(endpoint.FailRatio, 'g', -1, 64)
+	}
+	alerts := ""
+	if len(endpoint.Alerts) > 0 {
+		// the channels have been validated, so marshalling cannot fail
+		data, _ := json.Marshal(endpoint.Alerts)
+		alerts = string(data)
+	}
+	maintenanceWindows := ""
+	if len(endpoint.MaintenanceWindows) > 0 {
+		data, _ := json.Marshal(endpoint.MaintenanceWindows)
+		maintenanceWindows = string(data)
+	}
+	checkWindow := ""
+	if endpoint.CheckWindow != nil {
+		data, _ := json.Marshal(endpoint.CheckWindow)
+		checkWindow = string(data)
+	}
+	offset := ""
+	if endpoint.Offset > 0 {
+		offset = endpoint.Offset.String()
+	}
+	timeout, retries := "", ""
+	if endpoint.Timeout > 0 {
+		timeout = endpoint.Timeout.String()
+	}
+	if endpoint.Retries > 0 {
+		retries = strconv.Itoa(int(endpoint.Retries))
+	}
+	expectJSONValue := ""
+	if endpoint.ExpectJSONPath != "" {
+		data, _ := json.Marshal(endpoint.ExpectJSONValue)
+		expectJSONValue = string(data)
+	}
+	fields := []hashField{
+		{meow.FieldIdentifier, endpoint.Identifier},
+		{meow.FieldURL, endpoint.RawURL()},
+		{meow.FieldFailoverURLs, failoverURLs},
+		{meow.FieldMethod, endpoint.Method},
+		{meow.FieldStatusOnline, strconv.Itoa(int(endpoint.StatusOnline))},
+		{meow.FieldFrequency, endpoint.Frequency.String()},
+		{meow.FieldFailAfter, strconv.Itoa(int(endpoint.FailAfter))},
+		{meow.FieldFailWindow, failWindow},
+		{meow.FieldFailRatio, failRatio},
+		{meow.FieldDependsOn, strings.Join(endpoint.DependsOn, ",")},
+		{meow.FieldProxy, proxy},
+		{meow.FieldCaptureBodyBytes, captureBodyBytes},
+		{meow.FieldExpectSHA256, endpoint.ExpectSHA256},
+		{meow.FieldAlertCooldown, endpoint.AlertCooldown.String()},
+		{meow.FieldAlerts, alerts},
+		{meow.FieldAlertTemplate, endpoint.AlertTemplate},
+		{meow.FieldMaintenanceWindows, maintenanceWindows},
+		{meow.FieldCheckWindow, checkWindow},
+		{meow.FieldProtocol, endpoint.Protocol},
+		{meow.FieldUserAgent, endpoint.UserAgent},
+		{meow.FieldMaxRedirects, maxRedirects},
+		{meow.FieldExpectRedirectTo, expectRedirectTo},
+		{meow.FieldUseHEADWhenPossible, useHEADWhenPossible},
+		{meow.FieldStatusClasses, statusClasses},
+		{meow.FieldRetryOnStatuses, strings.Join(retryOnStatuses, ",")},
+		{meow.FieldExpectJSONPath, endpoint.ExpectJSONPath},
+		{meow.FieldExpectJSONValue, expectJSONValue},
+		{meow.FieldOffset, offset},
+		{meow.FieldWebhookSecret, endpoint.WebhookSecret},
+		{meow.FieldNotifyOnRecovery, notifyOnRecovery},
+		{meow.FieldMinBodyBytes, minBodyBytes},
+		{meow.FieldMaxBodyBytes, maxBodyBytes},
+		{meow.FieldQueryParams, queryParams},
+		{meow.FieldHistorySize, historySize},
+		{meow.FieldHTTPVersion, endpoint.HTTPVersion},
+		{meow.FieldLabels, labels},
+		{meow.FieldRegions, strings.Join(endpoint.Regions, ",")},
+		{meow.FieldTimeout, timeout},
+		{meow.FieldRetries, retries},
+	}
+	return slices.DeleteFunc(fields, func(field hashField) bool { return field.value == "" })
+}
+
+// redactSecret replaces a secret, unless it is empty.
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "redacted"
+}
+
+// fieldChange describes the old and new value of a changed hash field.
+type fieldChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// diffHashFields compares the existing hash to the fields written and returns
+// the changes indexed by field name. Removed fields have an empty new value.
+func diffHashFields(existing map[string]string, fields []hashField) map[string]fieldChange {
+	changes := make(map[string]fieldChange)
+	for _, field := range fields {
+		if old := existing[field.name]; old != field.value {
+			changes[field.name] = fieldChange{old, field.value}
+		}
+	}
+	for _, name := range staleHashFields(existing, fields) {
+		changes[name] = fieldChange{existing[name], ""}
+	}
+	// report that the secret changed, but not the secret itself
+	if change, ok := changes[meow.FieldWebhookSecret]; ok {
+		changes[meow.FieldWebhookSecret] = fieldChange{redactSecret(change.Old), redactSecret(change.New)}
+	}
+	return changes
+}
+
+func getEndpoints(ctx context.Context, shards *meow.Shards, cache *listingCache, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		slog.Warn("request rejected: method not allowed",
+			"remote", r.RemoteAddr, "method", r.Method)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	if ids := r.URL.Query().Get("ids"); ids != "" {
+		selected, err := fetchPayloads(ctx, shards, strings.Split(ids, ","))
+		if err != nil {
+			slog.Error("fetch endpoints", "ids", ids, "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeListing(w, r, payloadSeq(selected))
+		return
+	}
+	if r.URL.Query().Has("modified_since") || r.URL.Query().Has("selector") {
+		payloads := allPayloads(ctx, shards)
+		if raw := r.URL.Query().Get("modified_since"); raw != "" {
+			since, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				slog.Warn("request rejected: invalid modified_since", "modified_since", raw, "err", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			payloads = modifiedSince(payloads, since)
+		}
+		if raw := r.URL.Query().Get("selector"); raw != "" {
+			selector, err := meow.ParseSelector(raw)
+			if err != nil {
+				slog.Warn("request rejected: invalid selector", "selector", raw, "err", err)
+				describeProblem(r, err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			payloads = selected(payloads, selector)
+		}
+		writeListing(w, r, payloads)
+		return
+	}
+
+	// the listing of all endpoints is cached in the variant requested
+	variant := "json"
+	if accepts(r, "text/csv") {
+		variant = "csv"
+		if columns := r.URL.Query().Get("columns"); columns != "" {
+			variant += "-" + columns
+		}
+	} else if isPretty(r) {
+		variant = "json-pretty"
+	}
+	if variant != "csv" && isCamelCase(r) {
+		variant += "-camel"
+	}
+	version, err := fetchVersion(ctx, shards)
+	versioned := err == nil
+	if !versioned {
+		// the listing is still served, but cannot be cached by the client, nor
+		// taken from or put into the cache
+		slog.Error("fetch version", "err", err)
+	} else {
+		etag := listingETag(version, variant)
+		w.Header().Set("ETag", etag)
+		if etagMatches(r, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	listing, generation, ok := cache.get(variant, version)
+	if !ok || !versioned {
+		// collect all payloads beforehand, so that no partial listing is cached
+		payloads := make([]meow.EndpointPayload, 0)
+		for payload, err := range allPayloads(ctx, shards) {
+			if err != nil {
+				slog.Error("fetch endpoints", "err", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			payloads = append(payloads, payload)
+		}
+		buf := newResponseBuffer()
+		writeListing(buf, r, payloadSeq(payloads))
+		if buf.status != http.StatusOK {
+			w.WriteHeader(buf.status)
+			return
+		}
+		listing = cachedListing{data: buf.Bytes(), contentType: buf.Header().Get("Content-Type")}
+		if versioned {
+			cache.put(variant, generation, version, listing.data, listing.contentType)
+		}
+	}
+	if listing.contentType != "" {
+		w.Header().Set("Content-Type", listing.contentType)
+	}
+	w.Write(listing.data)
+}
+
+// writeListing writes the payloads as CSV or JSON, depending on the request.
+func writeListing(w http.ResponseWriter, r *http.Request, payloads iter.Seq2[meow.EndpointPayload, error]) {
+	if accepts(r, "text/csv") {
+		columns, err := selectCSVColumns(r.URL.Query().Get("columns"))
+		if err != nil {
+			slog.Warn("request rejected: invalid columns", "columns", r.URL.Query().Get("columns"), "err", err)
+			describeProblem(r, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writePayloadsCSV(w, payloads, columns)
+		return
+	}
+	writePayloads(w, payloads, isPretty(r), isCamelCase(r))
+}
+
+// writePayloads streams the payloads as a JSON array, which is identical to the
+// marshaled slice of them, but doesn't require holding them all in memory. An
+// error before the first payload causes an internal server error, whereas
+// later errors abort the response.
+func writePayloads(w http.ResponseWriter, payloads iter.Seq2[meow.EndpointPayload, error], pretty, camelCase bool) {
+	begin, separator, end, prefix := "[", ",", "]", ""
+	if pretty {
+		begin, separator, end, prefix = "[\n  ", ",\n  ", "\n]", "  "
+	}
+	n := 0
+	for payload, err := range payloads {
+		if err != nil {
+			slog.Error("fetch endpoints", "err", err)
+			if n == 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+		data, err := marshalPayload(payload, prefix, pretty, camelCase)
+		if err != nil {
+			slog.Error("marshal payload", "payload", payload, "err", err)
+			if n == 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+		if n == 0 {
+			data = append([]byte(begin), data...)
+		} else {
+			data = append([]byte(separator), data...)
+		}
+		if _, err := w.Write(data); err != nil {
+			slog.Warn("write endpoints", "err", err)
+			return
+		}
+		n++
+	}
+	if n == 0 {
+		w.Write([]byte("[]"))
+	} else {
+		w.Write([]byte(end))
+	}
+}
+
+// csvColumn is a column of the listing of endpoints as CSV.
+type csvColumn struct {
+	name  string
+	value func(meow.EndpointPayload) string
+}
+
+// csvColumns are the columns the listing of endpoints as CSV can be requested
+// with, of which the first six are the default ones.
+var csvColumns = []csvColumn{
+	{"identifier", func(p meow.EndpointPayload) string { return p.Identifier }},
+	{"url", func(p meow.EndpointPayload) string { return p.URL }},
+	{"method", func(p meow.EndpointPayload) string { return p.Method }},
+	{"status_online", func(p meow.EndpointPayload) string { return strconv.Itoa(int(p.StatusOnline)) }},
+	{"frequency", func(p meow.EndpointPayload) string { return p.Frequency }},
+	{"fail_after", func(p meow.EndpointPayload) string { return strconv.Itoa(int(p.FailAfter)) }},
+	{"depends_on", func(p meow.EndpointPayload) string { return strings.Join(p.DependsOn, ",") }},
+	{"proxy", func(p meow.EndpointPayload) string { return p.Proxy }},
+	{"capture_body_bytes", func(p meow.EndpointPayload) string { return strconv.Itoa(int(p.CaptureBodyBytes)) }},
+	{"alert_cooldown", func(p meow.EndpointPayload) string { return p.AlertCooldown }},
+	{"alerts", func(p meow.EndpointPayload) string { return alertsColumn(p.Alerts) }},
+	{"alert_template", func(p meow.EndpointPayload) string { return p.AlertTemplate }},
+	{"maintenance_windows", func(p meow.EndpointPayload) string { return windowsColumn(p.MaintenanceWindows) }},
+	{"check_window", func(p meow.EndpointPayload) string { return checkWindowColumn(p.CheckWindow) }},
+	{"protocol", func(p meow.EndpointPayload) string { return p.Protocol }},
+	{"user_agent", func(p meow.EndpointPayload) string { return p.UserAgent }},
+	{"fail_window", func(p meow.EndpointPayload) string { return strconv.Itoa(int(p.FailWindow)) }},
+	{"fail_ratio", func(p meow.EndpointPayload) string { return strconv.FormatFloat(p.FailRatio, 'g', -1, 64) }},
+	{"expect_sha256", func(p meow.EndpointPayload) string { return p.ExpectSHA256 }},
+	{"urls", func(p meow.EndpointPayload) string { return strings.Join(p.URLs, " ") }},
+	{"max_redirects", func(p meow.EndpointPayload) string { return strconv.Itoa(int(p.MaxRedirects)) }},
+	{"expect_redirect_to", func(p meow.EndpointPayload) string { return p.ExpectRedirectTo }},
+	{"use_head_when_possible", func(p meow.EndpointPayload) string { return strconv.FormatBool(p.UseHEADWhenPossible) }},
+	{"status_classes", func(p meow.EndpointPayload) string { return statusClassesColumn(p.StatusClasses) }},
+	{"retry_on_statuses", func(p meow.EndpointPayload) string { return retryOnStatusesColumn(p.RetryOnStatuses) }},
+	{"expect_json_path", func(p meow.EndpointPayload) string { return p.ExpectJSONPath }},
+	{"expect_json_value", func(p meow.EndpointPayload) string { return string(p.ExpectJSONValue) }},
+	{"offset", func(p meow.EndpointPayload) string { return p.Offset }},
+	{"modified_at", func(p meow.EndpointPayload) string { return p.ModifiedAt }},
+	{"notify_on_recovery", func(p meow.EndpointPayload) string {
+		return strconv.FormatBool(p.NotifyOnRecovery == nil || *p.NotifyOnRecovery)
+	}},
+	{"min_body_bytes", func(p meow.EndpointPayload) string { return strconv.FormatUint(uint64(p.MinBodyBytes), 10) }},
+	{"max_body_bytes", func(p meow.EndpointPayload) string { return strconv.FormatUint(uint64(p.MaxBodyBytes), 10) }},
+	{"query_params", func(p meow.EndpointPayload) string { return queryParamsColumn(p.QueryParams) }},
+	{"history_size", func(p meow.EndpointPayload) string { return strconv.Itoa(int(p.HistorySize)) }},
+	{"http_version", func(p meow.EndpointPayload) string { return p.HTTPVersion }},
+	{"labels", func(p meow.EndpointPayload) string { return labelsColumn(p.Labels) }},
+	{"regions", func(p meow.EndpointPayload) string { return strings.Join(p.Regions, " ") }},
+	{"timeout", func(p meow.EndpointPayload) string { return p.Timeout }},
+	{"retries", func(p meow.EndpointPayload) string { return strconv.Itoa(int(p.Retries)) }},
+}
+
+// selectCSVColumns returns the columns named in the comma-separated list, in
+// its order, or the default columns if it is empty.
+func selectCSVColumns(names string) ([]csvColumn, error) {
+	if names == "" {
+		return csvColumns[:6], nil
+	}
+	var selected []csvColumn
+	for name := range strings.SplitSeq(names, ",") {
+		i := slices.IndexFunc(csvColumns, func(column csvColumn) bool { return column.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf(`"%s" is not a column`, name)
+		}
+		selected = append(selected, csvColumns[i])
+	}
+	return selected, nil
+}
+
+// writePayloadsCSV streams the payloads as CSV with a header row and the given
+// columns. Errors are handled like in writePayloads.
+func writePayloadsCSV(w http.ResponseWriter, payloads iter.Seq2[meow.EndpointPayload, error], columns []csvColumn) {
+	header := make([]string, 0, len(columns))
+	for _, column := range columns {
+		header = append(header, column.name)
+	}
+	out := csv.NewWriter(w)
+	n := 0
+	for payload, err := range payloads {
+		if err != nil {
+			slog.Error("fetch endpoints", "err", err)
+			if n == 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+		if n == 0 {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			out.Write(header)
+		}
+		record := make([]string, 0, len(columns))
+		for _, column := range columns {
+			record = append(record, column.value(payload))
+		}
+		out.Write(record)
+		n++
+	}
+	if n == 0 {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		out.Write(header)
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		slog.Warn("write endpoints as CSV", "err", err)
+	}
+}
+
+// accepts reports whether the request's Accept header lists the media type.
+func accepts(r *http.Request, mediaType string) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if parsed, _, err := mime.ParseMediaType(accepted); err == nil && parsed == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// isPretty reports whether the request asks for pretty-printed JSON.
+func isPretty(r *http.Request) bool {
+	return r.URL.Query().Get("pretty") == "true"
+}
+
+// isCamelCase reports whether the request asks for camelCase field names
+// instead of snake_case ones, e.g. statusOnline instead of status_online.
+func isCamelCase(r *http.Request) bool {
+	return r.URL.Query().Get("naming") == "camelCase"
+}
+
+// marshalPayload marshals the payload like marshalJSON, but with camelCase
+// field names if camelCase is set. The webhook secret is never returned.
+func marshalPayload(payload meow.EndpointPayload, prefix string, pretty, camelCase bool) ([]byte, error) {
+	payload.WebhookSecret = ""
+	if !camelCase {
+		return marshalJSON(payload, prefix, pretty)
+	}
+	data, err := payload.CamelCaseJSON()
+	if err != nil || !pretty {
+		return data, err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, prefix, "  "); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// marshalJSON marshals v compactly, or indented after the given prefix if
+// pretty is set.
+func marshalJSON(v any, prefix string, pretty bool) ([]byte, error) {
+	if pretty {
+		return json.MarshalIndent(v, prefix, "  ")
+	}
+	return json.Marshal(v)
+}
+
+// allPayloads iterates over the endpoints of all shards. Iteration stops after
+// yielding an error.
+func allPayloads(ctx context.Context, shards *meow.Shards) iter.Seq2[meow.EndpointPayload, error] {
+	return func(yield func(meow.EndpointPayload, error) bool) {
+		keys, err := shards.Keys(ctx, "endpoints:*")
+		if err != nil {
+			yield(meow.EndpointPayload{}, err)
+			return
+		}
+		for _, key := range keys {
+			vk := shards.For(meow.KeyIdentifier(key))
+			kvs, err := vk.Do(ctx, vk.B().Hgetall().Key(key).Build()).AsStrMap()
+			if err != nil {
+				yield(meow.EndpointPayload{}, fmt.Errorf("hgetall %s: %v", key, err))
+				return
+			}
+			if len(kvs) == 0 {
+				continue
+			}
+			payload, err := payloadFromValkeyMap(kvs)
+			if err != nil {
+				yield(meow.EndpointPayload{}, fmt.Errorf("convert valkey hash %s to payload: %v", key, err))
+				return
+			}
+			if !yield(payload, nil) {
+				return
+			}
+		}
+	}
+}
+
+// modifiedSince iterates over the payloads modified after since. Payloads
+// without a modification time, i.e. stored before it was recorded, are
+// included, since they might have been modified.
+func modifiedSince(payloads iter.Seq2[meow.EndpointPayload, error], since time.Time) iter.Seq2[meow.EndpointPayload, error] {
+	return func(yield func(meow.EndpointPayload, error) bool) {
+		for payload, err := range payloads {
+			if err == nil && payload.ModifiedAt != "" {
+				if modified, err := time.Parse(time.RFC3339Nano, payload.ModifiedAt); err == nil && !modified.After(since) {
+					continue
+				}
+			}
+			if !yield(payload, err) {
+				return
+			}
+		}
+	}
+}
+
+// selected iterates over the payloads whose labels match the selector.
+func selected(payloads iter.Seq2[meow.EndpointPayload, error], selector meow.Selector) iter.Seq2[meow.EndpointPayload, error] {
+	return func(yield func(meow.EndpointPayload, error) bool) {
+		for payload, err := range payloads {
+			if err == nil && !selector.Matches(payload.Labels) {
+				continue
+			}
+			if !yield(payload, err) {
+				return
+			}
+		}
+	}
+}
+
+// payloadSeq iterates over the given payloads.
+func payloadSeq(payloads []meow.EndpointPayload) iter.Seq2[meow.EndpointPayload, error] {
+	return func(yield func(meow.EndpointPayload, error) bool) {
+		for _, payload := range payloads {
+			if !yield(payload, nil) {
+				return
+			}
+		}
+	}
+}
+
+// fetchPayloads reads the endpoints with the given identifiers in that order,
+// using one pipeline per shard. Identifiers without endpoint are omitted.
+func fetchPayloads(ctx context.Context, shards *meow.Shards, identifiers []string) ([]meow.EndpointPayload, error) {
+	byClient := make(map[valkey.Client][]string)
+	for _, identifier := range identifiers {
+		vk := shards.For(identifier)
+		byClient[vk] = append(byClient[vk], identifier)
+	}
+	found := make(map[string]meow.EndpointPayload)
+	for vk, ids := range byClient {
+		cmds := make(valkey.Commands, 0, len(ids))
+		for _, id := range ids {
+			cmds = append(cmds, vk.B().Hgetall().Key(meow.EndpointKey(id)).Build())
+		}
+		for i, result := range vk.DoMulti(ctx, cmds...) {
+			key := meow.EndpointKey(ids[i])
+			kvs, err := result.AsStrMap()
+			if err != nil {
+				return nil, fmt.Errorf("hgetall %s: %v", key, err)
+			}
+			if len(kvs) == 0 {
+				continue
+			}
+			payload, err := payloadFromValkeyMap(kvs)
+			if err != nil {
+				return nil, fmt.Errorf("convert valkey hash %s to payload: %v", key, err)
+			}
+			found[ids[i]] = payload
+		}
+	}
+	payloads := make([]meow.EndpointPayload, 0, len(found))
+	for _, identifier := range identifiers {
+		if payload, ok := found[identifier]; ok {
+			payloads = append(payloads, payload)
+			delete(found, identifier)
+		}
+	}
+	return payloads, nil
+}
+
+// fetchStates reads the states of the endpoints with the given identifiers,
+// using one pipeline per shard. Endpoints without a state recorded by the probe
+// yet are in the unknown state.
+func fetchStates(ctx context.Context, shards *meow.Shards, identifiers []string) (map[string]string, error) {
+	byClient := make(map[valkey.Client][]string)
+	for _, identifier := range identifiers {
+		vk := shards.For(identifier)
+		byClient[vk] = append(byClient[vk], identifier)
+	}
+	states := make(map[string]string, len(identifiers))
+	for vk, ids := range byClient {
+		cmds := make(valkey.Commands, 0, len(ids))
+		for _, id := range ids {
+			cmds = append(cmds, vk.B().Hget().Key(meow.StateKey(id)).Field(meow.StateFieldState).Build())
+		}
+		for i, result := range vk.DoMulti(ctx, cmds...) {
+			state, err := result.ToString()
+			if valkey.IsValkeyNil(err) {
+				state = meow.StateUnknown
+			} else if err != nil {
+				return nil, fmt.Errorf("hget %s state: %v", meow.StateKey(ids[i]), err)
+			}
+			states[ids[i]] = state
+		}
+	}
+	return states, nil
+}
+
+// alertsColumn formats the alert channels for a CSV column as type:target pairs
+// separated by spaces.
+func alertsColumn(channels []meow.AlertChannel) string {
+	pairs := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		pairs = append(pairs, channel.Type+":"+channel.Target)
+	}
+	return strings.Join(pairs, " ")
+}
+
+// statusClassesColumn formats the status classes for a CSV column as
+// status:class pairs ordered by status and separated by spaces.
+func statusClassesColumn(classes map[uint16]string) string {
+	pairs := make([]string, 0, len(classes))
+	for _, status := range slices.Sorted(maps.Keys(classes)) {
+		pairs = append(pairs, fmt.Sprintf("%d:%s", status, classes[status]))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// retryOnStatusesColumn formats the statuses for a CSV column separated by
+// spaces.
+func retryOnStatusesColumn(statuses []uint16) string {
+	formatted := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		formatted = append(formatted, strconv.Itoa(int(status)))
+	}
+	return strings.Join(formatted, " ")
+}
+
+// queryParamsColumn formats the query parameters for a CSV column as
+// name=value pairs ordered by name and separated by ampersands, leaving their
+// tokens as they are.
+func queryParamsColumn(params map[string]string) string {
+	pairs := make([]string, 0, len(params))
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		pairs = append(pairs, name+"="+params[name])
+	}
+	return strings.Join(pairs, "&")
+}
+
+// labelsColumn formats the labels for a CSV column like a selector matching
+// them, e.g. env=prod,tier=web.
+func labelsColumn(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// windowsColumn formats the windows for a CSV column separated by semicolons.
+func windowsColumn(windows []meow.Window) string {
+	formatted := make([]string, 0, len(windows))
+	for _, w := range windows {
+		formatted = append(formatted, w.String())
+	}
+	return strings.Join(formatted, "; ")
+}
+
+// checkWindowColumn formats the check window for a CSV column, which is empty
+// for endpoints checked all the time.
+func checkWindowColumn(w *meow.Window) string {
+	if w == nil {
+		return ""
+	}
+	return w.String()
+}
+
+func payloadFromValkeyMap(kvs map[string]string) (meow.EndpointPayload, error) {
+	id := kvs[meow.FieldIdentifier]
+	url := kvs[meow.FieldURL]
+	method := kvs[meow.FieldMethod]
+	freq := kvs[meow.FieldFrequency]
+
+	statusStr := kvs[meow.FieldStatusOnline]
+	failStr := kvs[meow.FieldFailAfter]
+
+	// gRPC endpoints have no method
+	missingMethod := method == "" && kvs[meow.FieldProtocol] != meow.ProtocolGRPC
+	if id == "" || url == "" || missingMethod || freq == "" || statusStr == "" || failStr == "" {
+		return meow.EndpointPayload{}, fmt.Errorf("missing fields in valkey hash: %v", kvs)
+	}
+
+	statusInt, err := strconv.Atoi(statusStr)
+	if err != nil {
+		return meow.EndpointPayload{}, fmt.Errorf("status_online not a number: %q: %v", statusStr, err)
+	}
+	failInt, err := strconv.Atoi(failStr)
+	if err != nil {
+		return meow.EndpointPayload{}, fmt.Errorf("fail_after not a number: %q: %v", failStr, err)
+	}
+
+	var urls []string
+	if failoverStr := kvs[meow.FieldFailoverURLs]; failoverStr != "" {
+		var failoverURLs []string
+		if err := json.Unmarshal([]byte(failoverStr), &failoverURLs); err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("failover_urls not valid JSON: %q: %v", failoverStr, err)
+		}
+		urls = append([]string{url}, failoverURLs...)
+	}
+	var maxRedirects uint64
+	if redirectsStr := kvs[meow.FieldMaxRedirects]; redirectsStr != "" {
+		maxRedirects, err = strconv.ParseUint(redirectsStr, 10, 8)
+		if err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("max_redirects not a number: %q: %v", redirectsStr, err)
+		}
+	}
+	var useHEADWhenPossible bool
+	if headStr := kvs[meow.FieldUseHEADWhenPossible]; headStr != "" {
+		useHEADWhenPossible, err = strconv.ParseBool(headStr)
+		if err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("use_head_when_possible not a boolean: %q: %v", headStr, err)
+		}
+	}
+	var notifyOnRecovery *bool
+	if notifyStr := kvs[meow.FieldNotifyOnRecovery]; notifyStr != "" {
+		notify, err := strconv.ParseBool(notifyStr)
+		if err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("notify_on_recovery not a boolean: %q: %v", notifyStr, err)
+		}
+		notifyOnRecovery = &notify
+	}
+	var failWindow uint64
+	if windowStr := kvs[meow.FieldFailWindow]; windowStr != "" {
+		failWindow, err = strconv.ParseUint(windowStr, 10, 8)
+		if err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("fail_window not a number: %q: %v", windowStr, err)
+		}
+	}
+	var failRatio float64
+	if ratioStr := kvs[meow.FieldFailRatio]; ratioStr != "" {
+		failRatio, err = strconv.ParseFloat(ratioStr, 64)
+		if err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("fail_ratio not a number: %q: %v", ratioStr, err)
+		}
+	}
+
+	var dependsOn []string
+	if deps := kvs[meow.FieldDependsOn]; deps != "" {
+		dependsOn = strings.Split(deps, ",")
+	}
+	var regions []string
+	if regionsStr := kvs[meow.FieldRegions]; regionsStr != "" {
+		regions = strings.Split(regionsStr, ",")
+	}
+	var captureBodyBytes uint64
+	if captureStr := kvs[meow.FieldCaptureBodyBytes]; captureStr != "" {
+		captureBodyBytes, err = strconv.ParseUint(captureStr, 10, 32)
+		if err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("capture_body_bytes not a number: %q: %v", captureStr, err)
+		}
+	}
+	var minBodyBytes, maxBodyBytes uint64
+	if minStr := kvs[meow.FieldMinBodyBytes]; minStr != "" {
+		minBodyBytes, err = strconv.ParseUint(minStr, 10, 32)
+		if err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("min_body_bytes not a number: %q: %v", minStr, err)
+		}
+	}
+	if maxStr := kvs[meow.FieldMaxBodyBytes]; maxStr != "" {
+		maxBodyBytes, err = strconv.ParseUint(maxStr, 10, 32)
+		if err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("max_body_bytes not a number: %q: %v", maxStr, err)
+		}
+	}
+	var alerts []meow.AlertChannel
+	if alertsStr := kvs[meow.FieldAlerts]; alertsStr != "" {
+		if err := json.Unmarshal([]byte(alertsStr), &alerts); err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("alerts not valid JSON: %q: %v", alertsStr, err)
+		}
+	}
+	var maintenanceWindows []meow.Window
+	if windowsStr := kvs[meow.FieldMaintenanceWindows]; windowsStr != "" {
+		if err := json.Unmarshal([]byte(windowsStr), &maintenanceWindows); err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("maintenance_windows not valid JSON: %q: %v", windowsStr, err)
+		}
+	}
+	var expectJSONValue json.RawMessage
+	if valueStr := kvs[meow.FieldExpectJSONValue]; valueStr != "" {
+		expectJSONValue = json.RawMessage(valueStr)
+	}
+	var retryOnStatuses []uint16
+	if statusesStr := kvs[meow.FieldRetryOnStatuses]; statusesStr != "" {
+		for _, statusStr := range strings.Split(statusesStr, ",") {
+			status, err := strconv.ParseUint(statusStr, 10, 16)
+			if err != nil {
+				return meow.EndpointPayload{}, fmt.Errorf("retry_on_statuses not a list of numbers: %q: %v", statusesStr, err)
+			}
+			retryOnStatuses = append(retryOnStatuses, uint16(status))
+		}
+	}
+	var queryParams map[string]string
+	if paramsStr := kvs[meow.FieldQueryParams]; paramsStr != "" {
+		if err := json.Unmarshal([]byte(paramsStr), &queryParams); err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("query_params not valid JSON: %q: %v", paramsStr, err)
+		}
+	}
+	var labels map[string]string
+	if labelsStr := kvs[meow.FieldLabels]; labelsStr != "" {
+		if err := json.Unmarshal([]byte(labelsStr), &labels); err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("labels not valid JSON: %q: %v", labelsStr, err)
+		}
+	}
+	var historySize uint64
+	if sizeStr := kvs[meow.FieldHistorySize]; sizeStr != "" {
+		historySize, err = strconv.ParseUint(sizeStr, 10, 16)
+		if err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("history_size not a number: %q: %v", sizeStr, err)
+		}
+	}
+	var retries uint64
+	if retriesStr := kvs[meow.FieldRetries]; retriesStr != "" {
+		retries, err = strconv.ParseUint(retriesStr, 10, 8)
+		if err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("retries not a number: %q: %v", retriesStr, err)
+		}
+	}
+	var statusClasses map[uint16]string
+	if classesStr := kvs[meow.FieldStatusClasses]; classesStr != "" {
+		if err := json.Unmarshal([]byte(classesStr), &statusClasses); err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("status_classes not valid JSON: %q: %v", classesStr, err)
+		}
+	}
+	var checkWindow *meow.Window
+	if windowStr := kvs[meow.FieldCheckWindow]; windowStr != "" {
+		if err := json.Unmarshal([]byte(windowStr), &checkWindow); err != nil {
+			return meow.EndpointPayload{}, fmt.Errorf("check_window not valid JSON: %q: %v", windowStr, err)
+		}
+	}
+
+	return meow.EndpointPayload{
+		Identifier:   id,
+		URL:          url,
+		URLs:         urls,
+		Method:       method,
+		StatusOnline: uint16(statusInt),
+		Frequency:    freq,
+		FailAfter:    uint8(failInt),
+		FailWindow:   uint8(failWindow),
+		FailRatio:    failRatio,
+		DependsOn:    dependsOn,
+		Proxy:        kvs[meow.FieldProxy],
+		UserAgent:    kvs[meow.FieldUserAgent],
+		MaxRedirects: uint8(maxRedirects),
+
+		ExpectRedirectTo: kvs[meow.FieldExpectRedirectTo],
+
+		CaptureBodyBytes: uint32(captureBodyBytes),
+		ExpectSHA256:     kvs[meow.FieldExpectSHA256],
+		AlertCooldown:    kvs[meow.FieldAlertCooldown],
+
+		Alerts:        alerts,
+		AlertTemplate: kvs[meow.FieldAlertTemplate],
+
+		MaintenanceWindows: maintenanceWindows,
+		CheckWindow:        checkWindow,
+
+		Protocol: kvs[meow.FieldProtocol],
+
+		UseHEADWhenPossible: useHEADWhenPossible,
+
+		StatusClasses: statusClasses,
+
+		RetryOnStatuses: retryOnStatuses,
+
+		ExpectJSONPath:  kvs[meow.FieldExpectJSONPath],
+		ExpectJSONValue: expectJSONValue,
+
+		Offset: kvs[meow.FieldOffset],
+
+		WebhookSecret: kvs[meow.FieldWebhookSecret],
+
+		ModifiedAt: kvs[meow.FieldModifiedAt],
+
+		NotifyOnRecovery: notifyOnRecovery,
+
+		MinBodyBytes: uint32(minBodyBytes),
+		MaxBodyBytes: uint32(maxBodyBytes),
+
+		QueryParams: queryParams,
+
+		HistorySize: uint16(historySize),
+
+		HTTPVersion: kvs[meow.FieldHTTPVersion],
+
+		Labels: labels,
+
+		Regions: regions,
+
+		Timeout: kvs[meow.FieldTimeout],
+		Retries: uint8(retries),
 	}, nil
 }
 
@@ -0,0 +1,1501 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/patrickbucher/meow"
+	"github.com/valkey-io/valkey-go"
+)
+
+func TestMain(m *testing.M) {
+	// rejected and failed requests are logged, which is expected here
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// newTestShards returns n shards of an in-memory Valkey server, which is shut
+// down once the test is done.
+func newTestShards(t *testing.T, n int) (*meow.Shards, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	// miniredis does not support client-side caching
+	options := valkey.ClientOption{InitAddress: []string{server.Addr()}, DisableCache: true}
+	shards, err := meow.NewShardsWithOptions(options, n)
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	t.Cleanup(shards.Close)
+	return shards, server
+}
+
+// handle serves the request using the handler, which is passed a context that
+// expires, so that requests to a Valkey server shut down fail quickly.
+func handle(handler func(context.Context, http.ResponseWriter, *http.Request), method, target, body string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	handler(ctx, w, r)
+	return w
+}
+
+const libvirt = `{"identifier":"libvirt","url":"https://libvirt.org/","method":"GET","status_online":200,"frequency":"1m","fail_after":3}`
+
+// postTestEndpoint stores the endpoint given as JSON, or fails the test.
+func postTestEndpoint(t *testing.T, shards *meow.Shards, body string) {
+	t.Helper()
+	var payload meow.EndpointPayload
+	if err := json.Unmarshal([]byte(body), &payload); err != nil {
+		t.Fatalf("unmarshal %s: %v", body, err)
+	}
+	w := handle(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		postEndpoint(ctx, shards, false, 0, w, r)
+	}, http.MethodPost, "/endpoints/"+payload.Identifier, body)
+	if w.Code != http.StatusCreated && w.Code != http.StatusOK {
+		t.Fatalf("post %s: got status %d", payload.Identifier, w.Code)
+	}
+}
+
+func TestGetEndpoint(t *testing.T) {
+	shards, server := newTestShards(t, 1)
+	postTestEndpoint(t, shards, libvirt)
+	get := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		getEndpoint(ctx, shards, http.StatusNotFound, w, r)
+	}
+
+	w := handle(get, http.MethodGet, "/endpoints/libvirt", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("get existing endpoint: got status %d, want %d", w.Code, http.StatusOK)
+	}
+	var payload meow.EndpointPayload
+	if err := json.Unmarshal(w.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal %s: %v", w.Body, err)
+	}
+	if payload.Identifier != "libvirt" || payload.URL != "https://libvirt.org/" || payload.FailAfter != 3 {
+		t.Errorf("got endpoint %+v", payload)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{"unknown endpoint", "/endpoints/unknown", http.StatusNotFound},
+		{"malformed identifier", "/endpoints/Libvirt", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if w := handle(get, http.MethodGet, test.target, ""); w.Code != test.want {
+				t.Errorf("got status %d, want %d", w.Code, test.want)
+			}
+		})
+	}
+
+	server.Close()
+	if w := handle(get, http.MethodGet, "/endpoints/libvirt", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("get with Valkey down: got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestPostEndpoint(t *testing.T) {
+	shards, server := newTestShards(t, 1)
+	post := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		postEndpoint(ctx, shards, false, 0, w, r)
+	}
+
+	w := handle(post, http.MethodPost, "/endpoints/libvirt", libvirt)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create endpoint: got status %d, want %d", w.Code, http.StatusCreated)
+	}
+	w = handle(post, http.MethodPost, "/endpoints/libvirt", strings.Replace(libvirt, `"fail_after":3`, `"fail_after":5`, 1))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update endpoint: got status %d, want %d", w.Code, http.StatusOK)
+	}
+	var changes map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &changes); err != nil {
+		t.Fatalf("unmarshal changes %s: %v", w.Body, err)
+	}
+	if _, ok := changes["fail_after"]; !ok || len(changes) != 1 {
+		t.Errorf("update changed %s, want only fail_after", w.Body)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		want   int
+	}{
+		{"malformed JSON", "/endpoints/libvirt", `{"identifier":`, http.StatusBadRequest},
+		{"identifier mismatch", "/endpoints/other", libvirt, http.StatusBadRequest},
+		{"invalid endpoint", "/endpoints/libvirt", strings.Replace(libvirt, `"GET"`, `"POST"`, 1), http.StatusUnprocessableEntity},
+		{"unknown dependency", "/endpoints/libvirt", strings.Replace(libvirt, `"fail_after":3`, `"fail_after":3,"depends_on":["unknown"]`, 1), http.StatusUnprocessableEntity},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if w := handle(post, http.MethodPost, test.target, test.body); w.Code != test.want {
+				t.Errorf("got status %d, want %d", w.Code, test.want)
+			}
+		})
+	}
+
+	server.Close()
+	if w := handle(post, http.MethodPost, "/endpoints/libvirt", libvirt); w.Code != http.StatusInternalServerError {
+		t.Errorf("post with Valkey down: got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestGetEndpoints(t *testing.T) {
+	shards, server := newTestShards(t, 2)
+	cache := newListingCache(0)
+	list := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		getEndpoints(ctx, shards, cache, w, r)
+	}
+
+	w := handle(list, http.MethodGet, "/endpoints", "")
+	if w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Fatalf("list no endpoints: got status %d and %s", w.Code, w.Body)
+	}
+
+	postTestEndpoint(t, shards, libvirt)
+	postTestEndpoint(t, shards, `{"identifier":"go-dev","url":"https://go.dev/","method":"HEAD","status_online":200,"frequency":"5m","fail_after":1,"labels":{"env":"prod"}}`)
+	tests := []struct {
+		name   string
+		target string
+		want   []string
+	}{
+		{"all", "/endpoints", []string{"go-dev", "libvirt"}},
+		{"by identifiers", "/endpoints?ids=libvirt", []string{"libvirt"}},
+		{"by selector", "/endpoints?selector=env%3Dprod", []string{"go-dev"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := handle(list, http.MethodGet, test.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+			}
+			var payloads []meow.EndpointPayload
+			if err := json.Unmarshal(w.Body.Bytes(), &payloads); err != nil {
+				t.Fatalf("unmarshal %s: %v", w.Body, err)
+			}
+			got := make(map[string]bool)
+			for _, payload := range payloads {
+				got[payload.Identifier] = true
+			}
+			if len(got) != len(test.want) {
+				t.Errorf("got %s, want %v", w.Body, test.want)
+			}
+			for _, identifier := range test.want {
+				if !got[identifier] {
+					t.Errorf("%s is missing in %s", identifier, w.Body)
+				}
+			}
+		})
+	}
+
+	if w := handle(list, http.MethodGet, "/endpoints?selector=env+in+()", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("malformed selector: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := handle(list, http.MethodDelete, "/endpoints", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("delete: got status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+
+	server.Close()
+	if w := handle(list, http.MethodGet, "/endpoints", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("list with Valkey down: got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestPostEndpointReset(t *testing.T) {
+	shards, server := newTestShards(t, 1)
+	postTestEndpoint(t, shards, libvirt)
+	reset := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		postEndpointReset(ctx, shards, w, r)
+	}
+	mux := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		// the identifier is a path value of the route
+		m := http.NewServeMux()
+		m.HandleFunc("POST /endpoints/{id}/reset", func(w http.ResponseWriter, r *http.Request) {
+			reset(ctx, w, r)
+		})
+		m.ServeHTTP(w, r)
+	}
+
+	if w := handle(mux, http.MethodPost, "/endpoints/libvirt/reset", ""); w.Code != http.StatusNoContent {
+		t.Errorf("reset endpoint: got status %d, want %d", w.Code, http.StatusNoContent)
+	}
+	state := server.HGet(meow.StateKey("libvirt"), meow.StateFieldState)
+	if state != meow.StateUnknown {
+		t.Errorf("state after reset is %q, want %q", state, meow.StateUnknown)
+	}
+	if w := handle(mux, http.MethodPost, "/endpoints/unknown/reset", ""); w.Code != http.StatusNotFound {
+		t.Errorf("reset unknown endpoint: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestPostReset(t *testing.T) {
+	shards, _ := newTestShards(t, 2)
+	postTestEndpoint(t, shards, strings.Replace(libvirt, `"fail_after":3`, `"fail_after":3,"labels":{"env":"prod"}`, 1))
+	postTestEndpoint(t, shards, `{"identifier":"shop-cart","url":"https://shop.example.com/cart","method":"GET","status_online":200,"frequency":"1m","fail_after":3,"labels":{"env":"prod"}}`)
+	postTestEndpoint(t, shards, `{"identifier":"shop-pay","url":"https://shop.example.com/pay","method":"GET","status_online":200,"frequency":"1m","fail_after":3,"labels":{"env":"staging"}}`)
+	identifiers := []string{"libvirt", "shop-cart", "shop-pay"}
+	reset := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		postReset(ctx, shards, w, r)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		want   []string
+	}{
+		{"no selector", "/reset", http.StatusBadRequest, nil},
+		{"by prefix", "/reset?prefix=shop-", http.StatusOK, []string{"shop-cart", "shop-pay"}},
+		{"by tag", "/reset?tag=env%3Dprod", http.StatusOK, []string{"libvirt", "shop-cart"}},
+		{"by prefix and tag", "/reset?prefix=shop-&tag=env%3Dprod", http.StatusOK, []string{"shop-cart"}},
+		{"malformed tag", "/reset?tag=env+in+()", http.StatusBadRequest, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, identifier := range identifiers {
+				vk := shards.For(identifier)
+				cmd := vk.B().Hset().Key(meow.StateKey(identifier)).FieldValue().FieldValue(meow.StateFieldState, meow.StateDown).Build()
+				if err := vk.Do(ctx, cmd).Error(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w := handle(reset, http.MethodPost, test.target, "")
+			if w.Code != test.status {
+				t.Fatalf("got status %d, want %d", w.Code, test.status)
+			}
+			if test.status == http.StatusOK {
+				if want := fmt.Sprintf(`{"reset":%d}`, len(test.want)); w.Body.String() != want {
+					t.Errorf("got %s, want %s", w.Body, want)
+				}
+			}
+			for _, identifier := range identifiers {
+				want := meow.StateDown
+				if slices.Contains(test.want, identifier) {
+					want = meow.StateUnknown
+				}
+				vk := shards.For(identifier)
+				state, err := vk.Do(ctx, vk.B().Hget().Key(meow.StateKey(identifier)).Field(meow.StateFieldState).Build()).ToString()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if state != want {
+					t.Errorf("state of %s is %q, want %q", identifier, state, want)
+				}
+			}
+		})
+	}
+}
+
+// hget returns the field of the hash at the key, which is read from the shard
+// of the endpoint the key belongs to, or fails the test.
+func hget(t *testing.T, shards *meow.Shards, key, field string) string {
+	t.Helper()
+	vk := shards.For(meow.KeyIdentifier(key))
+	value, err := vk.Do(context.Background(), vk.B().Hget().Key(key).Field(field).Build()).ToString()
+	if err != nil && !valkey.IsValkeyNil(err) {
+		t.Fatalf("hget %s %s: %v", key, field, err)
+	}
+	return value
+}
+
+func TestPostEndpointBeyondMaxEndpoints(t *testing.T) {
+	shards, _ := newTestShards(t, 2)
+	postTestEndpoint(t, shards, libvirt)
+	post := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		postEndpoint(ctx, shards, false, 2, w, r)
+	}
+
+	goDev := `{"identifier":"go-dev","url":"https://go.dev/","method":"HEAD","status_online":200,"frequency":"5m","fail_after":1}`
+	if w := handle(post, http.MethodPost, "/endpoints/go-dev", goDev); w.Code != http.StatusCreated {
+		t.Errorf("create second endpoint: got status %d, want %d", w.Code, http.StatusCreated)
+	}
+	m346 := `{"identifier":"m346","url":"https://m346.frickelbude.ch/","method":"GET","status_online":200,"frequency":"1m","fail_after":3}`
+	if w := handle(post, http.MethodPost, "/endpoints/m346", m346); w.Code != http.StatusInsufficientStorage {
+		t.Errorf("create third endpoint: got status %d, want %d", w.Code, http.StatusInsufficientStorage)
+	}
+	if w := handle(post, http.MethodPost, "/endpoints/libvirt", libvirt); w.Code != http.StatusOK {
+		t.Errorf("update existing endpoint: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestPostEndpointStoresExactFields(t *testing.T) {
+	shards, server := newTestShards(t, 1)
+	withLabels := strings.Replace(libvirt, `"fail_after":3`, `"fail_after":3,"labels":{"env":"prod"}`, 1)
+	for _, body := range []string{withLabels, libvirt} {
+		postTestEndpoint(t, shards, body)
+
+		endpoint, err := meow.EndpointFromJSON(body)
+		if err != nil {
+			t.Fatalf("parse %s: %v", body, err)
+		}
+		want := map[string]bool{meow.FieldModifiedAt: true}
+		for _, field := range endpointHashFields(endpoint) {
+			want[field.name] = true
+		}
+		stored, err := server.HKeys(meow.EndpointKey("libvirt"))
+		if err != nil {
+			t.Fatalf("get fields of stored endpoint: %v", err)
+		}
+		for _, name := range stored {
+			if name == "" {
+				t.Errorf("stored hash of %s has an empty field", body)
+			} else if !want[name] {
+				t.Errorf("stored hash of %s has unexpected field %s", body, name)
+			}
+			delete(want, name)
+		}
+		for name := range want {
+			t.Errorf("stored hash of %s lacks field %s", body, name)
+		}
+	}
+}
+
+func TestGetEndpointsCacheExpiresAndIsInvalidated(t *testing.T) {
+	shards, server := newTestShards(t, 1)
+	ttl := 100 * time.Millisecond
+	cache := newListingCache(ttl)
+	list := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		getEndpoints(ctx, shards, cache, w, r)
+	}
+	postTestEndpoint(t, shards, libvirt)
+	key := meow.EndpointKey("libvirt")
+
+	// the endpoint is changed behind the cache's back, leaving the version
+	// alone, so that only the cached listing can still hold the old method
+	changeMethod := func(method string) {
+		server.HSet(key, meow.FieldMethod, method)
+	}
+	listsMethod := func(method string) bool {
+		t.Helper()
+		w := handle(list, http.MethodGet, "/endpoints", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("list endpoints: got status %d, want %d", w.Code, http.StatusOK)
+		}
+		return strings.Contains(w.Body.String(), `"method":"`+method+`"`)
+	}
+
+	if !listsMethod(http.MethodGet) {
+		t.Fatalf("first listing lacks method %s", http.MethodGet)
+	}
+	changeMethod(http.MethodHead)
+	if !listsMethod(http.MethodGet) {
+		t.Errorf("listing within the TTL was not served from the cache")
+	}
+
+	time.Sleep(ttl + 50*time.Millisecond)
+	if !listsMethod(http.MethodHead) {
+		t.Errorf("listing after the TTL was still served from the cache")
+	}
+
+	write := cache.invalidating(func(w http.ResponseWriter, r *http.Request) {
+		changeMethod(http.MethodPost)
+	})
+	write(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/endpoints/libvirt", nil))
+	if !listsMethod(http.MethodPost) {
+		t.Errorf("listing after a write was served from the invalidated cache")
+	}
+
+	// a listing read before the cache was invalidated is not cached
+	_, generation, _ := cache.get("json", 0)
+	cache.invalidate()
+	cache.put("json", generation, 0, []byte("[]"), "application/json")
+	if _, _, ok := cache.get("json", 0); ok {
+		t.Errorf("listing read before invalidation was cached")
+	}
+}
+
+func TestGetEndpointsCacheFollowsVersion(t *testing.T) {
+	shards, _ := newTestShards(t, 1)
+	cache := newListingCache(time.Hour)
+	list := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		getEndpoints(ctx, shards, cache, w, r)
+	}
+	postTestEndpoint(t, shards, libvirt)
+	before := handle(list, http.MethodGet, "/endpoints", "")
+
+	// another instance of the config server writes without invalidating this
+	// instance's cache
+	postTestEndpoint(t, shards, `{"identifier":"go-dev","url":"https://go.dev/","method":"HEAD","status_online":200,"frequency":"5m","fail_after":1}`)
+	after := handle(list, http.MethodGet, "/endpoints", "", "If-None-Match", before.Header().Get("ETag"))
+	if after.Code != http.StatusOK {
+		t.Fatalf("list after write: got status %d, want %d", after.Code, http.StatusOK)
+	}
+	if after.Header().Get("ETag") == before.Header().Get("ETag") {
+		t.Errorf("ETag %s did not change with the write", after.Header().Get("ETag"))
+	}
+	if !strings.Contains(after.Body.String(), `"go-dev"`) {
+		t.Errorf("listing after write is stale: %s", after.Body)
+	}
+
+	unchanged := handle(list, http.MethodGet, "/endpoints", "", "If-None-Match", after.Header().Get("ETag"))
+	if unchanged.Code != http.StatusNotModified {
+		t.Errorf("list unchanged: got status %d, want %d", unchanged.Code, http.StatusNotModified)
+	}
+}
+
+func TestGetEndpointRawRedactsWebhookSecret(t *testing.T) {
+	shards, server := newTestShards(t, 1)
+	postTestEndpoint(t, shards, libvirt)
+	server.HSet(meow.EndpointKey("libvirt"), meow.FieldWebhookSecret, "s3cr3t")
+	raw := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		m := http.NewServeMux()
+		m.HandleFunc("GET /endpoints/{id}/raw", func(w http.ResponseWriter, r *http.Request) {
+			getEndpointRaw(ctx, shards, w, r)
+		})
+		m.ServeHTTP(w, r)
+	}
+
+	w := handle(raw, http.MethodGet, "/endpoints/libvirt/raw", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("get raw endpoint: got status %d, want %d", w.Code, http.StatusOK)
+	}
+	if strings.Contains(w.Body.String(), "s3cr3t") {
+		t.Errorf("raw endpoint reveals the webhook secret: %s", w.Body)
+	}
+	var kvs map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &kvs); err != nil {
+		t.Fatalf("unmarshal %s: %v", w.Body, err)
+	}
+	if got := kvs[meow.FieldWebhookSecret]; got != "redacted" {
+		t.Errorf("got webhook secret %q, want %q", got, "redacted")
+	}
+	if got := kvs[meow.FieldURL]; got != "https://libvirt.org/" {
+		t.Errorf("got url %q, want %q", got, "https://libvirt.org/")
+	}
+}
+
+func TestPostEndpointRejectsDependencyCycles(t *testing.T) {
+	shards, _ := newTestShards(t, 2)
+	post := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		problemDetails(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			postEndpoint(ctx, shards, false, 0, w, r)
+		})).ServeHTTP(w, r)
+	}
+	endpoint := func(identifier string, dependsOn ...string) string {
+		deps, _ := json.Marshal(dependsOn)
+		return fmt.Sprintf(`{"identifier":"%s","url":"https://%s.example.com/","method":"GET","status_online":200,"frequency":"1m","fail_after":1,"depends_on":%s}`,
+			identifier, identifier, deps)
+	}
+	postTestEndpoint(t, shards, endpoint("gateway"))
+	postTestEndpoint(t, shards, endpoint("database", "gateway"))
+	postTestEndpoint(t, shards, endpoint("backend", "database"))
+	postTestEndpoint(t, shards, endpoint("frontend", "backend", "gateway"))
+
+	tests := []struct {
+		name       string
+		identifier string
+		dependsOn  []string
+		status     int
+		problem    string
+	}{
+		{"missing dependency", "gateway", []string{"dns"}, http.StatusUnprocessableEntity, `dependency "dns" does not exist`},
+		{"long cycle", "gateway", []string{"frontend"}, http.StatusUnprocessableEntity, "gateway -> frontend -> backend -> database -> gateway"},
+		{"short cycle", "database", []string{"backend"}, http.StatusUnprocessableEntity, "database -> backend -> database"},
+		{"diamond", "monitoring", []string{"frontend", "backend"}, http.StatusCreated, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := endpoint(test.identifier, test.dependsOn...)
+			w := handle(post, http.MethodPost, "/endpoints/"+test.identifier, body, "Accept", problemMediaType)
+			if w.Code != test.status {
+				t.Fatalf("got status %d, want %d", w.Code, test.status)
+			}
+			if test.problem == "" {
+				return
+			}
+			var p problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatalf("unmarshal problem %s: %v", w.Body, err)
+			}
+			if !strings.HasSuffix(p.Detail, test.problem) || p.Field != "depends_on" {
+				t.Errorf("got problem %q with field %q, want %q with field depends_on", p.Detail, p.Field, test.problem)
+			}
+		})
+	}
+}
+
+func TestListenOnSocket(t *testing.T) {
+	// the path of a socket is limited to about a hundred bytes
+	dir, err := os.MkdirTemp("", "meow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config.txt")
+	if err := os.WriteFile(file, []byte("keep me"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := listen(file, ""); err == nil {
+		l.Close()
+		t.Errorf("listened on regular file %s, want an error", file)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("regular file given as socket was removed: %v", err)
+	}
+
+	socket := filepath.Join(dir, "config.sock")
+	l, err := listen(socket, "")
+	if err != nil {
+		t.Fatalf("listen on %s: %v", socket, err)
+	}
+	// leave the socket behind like a crashed server
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	l, err = listen(socket, "")
+	if err != nil {
+		t.Fatalf("listen on stale socket %s: %v", socket, err)
+	}
+	defer l.Close()
+
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	resp, err := client.Get("http://config/healthz")
+	if err != nil {
+		t.Fatalf("request over socket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("got status %d over socket, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+}
+
+func TestGetEndpointHistoryAsCSV(t *testing.T) {
+	shards, _ := newTestShards(t, 1)
+	postTestEndpoint(t, shards, libvirt)
+	at := time.Date(2025, 11, 20, 17, 3, 12, 500_000_000, time.UTC)
+	failures := []meow.Failure{
+		{At: at.Add(-time.Hour), Status: 503, LatencyMS: 87, Reason: meow.ReasonStatus},
+		{At: at, Reason: meow.ReasonTimeout, URL: "https://libvirt.org/", FailoverURL: "https://mirror.libvirt.org/"},
+	}
+	for _, failure := range failures {
+		if err := meow.RecordFailure(context.Background(), shards.For("libvirt"), "libvirt", 0, failure); err != nil {
+			t.Fatalf("record failure: %v", err)
+		}
+	}
+	history := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		m := http.NewServeMux()
+		m.HandleFunc("GET /endpoints/{id}/history", func(w http.ResponseWriter, r *http.Request) {
+			getEndpointHistory(ctx, shards, w, r)
+		})
+		m.ServeHTTP(w, r)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"all", "/endpoints/libvirt/history", "timestamp,status_code,latency_ms,failover_url\n" +
+			"2025-11-20T17:03:12.5Z,0,,https://mirror.libvirt.org/\n" +
+			"2025-11-20T16:03:12.5Z,503,87,\n"},
+		{"since", "/endpoints/libvirt/history?since=2025-11-20T17:00:00Z", "timestamp,status_code,latency_ms,failover_url\n" +
+			"2025-11-20T17:03:12.5Z,0,,https://mirror.libvirt.org/\n"},
+		{"none", "/endpoints/libvirt/history?since=2025-11-21T00:00:00Z", "timestamp,status_code,latency_ms,failover_url\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := handle(history, http.MethodGet, test.target, "", "Accept", "text/csv")
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != "text/csv; charset=utf-8" {
+				t.Errorf("got content type %q, want CSV", contentType)
+			}
+			if body := w.Body.String(); body != test.want {
+				t.Errorf("got CSV\n%s\nwant\n%s", body, test.want)
+			}
+		})
+	}
+
+	w := handle(history, http.MethodGet, "/endpoints/libvirt/history", "")
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("without Accept header: got content type %q, want JSON", contentType)
+	}
+}
+
+func TestGetEndpointsStreamsMarshaledSlice(t *testing.T) {
+	shards, _ := newTestShards(t, 2)
+	list := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		getEndpoints(ctx, shards, newListingCache(0), w, r)
+	}
+
+	// an empty listing is an empty array rather than null
+	payloads := []meow.EndpointPayload{}
+	bodies := []string{
+		libvirt,
+		`{"identifier":"go-dev","url":"https://go.dev/","method":"HEAD","status_online":200,"frequency":"5m","fail_after":1,"labels":{"env":"prod"}}`,
+		`{"identifier":"m346","url":"https://m346.frickelbude.ch/","method":"GET","status_online":200,"frequency":"1m","fail_window":10,"fail_ratio":0.5,"depends_on":["libvirt"]}`,
+	}
+	for i := 0; i <= len(bodies); i++ {
+		if i > 0 {
+			postTestEndpoint(t, shards, bodies[i-1])
+		}
+		payloads = payloads[:0]
+		for payload, err := range allPayloads(context.Background(), shards) {
+			if err != nil {
+				t.Fatalf("get payloads: %v", err)
+			}
+			payloads = append(payloads, payload)
+		}
+		for _, pretty := range []bool{false, true} {
+			want, err := marshalJSON(payloads, "", pretty)
+			if err != nil {
+				t.Fatalf("marshal payloads: %v", err)
+			}
+			w := handle(list, http.MethodGet, fmt.Sprintf("/endpoints?pretty=%t", pretty), "")
+			if got := w.Body.String(); got != string(want) {
+				t.Errorf("%d endpoints (pretty: %t): streamed\n%s\nwant\n%s", len(payloads), pretty, got, want)
+			}
+		}
+	}
+}
+
+func TestCloneEndpoint(t *testing.T) {
+	shards, _ := newTestShards(t, 2)
+	postTestEndpoint(t, shards, libvirt)
+	postTestEndpoint(t, shards, `{"identifier":"go-dev","url":"https://go.dev/","method":"HEAD","status_online":200,"frequency":"5m","fail_after":1}`)
+	clone := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		m := http.NewServeMux()
+		m.HandleFunc("POST /endpoints/{id}/clone", func(w http.ResponseWriter, r *http.Request) {
+			cloneEndpoint(ctx, shards, 0, w, r)
+		})
+		m.ServeHTTP(w, r)
+	}
+
+	body := `{"identifier":"libvirt-staging","url":"https://staging.libvirt.org/","fail_after":5}`
+	if w := handle(clone, http.MethodPost, "/endpoints/libvirt/clone", body); w.Code != http.StatusCreated {
+		t.Fatalf("clone endpoint: got status %d, want %d", w.Code, http.StatusCreated)
+	}
+	want := map[string]string{
+		meow.FieldIdentifier:   "libvirt-staging",
+		meow.FieldURL:          "https://staging.libvirt.org/",
+		meow.FieldFailAfter:    "5",
+		meow.FieldMethod:       "GET",
+		meow.FieldStatusOnline: "200",
+		meow.FieldFrequency:    "1m0s",
+	}
+	for field, value := range want {
+		if got := hget(t, shards, meow.EndpointKey("libvirt-staging"), field); got != value {
+			t.Errorf("%s of clone: got %q, want %q", field, got, value)
+		}
+	}
+	if got := hget(t, shards, meow.EndpointKey("libvirt"), meow.FieldURL); got != "https://libvirt.org/" {
+		t.Errorf("URL of source after cloning: got %q, want it unchanged", got)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		status int
+	}{
+		{"existing target", "/endpoints/libvirt/clone", `{"identifier":"go-dev","url":"https://staging.go.dev/"}`, http.StatusConflict},
+		{"source as target", "/endpoints/libvirt/clone", `{"identifier":"libvirt"}`, http.StatusConflict},
+		{"unknown source", "/endpoints/unknown/clone", `{"identifier":"unknown-staging"}`, http.StatusNotFound},
+		{"lacking identifier", "/endpoints/libvirt/clone", `{"url":"https://staging.libvirt.org/"}`, http.StatusBadRequest},
+		{"invalid override", "/endpoints/libvirt/clone", `{"identifier":"libvirt-dev","method":"BREW"}`, http.StatusUnprocessableEntity},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if w := handle(clone, http.MethodPost, test.target, test.body); w.Code != test.status {
+				t.Errorf("got status %d, want %d", w.Code, test.status)
+			}
+		})
+	}
+	if got := hget(t, shards, meow.EndpointKey("go-dev"), meow.FieldURL); got != "https://go.dev/" {
+		t.Errorf("URL of conflicting target: got %q, want it unchanged", got)
+	}
+}
+
+func TestPostEndpointCreateOnly(t *testing.T) {
+	updated := strings.Replace(libvirt, `"fail_after":3`, `"fail_after":5`, 1)
+	tests := []struct {
+		createOnly bool
+		status     int
+		failAfter  string
+	}{
+		{false, http.StatusOK, "5"},
+		{true, http.StatusConflict, "3"},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("create only: %t", test.createOnly), func(t *testing.T) {
+			shards, _ := newTestShards(t, 1)
+			post := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+				postEndpoint(ctx, shards, test.createOnly, 0, w, r)
+			}
+			put := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+				putEndpoint(ctx, shards, 0, w, r)
+			}
+
+			if w := handle(post, http.MethodPost, "/endpoints/libvirt", libvirt); w.Code != http.StatusCreated {
+				t.Errorf("post new endpoint: got status %d, want %d", w.Code, http.StatusCreated)
+			}
+			if w := handle(post, http.MethodPost, "/endpoints/libvirt", updated); w.Code != test.status {
+				t.Errorf("post existing endpoint: got status %d, want %d", w.Code, test.status)
+			}
+			if got := hget(t, shards, meow.EndpointKey("libvirt"), meow.FieldFailAfter); got != test.failAfter {
+				t.Errorf("fail_after after posting existing endpoint: got %q, want %q", got, test.failAfter)
+			}
+
+			// PUT updates an existing endpoint in both modes
+			replaced := strings.Replace(libvirt, `"fail_after":3`, `"fail_after":7`, 1)
+			if w := handle(put, http.MethodPut, "/endpoints/libvirt", replaced); w.Code != http.StatusOK {
+				t.Errorf("put existing endpoint: got status %d, want %d", w.Code, http.StatusOK)
+			}
+			if got := hget(t, shards, meow.EndpointKey("libvirt"), meow.FieldFailAfter); got != "7" {
+				t.Errorf("fail_after after putting existing endpoint: got %q, want %q", got, "7")
+			}
+		})
+	}
+}
+
+func TestGetEndpointsAsCSV(t *testing.T) {
+	shards, _ := newTestShards(t, 2)
+	cache := newListingCache(time.Minute)
+	list := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		getEndpoints(ctx, shards, cache, w, r)
+	}
+	postTestEndpoint(t, shards, libvirt)
+	postTestEndpoint(t, shards, `{"identifier":"go-dev","url":"https://go.dev/doc/","method":"HEAD","status_online":200,"frequency":"5m","fail_after":1,"depends_on":["libvirt"],"labels":{"env":"prod","tier":"web"}}`)
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		want   string
+	}{
+		{"default columns", "/endpoints", http.StatusOK, "identifier,url,method,status_online,frequency,fail_after\n" +
+			"go-dev,https://go.dev/doc/,HEAD,200,5m0s,1\n" +
+			"libvirt,https://libvirt.org/,GET,200,1m0s,3\n"},
+		{"selected columns", "/endpoints?columns=identifier,depends_on,labels", http.StatusOK, "identifier,depends_on,labels\n" +
+			"go-dev,libvirt,\"env=prod,tier=web\"\n" +
+			"libvirt,,\n"},
+		{"selected columns by identifiers", "/endpoints?ids=libvirt&columns=frequency,identifier", http.StatusOK, "frequency,identifier\n" +
+			"1m0s,libvirt\n"},
+		{"unknown column", "/endpoints?columns=identifier,secret", http.StatusBadRequest, ""},
+		{"webhook secret", "/endpoints?columns=webhook_secret", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := handle(list, http.MethodGet, test.target, "", "Accept", "text/csv")
+			if w.Code != test.status {
+				t.Fatalf("got status %d, want %d", w.Code, test.status)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != "text/csv; charset=utf-8" {
+				t.Errorf("got content type %q, want CSV", contentType)
+			}
+			if body := w.Body.String(); body != test.want {
+				t.Errorf("got CSV\n%s\nwant\n%s", body, test.want)
+			}
+		})
+	}
+}
+
+func TestUpdateEndpointRemovesClearedFields(t *testing.T) {
+	withOptionals := strings.Replace(libvirt, `"fail_after":3`,
+		`"fail_after":3,"proxy":"http://proxy.example.com:3128","labels":{"env":"prod"},"retry_on_statuses":[503]`, 1)
+	cleared := []string{meow.FieldProxy, meow.FieldLabels, meow.FieldRetryOnStatuses}
+	updates := map[string]func(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request){
+		http.MethodPost: func(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+			postEndpoint(ctx, shards, false, 0, w, r)
+		},
+		http.MethodPut: func(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+			putEndpoint(ctx, shards, 0, w, r)
+		},
+	}
+	for method, update := range updates {
+		t.Run(method, func(t *testing.T) {
+			shards, server := newTestShards(t, 1)
+			postTestEndpoint(t, shards, withOptionals)
+			for _, field := range cleared {
+				if hget(t, shards, meow.EndpointKey("libvirt"), field) == "" {
+					t.Fatalf("field %s was not stored", field)
+				}
+			}
+
+			w := handle(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+				update(ctx, shards, w, r)
+			}, method, "/endpoints/libvirt", libvirt)
+			if w.Code != http.StatusOK {
+				t.Fatalf("update endpoint: got status %d, want %d", w.Code, http.StatusOK)
+			}
+			stored, err := server.HKeys(meow.EndpointKey("libvirt"))
+			if err != nil {
+				t.Fatalf("get fields of stored endpoint: %v", err)
+			}
+			for _, field := range cleared {
+				if slices.Contains(stored, field) {
+					t.Errorf("field %s cleared by %s is still stored", field, method)
+				}
+			}
+			if !slices.Contains(stored, meow.FieldFailAfter) {
+				t.Errorf("field %s kept by %s was removed", meow.FieldFailAfter, method)
+			}
+		})
+	}
+}
+
+func TestIdempotentPostReplaysResponse(t *testing.T) {
+	shards, _ := newTestShards(t, 2)
+	idempotent := &idempotency{shards: shards, ttl: time.Hour}
+	var processed int
+	failing := true
+	post := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		idempotent.wrap(func(w http.ResponseWriter, r *http.Request) {
+			processed++
+			if strings.Contains(r.URL.Path, "go-dev") && failing {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			postEndpoint(ctx, shards, true, 0, w, r)
+		})(w, r)
+	}
+
+	first := handle(post, http.MethodPost, "/endpoints/libvirt", libvirt, "Idempotency-Key", "k1")
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first post: got status %d, want %d", first.Code, http.StatusCreated)
+	}
+	// without the Idempotency-Key, the endpoint would conflict with itself
+	replayed := handle(post, http.MethodPost, "/endpoints/libvirt", libvirt, "Idempotency-Key", "k1")
+	if replayed.Code != first.Code || replayed.Body.String() != first.Body.String() {
+		t.Errorf("replayed post: got status %d and %q, want %d and %q", replayed.Code, replayed.Body, first.Code, first.Body)
+	}
+	if replayed.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("replayed post lacks the Idempotent-Replayed header")
+	}
+	if processed != 1 {
+		t.Errorf("processed %d posts, want 1", processed)
+	}
+
+	changed := strings.Replace(libvirt, `"fail_after":3`, `"fail_after":5`, 1)
+	if w := handle(post, http.MethodPost, "/endpoints/libvirt", changed, "Idempotency-Key", "k1"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("post of another body: got status %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+
+	// keys are scoped per endpoint, and failures on our side can be retried
+	goDev := `{"identifier":"go-dev","url":"https://go.dev/","method":"HEAD","status_online":200,"frequency":"5m","fail_after":1}`
+	if w := handle(post, http.MethodPost, "/endpoints/go-dev", goDev, "Idempotency-Key", "k1"); w.Code != http.StatusInternalServerError {
+		t.Errorf("failing post: got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	failing = false
+	if w := handle(post, http.MethodPost, "/endpoints/go-dev", goDev, "Idempotency-Key", "k1"); w.Code != http.StatusCreated {
+		t.Errorf("retried post: got status %d, want %d", w.Code, http.StatusCreated)
+	}
+	if processed != 3 {
+		t.Errorf("processed %d posts, want 3", processed)
+	}
+}
+
+func TestGetEndpointNaming(t *testing.T) {
+	shards, _ := newTestShards(t, 1)
+	postTestEndpoint(t, shards, libvirt)
+	get := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		getEndpoint(ctx, shards, http.StatusNotFound, w, r)
+	}
+	list := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		getEndpoints(ctx, shards, newListingCache(time.Minute), w, r)
+	}
+
+	tests := []struct {
+		name    string
+		handler func(context.Context, http.ResponseWriter, *http.Request)
+		target  string
+		want    string
+		unwant  string
+	}{
+		{"snake_case by default", get, "/endpoints/libvirt", `"status_online":200,"frequency":"1m0s","fail_after":3`, `"statusOnline"`},
+		{"camelCase", get, "/endpoints/libvirt?naming=camelCase", `"statusOnline":200,"frequency":"1m0s","failAfter":3`, `"status_online"`},
+		{"listing in snake_case", list, "/endpoints", `"fail_after":3`, `"failAfter"`},
+		{"listing in camelCase", list, "/endpoints?naming=camelCase", `"failAfter":3`, `"fail_after"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := handle(test.handler, http.MethodGet, test.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+			}
+			if body := w.Body.String(); !strings.Contains(body, test.want) || strings.Contains(body, test.unwant) {
+				t.Errorf("got %s, want it to contain %s but not %s", body, test.want, test.unwant)
+			}
+		})
+	}
+}
+
+func TestGetEndpointsModifiedSince(t *testing.T) {
+	shards, server := newTestShards(t, 1)
+	list := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		getEndpoints(ctx, shards, newListingCache(time.Minute), w, r)
+	}
+	postTestEndpoint(t, shards, libvirt)
+	postTestEndpoint(t, shards, `{"identifier":"go-dev","url":"https://go.dev/","method":"HEAD","status_online":200,"frequency":"5m","fail_after":1}`)
+	postTestEndpoint(t, shards, `{"identifier":"legacy","url":"https://legacy.example.com/","method":"GET","status_online":200,"frequency":"5m","fail_after":1}`)
+	server.HSet(meow.EndpointKey("libvirt"), meow.FieldModifiedAt, "2026-01-01T00:00:00Z")
+	server.HSet(meow.EndpointKey("go-dev"), meow.FieldModifiedAt, "2026-10-01T12:00:00.5Z")
+	// endpoints stored before modified_at was maintained are always listed
+	server.HDel(meow.EndpointKey("legacy"), meow.FieldModifiedAt)
+
+	tests := []struct {
+		since string
+		want  []string
+	}{
+		{"2025-12-31T23:59:59Z", []string{"go-dev", "legacy", "libvirt"}},
+		{"2026-01-01T00:00:00Z", []string{"go-dev", "legacy"}},
+		{"2026-10-01T12:00:00Z", []string{"go-dev", "legacy"}},
+		{"2026-10-01T12:00:01Z", []string{"legacy"}},
+	}
+	for _, test := range tests {
+		t.Run(test.since, func(t *testing.T) {
+			w := handle(list, http.MethodGet, "/endpoints?modified_since="+test.since, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+			}
+			var payloads []meow.EndpointPayload
+			if err := json.Unmarshal(w.Body.Bytes(), &payloads); err != nil {
+				t.Fatalf("unmarshal %s: %v", w.Body, err)
+			}
+			var got []string
+			for _, payload := range payloads {
+				got = append(got, payload.Identifier)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got endpoints %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	if w := handle(list, http.MethodGet, "/endpoints?modified_since=yesterday", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid modified_since: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestDeleteEndpointHistory(t *testing.T) {
+	shards, _ := newTestShards(t, 2)
+	postTestEndpoint(t, shards, libvirt)
+	ctx := context.Background()
+	failure := meow.Failure{At: time.Date(2025, 11, 20, 17, 3, 12, 0, time.UTC), Status: 503, Reason: meow.ReasonStatus}
+	if err := meow.RecordFailure(ctx, shards.For("libvirt"), "libvirt", 0, failure); err != nil {
+		t.Fatalf("record failure: %v", err)
+	}
+	vk := shards.For("libvirt")
+	if err := vk.Do(ctx, vk.B().Hset().Key(meow.StateKey("libvirt")).FieldValue().FieldValue(meow.StateFieldState, meow.StateDown).Build()).Error(); err != nil {
+		t.Fatalf("set state: %v", err)
+	}
+	history := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		m := http.NewServeMux()
+		m.HandleFunc("GET /endpoints/{id}/history", func(w http.ResponseWriter, r *http.Request) {
+			getEndpointHistory(ctx, shards, w, r)
+		})
+		m.HandleFunc("DELETE /endpoints/{id}/history", requireAdminToken("admin", "", func(w http.ResponseWriter, r *http.Request) {
+			deleteEndpointHistory(ctx, shards, w, r)
+		}))
+		m.ServeHTTP(w, r)
+	}
+	csv := func() string {
+		t.Helper()
+		w := handle(history, http.MethodGet, "/endpoints/libvirt/history", "", "Accept", "text/csv")
+		if w.Code != http.StatusOK {
+			t.Fatalf("get history: got status %d, want %d", w.Code, http.StatusOK)
+		}
+		return w.Body.String()
+	}
+	const header = "timestamp,status_code,latency_ms,failover_url\n"
+	if got := csv(); got == header {
+		t.Fatal("history is empty before deleting it")
+	}
+
+	if w := handle(history, http.MethodDelete, "/endpoints/libvirt/history", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("delete without admin token: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := handle(history, http.MethodDelete, "/endpoints/go-dev/history", "", "Authorization", "Bearer admin"); w.Code != http.StatusNotFound {
+		t.Errorf("delete history of missing endpoint: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := handle(history, http.MethodDelete, "/endpoints/libvirt/history", "", "Authorization", "Bearer admin"); w.Code != http.StatusNoContent {
+		t.Fatalf("delete history: got status %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if got := csv(); got != header {
+		t.Errorf("got history %q after deleting it, want none", got)
+	}
+	if got := hget(t, shards, meow.EndpointKey("libvirt"), meow.FieldURL); got != "https://libvirt.org/" {
+		t.Errorf("got URL %q after deleting the history, want the endpoint kept", got)
+	}
+	if got := hget(t, shards, meow.StateKey("libvirt"), meow.StateFieldState); got != meow.StateDown {
+		t.Errorf("got state %q after deleting the history, want it kept", got)
+	}
+}
+
+func TestProblemDetails(t *testing.T) {
+	shards, _ := newTestShards(t, 1)
+	serve := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		m := http.NewServeMux()
+		m.HandleFunc("POST /endpoints/{id}", func(w http.ResponseWriter, r *http.Request) {
+			postEndpoint(ctx, shards, false, 0, w, r)
+		})
+		m.HandleFunc("GET /endpoints/{id}", func(w http.ResponseWriter, r *http.Request) {
+			getEndpoint(ctx, shards, http.StatusNotFound, w, r)
+		})
+		problemDetails(m).ServeHTTP(w, r)
+	}
+	invalid := strings.Replace(libvirt, `"frequency":"1m"`, `"frequency":"often"`, 1)
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		status  int
+		problem map[string]any
+	}{
+		{"validation", http.MethodPost, "/endpoints/libvirt", invalid, http.StatusUnprocessableEntity, map[string]any{
+			"type": "about:blank", "title": "Unprocessable Entity", "status": 422.0,
+			"detail": `parse JSON body: "often" is not a valid duration`, "field": "frequency",
+		}},
+		{"not found", http.MethodGet, "/endpoints/go-dev", "", http.StatusNotFound, map[string]any{
+			"type": "about:blank", "title": "Not Found", "status": 404.0,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := handle(serve, test.method, test.target, test.body, "Accept", problemMediaType)
+			if w.Code != test.status {
+				t.Fatalf("got status %d, want %d", w.Code, test.status)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != problemMediaType {
+				t.Errorf("got content type %q, want %q", contentType, problemMediaType)
+			}
+			var p map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatalf("unmarshal problem %s: %v", w.Body, err)
+			}
+			if len(p) != len(test.problem) {
+				t.Errorf("got problem %v, want %v", p, test.problem)
+			}
+			for member, want := range test.problem {
+				if p[member] != want {
+					t.Errorf("got %s %v, want %v", member, p[member], want)
+				}
+			}
+
+			// clients not accepting problem details get the plain response
+			w = handle(serve, test.method, test.target, test.body)
+			if w.Code != test.status || w.Header().Get("Content-Type") == problemMediaType {
+				t.Errorf("without Accept header: got status %d and content type %q", w.Code, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	postTestEndpoint(t, shards, libvirt)
+	w := handle(serve, http.MethodGet, "/endpoints/libvirt", "", "Accept", problemMediaType)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"identifier":"libvirt"`) {
+		t.Errorf("successful response: got status %d and %s", w.Code, w.Body)
+	}
+}
+
+func TestPostEndpointCAS(t *testing.T) {
+	shards, _ := newTestShards(t, 2)
+	postTestEndpoint(t, shards, libvirt)
+	cas := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		m := http.NewServeMux()
+		m.HandleFunc("POST /endpoints/{id}/cas", func(w http.ResponseWriter, r *http.Request) {
+			postEndpointCAS(ctx, shards, w, r)
+		})
+		m.ServeHTTP(w, r)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		status int
+		want   string
+	}{
+		{"set", "/endpoints/libvirt/cas", `{"field":"frequency","expected":"1m0s","new":"5m"}`, http.StatusOK, "5m0s"},
+		{"stale expectation", "/endpoints/libvirt/cas", `{"field":"frequency","expected":"1m0s","new":"10m"}`, http.StatusConflict, "5m0s"},
+		{"invalid value", "/endpoints/libvirt/cas", `{"field":"frequency","expected":"5m0s","new":"often"}`, http.StatusUnprocessableEntity, "5m0s"},
+		{"identifier", "/endpoints/libvirt/cas", `{"field":"identifier","expected":"libvirt","new":"qemu"}`, http.StatusUnprocessableEntity, "5m0s"},
+		{"missing endpoint", "/endpoints/go-dev/cas", `{"field":"frequency","expected":"1m0s","new":"5m"}`, http.StatusNotFound, "5m0s"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := handle(cas, http.MethodPost, test.target, test.body)
+			if w.Code != test.status {
+				t.Fatalf("got status %d, want %d", w.Code, test.status)
+			}
+			if got := hget(t, shards, meow.EndpointKey("libvirt"), meow.FieldFrequency); got != test.want {
+				t.Errorf("got frequency %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	// of concurrent swaps expecting the same value, only one succeeds
+	var mu sync.Mutex
+	statuses := make(map[int]int)
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Go(func() {
+			body := fmt.Sprintf(`{"field":"fail_after","expected":"3","new":"%d"}`, i+4)
+			w := handle(cas, http.MethodPost, "/endpoints/libvirt/cas", body)
+			mu.Lock()
+			statuses[w.Code]++
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	if statuses[http.StatusOK] != 1 || statuses[http.StatusConflict] != 7 {
+		t.Errorf("got statuses %v of concurrent swaps, want one success and conflicts otherwise", statuses)
+	}
+
+	// a field not set is expected to be empty, and removed by setting it empty
+	w := handle(cas, http.MethodPost, "/endpoints/libvirt/cas", `{"field":"proxy","expected":"","new":"http://proxy.example.com:3128"}`)
+	if w.Code != http.StatusOK || hget(t, shards, meow.EndpointKey("libvirt"), meow.FieldProxy) != "http://proxy.example.com:3128" {
+		t.Errorf("set unset field: got status %d", w.Code)
+	}
+	w = handle(cas, http.MethodPost, "/endpoints/libvirt/cas", `{"field":"proxy","expected":"http://proxy.example.com:3128","new":""}`)
+	if w.Code != http.StatusOK || hget(t, shards, meow.EndpointKey("libvirt"), meow.FieldProxy) != "" {
+		t.Errorf("remove field: got status %d", w.Code)
+	}
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	shards, server := newTestShards(t, 2)
+	ctx := context.Background()
+	const keep = 2
+	postTestEndpoint(t, shards, libvirt)
+	first, err := takeSnapshot(ctx, shards, keep)
+	if err != nil || first == nil || first.Endpoints != 1 {
+		t.Fatalf("take first snapshot: got %+v (%v), want one of a single endpoint", first, err)
+	}
+	if again, err := takeSnapshot(ctx, shards, keep); err != nil || again != nil {
+		t.Errorf("take snapshot of unchanged endpoints: got %+v (%v), want none", again, err)
+	}
+	postTestEndpoint(t, shards, `{"identifier":"go-dev","url":"https://go.dev/","method":"HEAD","status_online":200,"frequency":"5m","fail_after":1}`)
+	second, err := takeSnapshot(ctx, shards, keep)
+	if err != nil || second == nil || second.Endpoints != 2 || second.Version <= first.Version {
+		t.Fatalf("take second snapshot: got %+v (%v), want a later one of two endpoints", second, err)
+	}
+
+	snapshots := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		m := http.NewServeMux()
+		m.HandleFunc("GET /snapshots", func(w http.ResponseWriter, r *http.Request) {
+			getSnapshots(ctx, shards, w, r)
+		})
+		m.HandleFunc("POST /snapshots/{version}/restore", requireAdminToken("admin", "", func(w http.ResponseWriter, r *http.Request) {
+			postSnapshotRestore(ctx, shards, keep, w, r)
+		}))
+		m.ServeHTTP(w, r)
+	}
+	versions := func() []int64 {
+		t.Helper()
+		w := handle(snapshots, http.MethodGet, "/snapshots", "")
+		var listed []snapshot
+		if err := json.Unmarshal(w.Body.Bytes(), &listed); w.Code != http.StatusOK || err != nil {
+			t.Fatalf("get snapshots: got status %d, body %s (%v)", w.Code, w.Body, err)
+		}
+		var versions []int64
+		for _, s := range listed {
+			versions = append(versions, s.Version)
+		}
+		return versions
+	}
+	if got, want := versions(), []int64{second.Version, first.Version}; !slices.Equal(got, want) {
+		t.Errorf("got snapshots of versions %v, want most recent first %v", got, want)
+	}
+
+	restore := fmt.Sprintf("/snapshots/%d/restore", first.Version)
+	if w := handle(snapshots, http.MethodPost, restore, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("restore without admin token: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := handle(snapshots, http.MethodPost, "/snapshots/latest/restore", "", "Authorization", "Bearer admin"); w.Code != http.StatusBadRequest {
+		t.Errorf("restore invalid version: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := handle(snapshots, http.MethodPost, "/snapshots/999/restore", "", "Authorization", "Bearer admin"); w.Code != http.StatusNotFound {
+		t.Errorf("restore missing snapshot: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	w := handle(snapshots, http.MethodPost, restore, "", "Authorization", "Bearer admin")
+	var result applyResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("restore snapshot: got status %d, body %s (%v)", w.Code, w.Body, err)
+	}
+	if !slices.Equal(result.Deleted, []string{"go-dev"}) || len(result.Created)+len(result.Updated) > 0 {
+		t.Errorf("restore snapshot: got result %+v, want go-dev deleted only", result)
+	}
+	if got := hget(t, shards, meow.EndpointKey("go-dev"), meow.FieldURL); got != "" {
+		t.Errorf("got URL %q of go-dev after restoring, want it deleted", got)
+	}
+	if got := hget(t, shards, meow.EndpointKey("libvirt"), meow.FieldURL); got != "https://libvirt.org/" {
+		t.Errorf("got URL %q of libvirt after restoring, want it kept", got)
+	}
+
+	// the restore is a change of its own, so that the oldest snapshot is
+	// trimmed once the restored endpoints are snapshotted
+	third, err := takeSnapshot(ctx, shards, keep)
+	if err != nil || third == nil || third.Endpoints != 1 {
+		t.Fatalf("take snapshot after restore: got %+v (%v), want one of a single endpoint", third, err)
+	}
+	if got, want := versions(), []int64{third.Version, second.Version}; !slices.Equal(got, want) {
+		t.Errorf("got snapshots of versions %v, want %v", got, want)
+	}
+	if server.Exists(snapshotKey(first.Version)) {
+		t.Errorf("snapshot %s was kept beyond the %d most recent", snapshotKey(first.Version), keep)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []int64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}
+	tests := []struct {
+		values []int64
+		p      float64
+		want   int64
+	}{
+		{nil, 50, 0},
+		{[]int64{42}, 99, 42},
+		{sorted, 0, 10},
+		{sorted, 50, 50},
+		{sorted, 95, 100},
+		{sorted, 100, 100},
+		{sorted[:4], 50, 20},
+		{sorted[:4], 51, 30},
+	}
+	for _, test := range tests {
+		if got := percentile(test.values, test.p); got != test.want {
+			t.Errorf("percentile %v of %v: got %d, want %d", test.p, test.values, got, test.want)
+		}
+	}
+}
+
+func TestGetEndpointLatency(t *testing.T) {
+	shards, _ := newTestShards(t, 2)
+	postTestEndpoint(t, shards, libvirt)
+	ctx := context.Background()
+	now := time.Now()
+	for i := range 100 {
+		at := now.Add(-time.Duration(i) * time.Second)
+		if err := meow.RecordLatency(ctx, shards.For("libvirt"), "libvirt", at, time.Duration(i+1)*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := meow.RecordLatency(ctx, shards.For("libvirt"), "libvirt", now.Add(-2*time.Hour), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	latency := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		m := http.NewServeMux()
+		m.HandleFunc("GET /endpoints/{id}/latency", func(w http.ResponseWriter, r *http.Request) {
+			getEndpointLatency(ctx, shards, w, r)
+		})
+		m.ServeHTTP(w, r)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		want   latencyReport
+	}{
+		{"default window", "/endpoints/libvirt/latency", latencyReport{Window: "1h0m0s", Samples: 100, P50: 50, P95: 95, P99: 99}},
+		{"wider window", "/endpoints/libvirt/latency?window=3h", latencyReport{Window: "3h0m0s", Samples: 101, P50: 51, P95: 96, P99: 100}},
+		{"window without checks", "/endpoints/libvirt/latency?window=1ns", latencyReport{Window: "1ns"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := handle(latency, http.MethodGet, test.target, "")
+			var got latencyReport
+			if err := json.Unmarshal(w.Body.Bytes(), &got); w.Code != http.StatusOK || err != nil {
+				t.Fatalf("get %s: got status %d, body %s (%v)", test.target, w.Code, w.Body, err)
+			}
+			if got != test.want {
+				t.Errorf("got report %+v, want %+v", got, test.want)
+			}
+		})
+	}
+
+	for target, status := range map[string]int{
+		"/endpoints/go-dev/latency":             http.StatusNotFound,
+		"/endpoints/libvirt/latency?window=1d":  http.StatusBadRequest,
+		"/endpoints/libvirt/latency?window=-1h": http.StatusBadRequest,
+		"/endpoints/libvirt/latency?window=25h": http.StatusBadRequest,
+	} {
+		if w := handle(latency, http.MethodGet, target, ""); w.Code != status {
+			t.Errorf("get %s: got status %d, want %d", target, w.Code, status)
+		}
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	if err := checkSchema(); err != nil {
+		t.Fatalf("check schema: %v", err)
+	}
+
+	fields := meow.EndpointFields
+	t.Cleanup(func() { meow.EndpointFields = fields })
+	tests := []struct {
+		name   string
+		fields []string
+		want   string
+	}{
+		{"field never written", append(slices.Clone(fields), "expect_header"), "expect_header"},
+		{"field written but not listed", slices.DeleteFunc(slices.Clone(fields), func(name string) bool {
+			return name == meow.FieldHTTPVersion
+		}), meow.FieldHTTPVersion},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			meow.EndpointFields = test.fields
+			err := checkSchema()
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want one about field %s", err, test.want)
+			}
+		})
+	}
+}
+
+func TestEndpointFieldsAreWrittenAndRead(t *testing.T) {
+	shards, _ := newTestShards(t, 2)
+	ctx := context.Background()
+	written := make(map[string]bool)
+	// dependencies are stored before the endpoints depending on them
+	for _, sample := range slices.Backward(schemaSamples) {
+		data, err := json.Marshal(sample)
+		if err != nil {
+			t.Fatalf("marshal sample %s: %v", sample.Identifier, err)
+		}
+		postTestEndpoint(t, shards, string(data))
+
+		vk := shards.For(sample.Identifier)
+		kvs, err := vk.Do(ctx, vk.B().Hgetall().Key(meow.EndpointKey(sample.Identifier)).Build()).AsStrMap()
+		if err != nil {
+			t.Fatalf("hgetall %s: %v", meow.EndpointKey(sample.Identifier), err)
+		}
+		for name := range kvs {
+			if !slices.Contains(meow.EndpointFields, name) {
+				t.Errorf("field %s of %s is written, but not one of meow.EndpointFields", name, sample.Identifier)
+			}
+			written[name] = true
+		}
+
+		w := handle(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			getEndpoint(ctx, shards, http.StatusNotFound, w, r)
+		}, http.MethodGet, "/endpoints/"+sample.Identifier, "")
+		var served meow.EndpointPayload
+		if err := json.Unmarshal(w.Body.Bytes(), &served); w.Code != http.StatusOK || err != nil {
+			t.Fatalf("get %s: got status %d, body %s (%v)", sample.Identifier, w.Code, w.Body, err)
+		}
+		endpoint, err := meow.EndpointFromPayload(served)
+		if err != nil {
+			t.Fatalf("convert served %s to endpoint: %v", sample.Identifier, err)
+		}
+		// the probe reads the webhook secret, which is never served, right
+		// from the hash
+		endpoint.WebhookSecret = kvs[meow.FieldWebhookSecret]
+		for _, field := range endpointHashFields(endpoint) {
+			if field.value != kvs[field.name] {
+				t.Errorf("field %s of %s is written as %q, but read as %q", field.name, sample.Identifier, kvs[field.name], field.value)
+			}
+		}
+	}
+	for _, name := range meow.EndpointFields {
+		if !written[name] {
+			t.Errorf("field %s of meow.EndpointFields is never written", name)
+		}
+	}
+}
+
+func TestGetEndpointStatusAggregatesRegions(t *testing.T) {
+	shards, _ := newTestShards(t, 2)
+	postTestEndpoint(t, shards, libvirt)
+	ctx := context.Background()
+	status := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		m := http.NewServeMux()
+		m.HandleFunc("GET /endpoints/{id}/status", func(w http.ResponseWriter, r *http.Request) {
+			getEndpointStatus(ctx, shards, w, r)
+		})
+		m.ServeHTTP(w, r)
+	}
+	get := func() endpointStatus {
+		t.Helper()
+		w := handle(status, http.MethodGet, "/endpoints/libvirt/status", "")
+		var got endpointStatus
+		if err := json.Unmarshal(w.Body.Bytes(), &got); w.Code != http.StatusOK || err != nil {
+			t.Fatalf("get status: got status %d, body %s (%v)", w.Code, w.Body, err)
+		}
+		return got
+	}
+	if got := get(); got.Regions != nil || got.RegionState != "" {
+		t.Errorf("got status %+v without regions, want none", got)
+	}
+
+	at := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	vk := shards.For("libvirt")
+	for region, state := range map[string]string{"eu-central": meow.StateUp, "us-east": meow.StateDown} {
+		if err := meow.RegisterRegion(ctx, shards.All()[0], region); err != nil {
+			t.Fatal(err)
+		}
+		if err := meow.RecordRegionState(ctx, vk, "libvirt", region, meow.RegionState{State: state, CheckedAt: at}, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := get()
+	if len(got.Regions) != 2 || got.Regions["eu-central"].State != meow.StateUp || got.Regions["us-east"].State != meow.StateDown {
+		t.Errorf("got regions %v, want libvirt up in eu-central and down in us-east", got.Regions)
+	}
+	if got.RegionState != meow.StateDegraded {
+		t.Errorf("got region state %q, want %q", got.RegionState, meow.StateDegraded)
+	}
+	if got.State != meow.StateUnknown {
+		t.Errorf("got state %q, want the state not recorded for a region to stay %q", got.State, meow.StateUnknown)
+	}
+}
+
+func TestGetEndpointWithNotFoundStatus(t *testing.T) {
+	shards, _ := newTestShards(t, 1)
+	postTestEndpoint(t, shards, libvirt)
+	for _, notFoundStatus := range []int{http.StatusNotFound, http.StatusOK, http.StatusNoContent, http.StatusGone} {
+		t.Run(http.StatusText(notFoundStatus), func(t *testing.T) {
+			get := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+				getEndpoint(ctx, shards, notFoundStatus, w, r)
+			}
+			w := handle(get, http.MethodGet, "/endpoints/unknown", "")
+			if w.Code != notFoundStatus || w.Body.Len() > 0 {
+				t.Errorf("get unknown endpoint: got status %d, body %q, want status %d without body", w.Code, w.Body, notFoundStatus)
+			}
+			if w := handle(get, http.MethodGet, "/endpoints/libvirt", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"libvirt"`) {
+				t.Errorf("get existing endpoint: got status %d, body %q, want it served", w.Code, w.Body)
+			}
+			if w := handle(get, http.MethodGet, "/endpoints/Libvirt", ""); w.Code != http.StatusBadRequest {
+				t.Errorf("get malformed identifier: got status %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
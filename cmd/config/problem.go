@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/patrickbucher/meow"
+)
+
+// problemMediaType is the media type of problem details as of RFC 7807.
+const problemMediaType = "application/problem+json"
+
+// problem details an error response as of RFC 7807. Field is an extension
+// naming the invalid field of a rejected endpoint.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Field  string `json:"field,omitempty"`
+}
+
+type problemKey struct{}
+
+// problemDetails wraps the handler so that error responses without a body of
+// their own are sent as problem details to clients accepting them. Other
+// clients get the plain error responses.
+func problemDetails(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !accepts(r, problemMediaType) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		p := &problem{Type: "about:blank"}
+		r = r.WithContext(context.WithValue(r.Context(), problemKey{}, p))
+		handler.ServeHTTP(&problemWriter{ResponseWriter: w, problem: p}, r)
+	})
+}
+
+// describeProblem details the error response to the request with err, if the
+// client accepts problem details. Validation errors name the invalid field.
+func describeProblem(r *http.Request, err error) {
+	p, ok := r.Context().Value(problemKey{}).(*problem)
+	if !ok {
+		return
+	}
+	p.Detail = err.Error()
+	var validationErr *meow.ValidationError
+	if errors.As(err, &validationErr) {
+		p.Field = validationErr.Field
+	}
+}
+
+// problemWriter writes the problem instead of an error response's body, unless
+// the handler set a content type for a body of its own.
+type problemWriter struct {
+	http.ResponseWriter
+	problem *problem
+	written bool
+}
+
+func (w *problemWriter) WriteHeader(status int) {
+	if status < http.StatusBadRequest || w.Header().Get("Content-Type") != "" {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.problem.Title = http.StatusText(status)
+	w.problem.Status = status
+	data, err := json.Marshal(w.problem)
+	if err != nil {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", problemMediaType)
+	w.ResponseWriter.WriteHeader(status)
+	w.ResponseWriter.Write(data)
+	w.written = true
+}
+
+func (w *problemWriter) Write(data []byte) (int, error) {
+	if w.written {
+		// the problem is the body
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer.
+func (w *problemWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/patrickbucher/meow"
+)
+
+// schemaSamples are endpoints which, among them, have all fields of
+// meow.EndpointFields set.
+var schemaSamples = []meow.EndpointPayload{
+	{
+		Identifier:         "schema-http",
+		URL:                "https://primary.example.com/health",
+		URLs:               []string{"https://primary.example.com/health", "https://secondary.example.com/health"},
+		Method:             "GET",
+		StatusOnline:       200,
+		Frequency:          "1m",
+		FailAfter:          3,
+		DependsOn:          []string{"schema-grpc"},
+		Proxy:              "http://proxy.example.com:3128",
+		UserAgent:          "schema/1.0",
+		MaxRedirects:       5,
+		CaptureBodyBytes:   64,
+		ExpectSHA256:       "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		AlertCooldown:      "1h",
+		Alerts:             []meow.AlertChannel{{Type: meow.AlertWebhook, Target: "https://hooks.example.com/meow"}},
+		AlertTemplate:      "{{.Endpoint.Identifier}} is {{.State}}",
+		MaintenanceWindows: []meow.Window{{Days: []string{"sun"}, Start: "02:00", End: "04:00"}},
+		CheckWindow:        &meow.Window{Start: "06:00", End: "22:00"},
+		StatusClasses:      map[uint16]string{503: meow.StateDegraded},
+		RetryOnStatuses:    []uint16{502},
+		Offset:             "10s",
+		WebhookSecret:      "secret",
+		NotifyOnRecovery:   new(bool),
+		MinBodyBytes:       1,
+		MaxBodyBytes:       1024,
+		QueryParams:        map[string]string{"t": "{{now_unix}}"},
+		HistorySize:        1000,
+		HTTPVersion:        meow.HTTPVersion11,
+		Labels:             map[string]string{"env": "prod", "example.com/tier": "web"},
+		Regions:            []string{"eu-central", "us-east"},
+		Timeout:            "5s",
+		Retries:            3,
+	},
+	{
+		Identifier:          "schema-redirect",
+		URL:                 "https://example.com/",
+		Method:              "GET",
+		StatusOnline:        301,
+		Frequency:           "1m",
+		FailAfter:           1,
+		ExpectRedirectTo:    "https://www.example.com/",
+		UseHEADWhenPossible: true,
+	},
+	{
+		Identifier:      "schema-json",
+		URL:             "https://example.com/status",
+		Method:          "GET",
+		StatusOnline:    200,
+		Frequency:       "1m",
+		FailWindow:      10,
+		FailRatio:       0.5,
+		ExpectJSONPath:  "$.data.healthy",
+		ExpectJSONValue: json.RawMessage("true"),
+	},
+	{
+		Identifier: "schema-grpc",
+		URL:        "grpc://example.com:50051/service",
+		Frequency:  "1m",
+		FailAfter:  1,
+		Protocol:   meow.ProtocolGRPC,
+	},
+}
+
+// checkSchema returns an error if the fields of the endpoint hashes written by
+// endpointHashFields diverge from meow.EndpointFields, or if a field written is
+// lost on its way to the probe, i.e. when read by payloadFromValkeyMap, served
+// as JSON, and converted into an endpoint. The webhook secret, which is never
+// served, is read by the probe right from the hash.
+func checkSchema() error {
+	written := make(map[string]bool)
+	for _, sample := range schemaSamples {
+		endpoint, err := meow.EndpointFromPayload(sample)
+		if err != nil {
+			return fmt.Errorf("convert sample %s to endpoint: %v", sample.Identifier, err)
+		}
+		stored := append(endpointHashFields(endpoint), hashField{meow.FieldModifiedAt, modifiedAt()})
+		kvs := make(map[string]string, len(stored))
+		for _, field := range stored {
+			if !slices.Contains(meow.EndpointFields, field.name) {
+				return fmt.Errorf("field %s is written, but not one of meow.EndpointFields", field.name)
+			}
+			kvs[field.name] = field.value
+			written[field.name] = true
+		}
+
+		payload, err := payloadFromValkeyMap(kvs)
+		if err != nil {
+			return fmt.Errorf("convert hash of sample %s to payload: %v", sample.Identifier, err)
+		}
+		data, err := marshalPayload(payload, "", false, false)
+		if err != nil {
+			return fmt.Errorf("marshal payload of sample %s: %v", sample.Identifier, err)
+		}
+		var served meow.EndpointPayload
+		if err := json.Unmarshal(data, &served); err != nil {
+			return fmt.Errorf("unmarshal payload of sample %s: %v", sample.Identifier, err)
+		}
+		if served.ModifiedAt != kvs[meow.FieldModifiedAt] {
+			return fmt.Errorf("field %s of sample %s is written, but not served", meow.FieldModifiedAt, sample.Identifier)
+		}
+		consumed, err := meow.EndpointFromPayload(served)
+		if err != nil {
+			return fmt.Errorf("convert served payload of sample %s to endpoint: %v", sample.Identifier, err)
+		}
+		consumed.WebhookSecret = kvs[meow.FieldWebhookSecret]
+		read := make(map[string]string, len(stored))
+		for _, field := range endpointHashFields(consumed) {
+			read[field.name] = field.value
+		}
+		for _, name := range meow.EndpointFields {
+			if name != meow.FieldModifiedAt && kvs[name] != read[name] {
+				return fmt.Errorf("field %s of sample %s is written as %q, but read as %q",
+					name, sample.Identifier, kvs[name], read[name])
+			}
+		}
+	}
+	for _, name := range meow.EndpointFields {
+		if !written[name] {
+			return fmt.Errorf("field %s of meow.EndpointFields is never written", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/patrickbucher/meow"
+	"github.com/valkey-io/valkey-go"
+)
+
+// snapshotsKey is a sorted set of the versions snapshots were taken of, scored
+// by version, in the first shard. The snapshot of a version is stored under the
+// key returned by snapshotKey.
+const snapshotsKey = "meow:snapshots"
+
+func snapshotKey(version int64) string {
+	return "meow:snapshot:" + strconv.FormatInt(version, 10)
+}
+
+// snapshot describes a snapshot of all stored endpoints.
+type snapshot struct {
+	Version   int64     `json:"version"`
+	At        time.Time `json:"at"`
+	Endpoints int       `json:"endpoints"`
+}
+
+// snapshotConfig takes a snapshot of the stored endpoints right away and then
+// every interval, unless their version did not change since the last snapshot.
+// Only the keep most recent snapshots are kept.
+func snapshotConfig(ctx context.Context, shards *meow.Shards, interval time.Duration, keep int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		taken, err := takeSnapshot(ctx, shards, keep)
+		if err != nil {
+			slog.Error("take snapshot", "err", err)
+		} else if taken != nil {
+			slog.Info("took snapshot", "version", taken.Version, "endpoints", taken.Endpoints)
+		}
+		<-ticker.C
+	}
+}
+
+// takeSnapshot stores the hashes of all endpoints, compressed, under the
+// current version, and deletes the snapshots exceeding the keep most recent
+// ones. No snapshot is taken, and nil is returned, if there already is one of
+// the current version.
+func takeSnapshot(ctx context.Context, shards *meow.Shards, keep int) (*snapshot, error) {
+	version, err := fetchVersion(ctx, shards)
+	if err != nil {
+		return nil, err
+	}
+	vk := shards.All()[0]
+	err = vk.Do(ctx, vk.B().Zscore().Key(snapshotsKey).Member(strconv.FormatInt(version, 10)).Build()).Error()
+	if err == nil {
+		return nil, nil
+	} else if !valkey.IsValkeyNil(err) {
+		return nil, fmt.Errorf("zscore %s: %v", snapshotsKey, err)
+	}
+
+	identifiers, err := listIdentifiers(ctx, shards)
+	if err != nil {
+		return nil, fmt.Errorf("list identifiers: %v", err)
+	}
+	hashes := make([]map[string]string, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		key := meow.EndpointKey(identifier)
+		node := shards.For(identifier)
+		kvs, err := node.Do(ctx, node.B().Hgetall().Key(key).Build()).AsStrMap()
+		if err != nil {
+			return nil, fmt.Errorf("hgetall %s: %v", key, err)
+		}
+		if len(kvs) > 0 {
+			hashes = append(hashes, kvs)
+		}
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(hashes); err != nil {
+		return nil, fmt.Errorf("compress snapshot: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compress snapshot: %v", err)
+	}
+
+	taken := &snapshot{Version: version, At: time.Now().UTC(), Endpoints: len(hashes)}
+	key := snapshotKey(version)
+	results := vk.DoMulti(ctx,
+		vk.B().Hset().Key(key).FieldValue().
+			FieldValue("at", taken.At.Format(time.RFC3339Nano)).
+			FieldValue("endpoints", strconv.Itoa(taken.Endpoints)).
+			FieldValue("data", buf.String()).Build(),
+		vk.B().Zadd().Key(snapshotsKey).ScoreMember().ScoreMember(float64(version), strconv.FormatInt(version, 10)).Build())
+	for _, result := range results {
+		if err := result.Error(); err != nil {
+			return nil, fmt.Errorf("store snapshot %s: %v", key, err)
+		}
+	}
+
+	excess, err := vk.Do(ctx, vk.B().Zrange().Key(snapshotsKey).Min("0").Max(strconv.Itoa(-keep-1)).Build()).AsStrSlice()
+	if err != nil {
+		return taken, fmt.Errorf("zrange %s: %v", snapshotsKey, err)
+	}
+	for _, member := range excess {
+		old, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return taken, fmt.Errorf("snapshot version %q not a number: %v", member, err)
+		}
+		results := vk.DoMulti(ctx,
+			vk.B().Del().Key(snapshotKey(old)).Build(),
+			vk.B().Zrem().Key(snapshotsKey).Member(member).Build())
+		for _, result := range results {
+			if err := result.Error(); err != nil {
+				return taken, fmt.Errorf("delete snapshot %s: %v", snapshotKey(old), err)
+			}
+		}
+	}
+	return taken, nil
+}
+
+// getSnapshots lists the snapshots kept, most recent first.
+func getSnapshots(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	vk := shards.All()[0]
+	members, err := vk.Do(ctx, vk.B().Zrange().Key(snapshotsKey).Min("0").Max("-1").Rev().Build()).AsStrSlice()
+	if err != nil {
+		slog.Error("zrange", "key", snapshotsKey, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	snapshots := make([]snapshot, 0, len(members))
+	for _, member := range members {
+		version, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			slog.Error("snapshot version not a number", "member", member, "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		key := snapshotKey(version)
+		fields, err := vk.Do(ctx, vk.B().Hmget().Key(key).Field("at", "endpoints").Build()).ToArray()
+		if err != nil {
+			slog.Error("hmget", "key", key, "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s := snapshot{Version: version}
+		if raw, err := fields[0].ToString(); err == nil {
+			s.At, _ = time.Parse(time.RFC3339Nano, raw)
+		}
+		if raw, err := fields[1].ToString(); err == nil {
+			s.Endpoints, _ = strconv.Atoi(raw)
+		}
+		snapshots = append(snapshots, s)
+	}
+	data, err := marshalJSON(snapshots, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal snapshots", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// postSnapshotRestore rolls the stored endpoints back to the snapshot of a
+// version like applying it as desired config with deletes enabled. The current
+// endpoints are snapshotted before, unless snapshots are disabled, so that the
+// restore can be undone.
+func postSnapshotRestore(ctx context.Context, shards *meow.Shards, keep int, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	version, err := strconv.ParseInt(r.PathValue("version"), 10, 64)
+	if err != nil {
+		slog.Warn("request rejected: invalid version", "version", r.PathValue("version"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	vk := shards.All()[0]
+	key := snapshotKey(version)
+	data, err := vk.Do(ctx, vk.B().Hget().Key(key).Field("data").Build()).AsBytes()
+	if valkey.IsValkeyNil(err) {
+		slog.Warn("no such snapshot", "version", version)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		slog.Error("hget", "key", key, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	desired, err := snapshotEndpoints(data)
+	var validationErr *meow.ValidationError
+	if errors.As(err, &validationErr) {
+		slog.Warn("snapshot rejected", "version", version, "err", err)
+		describeProblem(r, err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		slog.Error("read snapshot", "version", version, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if keep > 0 {
+		if _, err := takeSnapshot(ctx, shards, keep); err != nil {
+			slog.Error("take snapshot before restore", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	plan, err := planConfig(ctx, shards, desired)
+	if err != nil {
+		slog.Error("plan config", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	result, err := applyPlan(ctx, shards, plan, true)
+	if len(result.Created)+len(result.Updated)+len(result.Deleted) > 0 {
+		bumpVersion(ctx, shards)
+	}
+	if err != nil {
+		slog.Error("restore snapshot", "version", version, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	slog.Info("restored snapshot", "version", version)
+	data, err = marshalJSON(result, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal restore result", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// snapshotEndpoints decompresses the endpoint hashes of a snapshot and converts
+// them into endpoints, which must be valid according to the current rules.
+func snapshotEndpoints(data []byte) ([]*meow.Endpoint, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decompress snapshot: %v", err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("decompress snapshot: %v", err)
+	}
+	var hashes []map[string]string
+	if err := json.Unmarshal(raw, &hashes); err != nil {
+		return nil, fmt.Errorf("unmarshal snapshot: %v", err)
+	}
+	endpoints := make([]*meow.Endpoint, 0, len(hashes))
+	for _, kvs := range hashes {
+		payload, err := payloadFromValkeyMap(kvs)
+		if err != nil {
+			return nil, fmt.Errorf("convert hash of %s to payload: %v", kvs[meow.FieldIdentifier], err)
+		}
+		endpoint, err := meow.EndpointFromPayload(payload)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %q: %w", payload.Identifier, err)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, nil
+}
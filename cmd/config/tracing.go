@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/valkey-io/valkey-go"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans created by the config server.
+const tracerName = "github.com/patrickbucher/meow/cmd/config"
+
+// setupTracing installs a tracer provider exporting spans using OTLP over
+// HTTP, which is configured by the standard environment variables, e.g.
+// OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_SERVICE_NAME. The returned function
+// shuts the provider down, flushing the pending spans.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP exporter: %v", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "meow-config")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK())
+	if err != nil {
+		return nil, fmt.Errorf("create resource: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// traceRequests wraps the handler so that a span is created for every request,
+// which continues the trace of the incoming trace context, if any. The spans
+// are named after the method and the route pattern the request matched.
+func traceRequests(mux *http.ServeMux) http.Handler {
+	named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		if r.Pattern == "" {
+			return
+		}
+		span := trace.SpanFromContext(r.Context())
+		route := r.Pattern
+		if !strings.Contains(route, " ") {
+			route = r.Method + " " + route
+		}
+		span.SetName(route)
+		span.SetAttributes(attribute.String("http.route", r.Pattern))
+	})
+	return otelhttp.NewHandler(named, "request")
+}
+
+// requestContext returns the context of the request without its cancellation,
+// so that Valkey commands are traced as part of the request, but are completed
+// even if the client goes away.
+func requestContext(r *http.Request) context.Context {
+	return context.WithoutCancel(r.Context())
+}
+
+// tracedClient creates a span for every command sent to Valkey, which is a
+// child of the span of the context, if any.
+type tracedClient struct {
+	valkey.Client
+	tracer trace.Tracer
+}
+
+func newTracedClient(client valkey.Client) valkey.Client {
+	return tracedClient{client, otel.Tracer(tracerName)}
+}
+
+func (c tracedClient) Do(ctx context.Context, cmd valkey.Completed) valkey.ValkeyResult {
+	ctx, span := c.start(ctx, cmd.Commands()[0], 1)
+	defer span.End()
+	result := c.Client.Do(ctx, cmd)
+	recordError(span, result.Error())
+	return result
+}
+
+func (c tracedClient) DoMulti(ctx context.Context, cmds ...valkey.Completed) []valkey.ValkeyResult {
+	operation := "PIPELINE"
+	if len(cmds) > 0 && cmds[0].Commands()[0] == "MULTI" {
+		operation = "MULTI"
+	}
+	ctx, span := c.start(ctx, operation, len(cmds))
+	defer span.End()
+	results := c.Client.DoMulti(ctx, cmds...)
+	for _, result := range results {
+		recordError(span, result.Error())
+	}
+	return results
+}
+
+func (c tracedClient) start(ctx context.Context, operation string, n int) (context.Context, trace.Span) {
+	attributes := []attribute.KeyValue{
+		attribute.String("db.system.name", "valkey"),
+		attribute.String("db.operation.name", operation),
+	}
+	if n > 1 {
+		attributes = append(attributes, attribute.Int("db.operation.batch.size", n))
+	}
+	return c.tracer.Start(ctx, "valkey "+operation,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+}
+
+// recordError marks the span as failed, unless err is nil or indicates a
+// missing value.
+func recordError(span trace.Span, err error) {
+	if err == nil || valkey.IsValkeyNil(err) {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/patrickbucher/meow"
+)
+
+// validationReport lists the stored endpoints that fail the current validation
+// rules, e.g. because they were stored before the rules were tightened.
+type validationReport struct {
+	Checked int               `json:"checked"`
+	Invalid []invalidEndpoint `json:"invalid"`
+}
+
+// invalidEndpoint describes why a stored endpoint is invalid. Field is empty
+// unless a single field could be blamed.
+type invalidEndpoint struct {
+	Identifier string `json:"identifier"`
+	Field      string `json:"field,omitempty"`
+	Error      string `json:"error"`
+}
+
+func getValidation(ctx context.Context, shards *meow.Shards, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	report, err := validateEndpoints(ctx, shards)
+	if err != nil {
+		slog.Error("validate endpoints", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	data, err := marshalJSON(report, "", isPretty(r))
+	if err != nil {
+		slog.Error("marshal validation report", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// validateEndpoints checks every stored endpoint against the current validation
+// rules without modifying any of them.
+func validateEndpoints(ctx context.Context, shards *meow.Shards) (*validationReport, error) {
+	identifiers, err := listIdentifiers(ctx, shards)
+	if err != nil {
+		return nil, err
+	}
+	report := &validationReport{Invalid: make([]invalidEndpoint, 0)}
+	for _, identifier := range identifiers {
+		key := meow.EndpointKey(identifier)
+		vk := shards.For(identifier)
+		kvs, err := vk.Do(ctx, vk.B().Hgetall().Key(key).Build()).AsStrMap()
+		if err != nil {
+			return nil, fmt.Errorf("hgetall %s: %v", key, err)
+		}
+		if len(kvs) == 0 {
+			continue
+		}
+		report.Checked++
+		if err := validateHash(identifier, kvs); err != nil {
+			invalid := invalidEndpoint{Identifier: identifier, Error: err.Error()}
+			var validationErr *meow.ValidationError
+			if errors.As(err, &validationErr) {
+				invalid.Field = validationErr.Field
+			}
+			report.Invalid = append(report.Invalid, invalid)
+		}
+	}
+	return report, nil
+}
+
+// validateHash checks the hash stored for the endpoint with identifier.
+func validateHash(identifier string, kvs map[string]string) error {
+	payload, err := payloadFromValkeyMap(kvs)
+	if err != nil {
+		return err
+	}
+	if payload.Identifier != identifier {
+		return &meow.ValidationError{
+			Field:   "identifier",
+			Message: fmt.Sprintf("identifier %q does not match key %s", payload.Identifier, meow.EndpointKey(identifier)),
+		}
+	}
+	_, err = meow.EndpointFromPayload(payload)
+	return err
+}
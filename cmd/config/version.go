@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/patrickbucher/meow"
+	"github.com/valkey-io/valkey-go"
+)
+
+// versionKey holds the version of the stored endpoints, which is incremented
+// with every write, in the first shard.
+const versionKey = "meow:version"
+
+// bumpVersion increments the version of the stored endpoints after a write.
+// Failing to do so is only logged, since the write itself succeeded.
+func bumpVersion(ctx context.Context, shards *meow.Shards) {
+	vk := shards.All()[0]
+	if err := vk.Do(ctx, vk.B().Incr().Key(versionKey).Build()).Error(); err != nil {
+		slog.Error("incr", "key", versionKey, "err", err)
+	}
+}
+
+// fetchVersion returns the version of the stored endpoints, which is 0 before
+// the first write.
+func fetchVersion(ctx context.Context, shards *meow.Shards) (int64, error) {
+	vk := shards.All()[0]
+	version, err := vk.Do(ctx, vk.B().Get().Key(versionKey).Build()).AsInt64()
+	if valkey.IsValkeyNil(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("get %s: %v", versionKey, err)
+	}
+	return version, nil
+}
+
+// listingETag returns the weak entity tag of the listing of all endpoints in
+// the variant at the version.
+func listingETag(version int64, variant string) string {
+	return fmt.Sprintf(`W/"%s-%s"`, strconv.FormatInt(version, 10), variant)
+}
+
+// etagMatches reports whether the request's If-None-Match header lists the
+// entity tag, which is compared weakly.
+func etagMatches(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
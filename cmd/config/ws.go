@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// wsRequest is sent by WebSocket clients to select the endpoints whose state
+// changes and latency updates they receive.
+type wsRequest struct {
+	Action      string   `json:"action"`
+	Identifiers []string `json:"identifiers"`
+}
+
+func getWebSocket(events *broker, w http.ResponseWriter, r *http.Request) {
+	slog.Debug("request", "method", r.Method, "url", r.URL, "remote", r.RemoteAddr)
+
+	// the connection outlives the server's read and write timeouts
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		slog.Error("clear read deadline", "remote", r.RemoteAddr, "err", err)
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Error("clear write deadline", "remote", r.RemoteAddr, "err", err)
+	}
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		slog.Warn("accept websocket", "remote", r.RemoteAddr, "err", err)
+		return
+	}
+	defer conn.CloseNow()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	var mu sync.Mutex
+	subscribed := make(map[string]bool)
+	go func() {
+		defer cancel()
+		for {
+			var req wsRequest
+			if err := wsjson.Read(ctx, conn, &req); err != nil {
+				if !isClosedByClient(err) {
+					slog.Warn("read from websocket", "remote", r.RemoteAddr, "err", err)
+				}
+				return
+			}
+			mu.Lock()
+			switch req.Action {
+			case "subscribe":
+				for _, identifier := range req.Identifiers {
+					subscribed[identifier] = true
+				}
+			case "unsubscribe":
+				for _, identifier := range req.Identifiers {
+					delete(subscribed, identifier)
+				}
+			default:
+				mu.Unlock()
+				conn.Close(websocket.StatusUnsupportedData, "action must be subscribe or unsubscribe")
+				return
+			}
+			mu.Unlock()
+		}
+	}()
+
+	messages := events.subscribe()
+	defer events.unsubscribe(messages)
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Debug("websocket closed", "remote", r.RemoteAddr)
+			return
+		case e, ok := <-messages:
+			if !ok {
+				conn.Close(websocket.StatusGoingAway, "server shutting down")
+				return
+			}
+			// state changes and latency updates both carry the identifier
+			var concerned struct {
+				Identifier string `json:"identifier"`
+			}
+			if err := json.Unmarshal([]byte(e.data), &concerned); err != nil {
+				slog.Error("unmarshal event", "event", e.name, "data", e.data, "err", err)
+				continue
+			}
+			mu.Lock()
+			wanted := subscribed[concerned.Identifier]
+			mu.Unlock()
+			if !wanted {
+				continue
+			}
+			writeCtx, cancelWrite := context.WithTimeout(ctx, 10*time.Second)
+			err := conn.Write(writeCtx, websocket.MessageText, []byte(e.data))
+			cancelWrite()
+			if err != nil {
+				slog.Warn("write to websocket", "remote", r.RemoteAddr, "err", err)
+				return
+			}
+		case <-keepAlive.C:
+			pingCtx, cancelPing := context.WithTimeout(ctx, 10*time.Second)
+			err := conn.Ping(pingCtx)
+			cancelPing()
+			if err != nil {
+				slog.Warn("ping websocket", "remote", r.RemoteAddr, "err", err)
+				return
+			}
+		}
+	}
+}
+
+func isClosedByClient(err error) bool {
+	status := websocket.CloseStatus(err)
+	return status == websocket.StatusNormalClosure || status == websocket.StatusGoingAway ||
+		errors.Is(err, context.Canceled)
+}
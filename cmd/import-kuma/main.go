@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patrickbucher/meow"
+)
+
+// kumaExport is the part of an Uptime Kuma backup describing the monitors.
+type kumaExport struct {
+	Version     string        `json:"version"`
+	MonitorList []kumaMonitor `json:"monitorList"`
+}
+
+// kumaMonitor is a monitor of Uptime Kuma, of which only the fields that can
+// be mapped to an endpoint, or whose loss is worth reporting, are read.
+type kumaMonitor struct {
+	ID                  int      `json:"id"`
+	Name                string   `json:"name"`
+	Type                string   `json:"type"`
+	URL                 string   `json:"url"`
+	Method              string   `json:"method"`
+	Interval            int      `json:"interval"`
+	MaxRetries          int      `json:"maxretries"`
+	AcceptedStatusCodes []string `json:"accepted_statuscodes"`
+	Keyword             string   `json:"keyword"`
+	Body                string   `json:"body"`
+	Headers             string   `json:"headers"`
+	BasicAuthUser       string   `json:"basic_auth_user"`
+	Active              *bool    `json:"active"`
+}
+
+func main() {
+	output := flag.String("o", "", "file to write the endpoints to (default: stdout)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-o endpoints.json] [backup.json]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	in := io.Reader(os.Stdin)
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatalf("open %s: %v", flag.Arg(0), err)
+		}
+		defer f.Close()
+		in = f
+	}
+	var export kumaExport
+	if err := json.NewDecoder(in).Decode(&export); err != nil {
+		log.Fatalf("parse Uptime Kuma export: %v", err)
+	}
+
+	payloads := make([]meow.EndpointPayload, 0, len(export.MonitorList))
+	identifiers := make(map[string]bool)
+	skipped := 0
+	for _, monitor := range export.MonitorList {
+		payload, notes, err := mapMonitor(monitor)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monitor %d (%s): skipped: %v\n", monitor.ID, monitor.Name, err)
+			skipped++
+			continue
+		}
+		payload.Identifier = uniqueIdentifier(payload.Identifier, identifiers)
+		if _, err := meow.EndpointFromPayload(payload); err != nil {
+			fmt.Fprintf(os.Stderr, "monitor %d (%s): skipped: %v\n", monitor.ID, monitor.Name, err)
+			skipped++
+			continue
+		}
+		identifiers[payload.Identifier] = true
+		for _, note := range notes {
+			fmt.Fprintf(os.Stderr, "monitor %d (%s): %s\n", monitor.ID, monitor.Name, note)
+		}
+		payloads = append(payloads, payload)
+	}
+
+	data, err := json.MarshalIndent(payloads, "", "  ")
+	if err != nil {
+		log.Fatalf("marshal endpoints: %v", err)
+	}
+	data = append(data, '\n')
+	if *output == "" {
+		os.Stdout.Write(data)
+	} else if err := os.WriteFile(*output, data, 0644); err != nil {
+		log.Fatalf("write %s: %v", *output, err)
+	}
+	fmt.Fprintf(os.Stderr, "%d monitors imported, %d skipped\n", len(payloads), skipped)
+}
+
+// mapMonitor maps the monitor to an endpoint payload, or returns an error if it
+// cannot be mapped. The notes describe settings lost in the mapping.
+func mapMonitor(monitor kumaMonitor) (meow.EndpointPayload, []string, error) {
+	var notes []string
+	switch monitor.Type {
+	case "http":
+	case "keyword", "json-query":
+		notes = append(notes, fmt.Sprintf("%s check of the response body dropped", monitor.Type))
+	default:
+		return meow.EndpointPayload{}, nil, fmt.Errorf("monitor type %q is not supported", monitor.Type)
+	}
+	if monitor.URL == "" {
+		return meow.EndpointPayload{}, nil, fmt.Errorf("no URL")
+	}
+	method := strings.ToUpper(monitor.Method)
+	if method == "" {
+		method = "GET"
+	}
+	status, statusNote, err := statusOnline(monitor.AcceptedStatusCodes)
+	if err != nil {
+		return meow.EndpointPayload{}, nil, err
+	}
+	if statusNote != "" {
+		notes = append(notes, statusNote)
+	}
+	frequency := ""
+	if monitor.Interval > 0 {
+		frequency = (time.Duration(monitor.Interval) * time.Second).String()
+	}
+	// Uptime Kuma retries before considering a monitor down
+	failAfter := min(monitor.MaxRetries+1, 255)
+	if monitor.Body != "" || monitor.Headers != "" {
+		notes = append(notes, "request body and headers dropped")
+	}
+	if monitor.BasicAuthUser != "" {
+		notes = append(notes, "basic auth dropped")
+	}
+	if monitor.Active != nil && !*monitor.Active {
+		notes = append(notes, "imported although paused in Uptime Kuma")
+	}
+	return meow.EndpointPayload{
+		Identifier:   identifierFromName(monitor.Name),
+		URL:          monitor.URL,
+		Method:       method,
+		StatusOnline: status,
+		Frequency:    frequency,
+		FailAfter:    uint8(failAfter),
+	}, notes, nil
+}
+
+// statusOnline picks the status code indicating that the endpoint is online
+// from the accepted ones, which are codes like 204 or ranges like 200-299. 200
+// is preferred, if accepted; otherwise, the first code is picked, which is
+// noted if others were accepted, too.
+func statusOnline(accepted []string) (uint16, string, error) {
+	if len(accepted) == 0 {
+		return 200, "", nil
+	}
+	var first uint16
+	for i, codes := range accepted {
+		lower, upper, isRange := strings.Cut(codes, "-")
+		from, err := strconv.ParseUint(strings.TrimSpace(lower), 10, 16)
+		if err != nil {
+			return 0, "", fmt.Errorf("accepted status code %q is not a number", codes)
+		}
+		to := from
+		if isRange {
+			to, err = strconv.ParseUint(strings.TrimSpace(upper), 10, 16)
+			if err != nil {
+				return 0, "", fmt.Errorf("accepted status code range %q is invalid", codes)
+			}
+		}
+		if from <= 200 && 200 <= to {
+			return 200, "", nil
+		}
+		if i == 0 {
+			first = uint16(from)
+		}
+	}
+	if len(accepted) == 1 && !strings.Contains(accepted[0], "-") {
+		return first, "", nil
+	}
+	return first, fmt.Sprintf("only status %d of accepted %s considered online", first, strings.Join(accepted, ", ")), nil
+}
+
+var nonIdentifierChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// identifierFromName derives an identifier from the monitor's name, e.g.
+// "My Web Site" becomes my-web-site.
+func identifierFromName(name string) string {
+	identifier := nonIdentifierChars.ReplaceAllString(strings.ToLower(name), "-")
+	identifier = strings.Trim(identifier, "-")
+	if identifier == "" || identifier[0] < 'a' || identifier[0] > 'z' {
+		identifier = "kuma-" + identifier
+	}
+	return strings.TrimSuffix(identifier, "-")
+}
+
+// uniqueIdentifier appends a number to the identifier if it is taken already.
+func uniqueIdentifier(identifier string, taken map[string]bool) string {
+	unique := identifier
+	for i := 2; taken[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", identifier, i)
+	}
+	return unique
+}
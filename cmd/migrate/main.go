@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/patrickbucher/meow"
+	"github.com/valkey-io/valkey-go"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only log the changes instead of storing them")
+	flag.DurationVar(&meow.DefaultFrequency, "default-frequency", meow.DefaultFrequency, "frequency of endpoints stored without one")
+	flag.Parse()
+
+	shards, err := meow.ShardsFromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer shards.Close()
+
+	ctx := context.Background()
+	renamed, migrated := 0, 0
+	for _, vk := range shards.All() {
+		n, err := renameLegacyKeys(ctx, vk, *dryRun)
+		renamed += n
+		if err != nil {
+			log.Fatalf("rename legacy keys: %v", err)
+		}
+		n, err = migrateShard(ctx, vk, *dryRun)
+		migrated += n
+		if err != nil {
+			log.Fatalf("migrate endpoints: %v", err)
+		}
+	}
+	if *dryRun {
+		fmt.Fprintf(os.Stderr, "%d keys would be renamed, %d endpoints would be migrated (dry run)\n",
+			renamed, migrated)
+	} else {
+		fmt.Fprintf(os.Stderr, "%d keys renamed, %d endpoints migrated\n", renamed, migrated)
+	}
+}
+
+// renameLegacyKeys renames the hashes of the endpoints and their states stored
+// on the shard of vk without hash tag, e.g. endpoints:libvirt to
+// endpoints:{libvirt}, and returns the number of keys renamed.
+func renameLegacyKeys(ctx context.Context, vk valkey.Client, dryRun bool) (int, error) {
+	renamed := 0
+	targets := map[string]func(string) string{
+		"endpoints:*": meow.EndpointKey,
+		"state:*":     meow.StateKey,
+	}
+	for pattern, target := range targets {
+		keys, err := scanKeys(ctx, vk, pattern)
+		if err != nil {
+			return renamed, err
+		}
+		for _, key := range keys {
+			newKey := target(meow.KeyIdentifier(key))
+			if key == newKey {
+				continue
+			}
+			fmt.Printf("%s: rename to %s\n", key, newKey)
+			renamed++
+			if dryRun {
+				continue
+			}
+			if err := renameHash(ctx, vk, key, newKey); err != nil {
+				return renamed, err
+			}
+		}
+	}
+	return renamed, nil
+}
+
+// renameHash renames the hash at key to newKey, which must not exist yet. The
+// keys may belong to different slots of a cluster, which rules out RENAME.
+func renameHash(ctx context.Context, vk valkey.Client, key, newKey string) error {
+	kvs, err := vk.Do(ctx, vk.B().Hgetall().Key(key).Build()).AsStrMap()
+	if err != nil {
+		return fmt.Errorf("hgetall %s: %v", key, err)
+	}
+	exists, err := vk.Do(ctx, vk.B().Exists().Key(newKey).Build()).AsInt64()
+	if err != nil {
+		return fmt.Errorf("exists %s: %v", newKey, err)
+	}
+	if exists > 0 {
+		return fmt.Errorf("rename %s: %s already exists", key, newKey)
+	}
+	hset := vk.B().Hset().Key(newKey).FieldValue()
+	for field, value := range kvs {
+		hset = hset.FieldValue(field, value)
+	}
+	if err := vk.Do(ctx, hset.Build()).Error(); err != nil {
+		return fmt.Errorf("hset %s: %v", newKey, err)
+	}
+	if err := vk.Do(ctx, vk.B().Del().Key(key).Build()).Error(); err != nil {
+		return fmt.Errorf("del %s: %v", key, err)
+	}
+	return nil
+}
+
+// migrateShard normalizes the hashes of all endpoints stored on the shard of
+// vk, and returns the number of endpoints changed.
+func migrateShard(ctx context.Context, vk valkey.Client, dryRun bool) (int, error) {
+	keys, err := scanKeys(ctx, vk, "endpoints:*")
+	if err != nil {
+		return 0, err
+	}
+	migrated := 0
+	for _, key := range keys {
+		kvs, err := vk.Do(ctx, vk.B().Hgetall().Key(key).Build()).AsStrMap()
+		if err != nil {
+			return migrated, fmt.Errorf("hgetall %s: %v", key, err)
+		}
+		changes := normalize(meow.KeyIdentifier(key), kvs)
+		if len(changes) == 0 {
+			continue
+		}
+		for _, c := range changes {
+			fmt.Printf("%s: %s %q -> %q\n", key, c.field, c.old, c.new)
+		}
+		migrated++
+		if dryRun {
+			continue
+		}
+		hset := vk.B().Hset().Key(key).FieldValue()
+		for _, c := range changes {
+			hset = hset.FieldValue(c.field, c.new)
+		}
+		if err := vk.Do(ctx, hset.Build()).Error(); err != nil {
+			return migrated, fmt.Errorf("hset %s: %v", key, err)
+		}
+	}
+	return migrated, nil
+}
+
+// scanKeys returns the keys matching pattern by scanning all nodes vk is
+// connected to, which are several for a cluster.
+func scanKeys(ctx context.Context, vk valkey.Client, pattern string) ([]string, error) {
+	seen := make(map[string]bool)
+	keys := make([]string, 0)
+	for _, node := range vk.Nodes() {
+		var cursor uint64
+		for {
+			cmd := node.B().Scan().Cursor(cursor).Match(pattern).Count(100).Build()
+			entry, err := node.Do(ctx, cmd).AsScanEntry()
+			if err != nil {
+				return nil, fmt.Errorf("scan %s: %v", pattern, err)
+			}
+			for _, key := range entry.Elements {
+				if !seen[key] {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			}
+			cursor = entry.Cursor
+			if cursor == 0 {
+				break
+			}
+		}
+	}
+	return keys, nil
+}
+
+// change describes the normalization of a hash field.
+type change struct {
+	field, old, new string
+}
+
+// normalize returns the changes required to bring the hash of the endpoint
+// with identifier into its canonical form: the identifier matches the key,
+// methods are upper case, URLs have a lower case scheme and host, and the
+// frequency is set and formatted like a time.Duration.
+func normalize(identifier string, kvs map[string]string) []change {
+	changes := make([]change, 0)
+	set := func(field, value string) {
+		if kvs[field] != value {
+			changes = append(changes, change{field, kvs[field], value})
+		}
+	}
+	if kvs[meow.FieldIdentifier] == "" {
+		set(meow.FieldIdentifier, identifier)
+	}
+	set(meow.FieldMethod, strings.ToUpper(strings.TrimSpace(kvs[meow.FieldMethod])))
+	if rawURL := strings.TrimSpace(kvs[meow.FieldURL]); meow.IsURLTemplate(rawURL) {
+		set(meow.FieldURL, rawURL)
+	} else if u, err := url.Parse(rawURL); err == nil {
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+		set(meow.FieldURL, u.String())
+	}
+	if kvs[meow.FieldFrequency] == "" {
+		set(meow.FieldFrequency, meow.DefaultFrequency.String())
+	} else if d, err := time.ParseDuration(kvs[meow.FieldFrequency]); err == nil {
+		set(meow.FieldFrequency, d.String())
+	}
+	return changes
+}
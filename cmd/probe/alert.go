@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/patrickbucher/meow"
+	"github.com/valkey-io/valkey-go"
+)
+
+// alertSender sends alerts using the notifier of each channel, and pushes those
+// that could not be delivered to a channel to the failed alerts, whose delivery
+// it retries.
+type alertSender struct {
+	shards   *meow.Shards
+	notifier func(meow.AlertChannel) meow.Notifier
+}
+
+// send sends the alert about the endpoint to the channels concurrently, and
+// returns the errors of the channels it could not be delivered to, as well as
+// of pushing it to the failed alerts for them. Alerts to webhooks are signed
+// with the endpoint's webhook secret; if it cannot be read, they are not sent,
+// since the receiver would reject them, but pushed to the failed alerts right
+// away.
+func (s *alertSender) send(ctx context.Context, e meow.Endpoint, channels []meow.AlertChannel, alert meow.Alert) []error {
+	secret, secretErr := s.webhookSecret(ctx, e)
+	alert.WebhookSecret = secret
+	errs := make([]error, len(channels))
+	// the notifiers, and the index of the channel of each
+	notifiers := make(meow.MultiNotifier, 0, len(channels))
+	indices := make([]int, 0, len(channels))
+	for i, channel := range channels {
+		if channel.Type == meow.AlertWebhook && secretErr != nil {
+			errs[i] = secretErr
+			continue
+		}
+		notifiers = append(notifiers, s.notifier(channel))
+		indices = append(indices, i)
+	}
+	for i, err := range notifiers.NotifyEach(ctx, alert) {
+		errs[indices[i]] = err
+	}
+
+	var failures []error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		failures = append(failures, err)
+		failed := meow.NewFailedAlert(channels[i], alert, err, time.Now())
+		if err := meow.PushFailedAlert(ctx, s.shards.All()[0], failed); err != nil {
+			failures = append(failures, err)
+		}
+	}
+	return failures
+}
+
+// retry retries the delivery of the failed alerts due at the given time, and
+// returns the number of alerts delivered.
+func (s *alertSender) retry(ctx context.Context, at time.Time) (int, error) {
+	return meow.RetryFailedAlerts(ctx, s.shards.All()[0], at, func(failed meow.FailedAlert) error {
+		alert := failed.Alert
+		if failed.Channel.Type == meow.AlertWebhook {
+			// the webhook secret is not kept with the failed alert
+			secret, err := s.storedWebhookSecret(ctx, alert.Identifier)
+			if err != nil {
+				return err
+			}
+			alert.WebhookSecret = secret
+		}
+		return s.notifier(failed.Channel).Notify(ctx, alert)
+	})
+}
+
+// webhookSecret returns the webhook secret of the endpoint if it has a webhook
+// alert channel, and an empty string otherwise.
+func (s *alertSender) webhookSecret(ctx context.Context, e meow.Endpoint) (string, error) {
+	if !slices.ContainsFunc(e.Alerts, func(channel meow.AlertChannel) bool {
+		return channel.Type == meow.AlertWebhook
+	}) {
+		return "", nil
+	}
+	return s.storedWebhookSecret(ctx, e.Identifier)
+}
+
+// storedWebhookSecret reads the webhook secret of the endpoint with identifier
+// from Valkey, since it is not returned by the config server.
+func (s *alertSender) storedWebhookSecret(ctx context.Context, identifier string) (string, error) {
+	vk := s.shards.For(identifier)
+	cmd := vk.B().Hget().Key(meow.EndpointKey(identifier)).Field(meow.FieldWebhookSecret).Build()
+	secret, err := vk.Do(ctx, cmd).ToString()
+	if valkey.IsValkeyNil(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("get webhook secret of %s: %v", identifier, err)
+	}
+	return secret, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/patrickbucher/meow"
+	"github.com/valkey-io/valkey-go"
+)
+
+// newTestShards returns n shards of an in-memory Valkey server, which is shut
+// down once the test is done.
+func newTestShards(t *testing.T, n int) (*meow.Shards, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	// miniredis does not support client-side caching
+	options := valkey.ClientOption{InitAddress: []string{server.Addr()}, DisableCache: true}
+	shards, err := meow.NewShardsWithOptions(options, n)
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	t.Cleanup(shards.Close)
+	return shards, server
+}
+
+// webhookReceiver records the valid signatures of the alerts posted to it.
+type webhookReceiver struct {
+	secret string
+
+	mu       sync.Mutex
+	received int
+	signed   int
+}
+
+func (h *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.received++
+	timestamp := r.Header.Get(meow.WebhookTimestampHeader)
+	nonce := r.Header.Get(meow.WebhookNonceHeader)
+	if r.Header.Get(meow.WebhookSignatureHeader) == meow.SignWebhook(h.secret, timestamp, nonce, body) {
+		h.signed++
+	}
+}
+
+func (h *webhookReceiver) counts() (received, signed int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.received, h.signed
+}
+
+func TestAlertSenderRetriesAlertsWithUnreadableWebhookSecret(t *testing.T) {
+	shards, server := newTestShards(t, 1)
+	receiver := &webhookReceiver{secret: "s3cr3t"}
+	webhook := httptest.NewServer(receiver)
+	defer webhook.Close()
+	alerter := &meow.Alerter{Client: webhook.Client()}
+	sender := &alertSender{shards: shards, notifier: alerter.Notifier}
+	ctx := context.Background()
+
+	e := meow.Endpoint{
+		Identifier: "libvirt",
+		Alerts:     []meow.AlertChannel{{Type: meow.AlertWebhook, Target: webhook.URL}},
+	}
+	alert := meow.Alert{Identifier: e.Identifier, State: meow.StateDown, At: time.Now(), Message: "libvirt is down"}
+
+	// reading the webhook secret fails, since the key holds no hash
+	server.Set(meow.EndpointKey(e.Identifier), "corrupt")
+	if errs := sender.send(ctx, e, e.Alerts, alert); len(errs) != 1 {
+		t.Fatalf("got errors %v, want the one reading the webhook secret", errs)
+	}
+	if received, _ := receiver.counts(); received != 0 {
+		t.Errorf("webhook received %d alerts without a secret, want none", received)
+	}
+	failed, err := meow.FailedAlerts(ctx, shards.All()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].Alert.WebhookSecret != "" {
+		t.Fatalf("got failed alerts %+v, want the alert without its secret", failed)
+	}
+
+	server.Del(meow.EndpointKey(e.Identifier))
+	server.HSet(meow.EndpointKey(e.Identifier), meow.FieldWebhookSecret, "s3cr3t")
+	delivered, err := sender.retry(ctx, failed[0].FailedAt.Add(meow.AlertRetryDelay))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered != 1 {
+		t.Errorf("delivered %d failed alerts, want 1", delivered)
+	}
+	if received, signed := receiver.counts(); received != 1 || signed != 1 {
+		t.Errorf("webhook received %d alerts, %d of them signed, want 1 signed", received, signed)
+	}
+	if failed, err := meow.FailedAlerts(ctx, shards.All()[0]); err != nil || len(failed) != 0 {
+		t.Errorf("got failed alerts %+v (%v) after delivery, want none", failed, err)
+	}
+}
+
+// fakeNotifier records the alerts sent to it, and fails with err, if set.
+type fakeNotifier struct {
+	err error
+
+	mu     sync.Mutex
+	alerts []meow.Alert
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, alert meow.Alert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.alerts = append(n.alerts, alert)
+	return n.err
+}
+
+func (n *fakeNotifier) sent() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.alerts)
+}
+
+func TestAlertSenderPushesAlertsFailingOnSomeChannels(t *testing.T) {
+	shards, _ := newTestShards(t, 1)
+	notifiers := map[string]*fakeNotifier{
+		"ops@example.com": {},
+		"routing-key":     {err: errors.New("status 503")},
+		"#alerts":         {},
+	}
+	sender := &alertSender{shards: shards, notifier: func(channel meow.AlertChannel) meow.Notifier {
+		return notifiers[channel.Target]
+	}}
+	ctx := context.Background()
+
+	e := meow.Endpoint{
+		Identifier: "libvirt",
+		Alerts: []meow.AlertChannel{
+			{Type: meow.AlertEmail, Target: "ops@example.com"},
+			{Type: meow.AlertPagerDuty, Target: "routing-key"},
+			{Type: meow.AlertSlack, Target: "#alerts"},
+		},
+	}
+	alert := meow.Alert{Identifier: e.Identifier, State: meow.StateDown, At: time.Now(), Message: "libvirt is down"}
+	errs := sender.send(ctx, e, e.Alerts, alert)
+	if len(errs) != 1 || errs[0].Error() != "status 503" {
+		t.Errorf("got errors %v, want the one of PagerDuty", errs)
+	}
+	for target, notifier := range notifiers {
+		if n := notifier.sent(); n != 1 {
+			t.Errorf("sent %d alerts to %s, want 1", n, target)
+		}
+	}
+	failed, err := meow.FailedAlerts(ctx, shards.All()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].Channel != e.Alerts[1] {
+		t.Fatalf("got failed alerts %+v, want the one to PagerDuty", failed)
+	}
+
+	// the delivery is retried only on the channel that failed
+	notifiers["routing-key"].err = nil
+	delivered, err := sender.retry(ctx, failed[0].FailedAt.Add(meow.AlertRetryDelay))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered != 1 {
+		t.Errorf("delivered %d failed alerts, want 1", delivered)
+	}
+	for target, want := range map[string]int{"ops@example.com": 1, "routing-key": 2, "#alerts": 1} {
+		if n := notifiers[target].sent(); n != want {
+			t.Errorf("sent %d alerts to %s, want %d", n, target, want)
+		}
+	}
+}
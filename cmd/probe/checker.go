@@ -0,0 +1,513 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/patrickbucher/meow"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checker performs the requests checking the endpoints using a shared client,
+// so that connections to the endpoints are reused across checks. Endpoints
+// requested through a proxy or pinned to an HTTP version share a client per
+// proxy and version, and endpoints checked using gRPC a connection per host.
+type checker struct {
+	client       *http.Client
+	transport    *http.Transport
+	timeout      time.Duration
+	interpolate  bool
+	userAgent    string
+	maxBodyBytes int64
+	retries      int
+
+	// dialer connects from the local address the probe is bound to, if any.
+	dialer *net.Dialer
+
+	mu        sync.Mutex
+	clients   map[string]*http.Client
+	grpcConns map[string]*grpc.ClientConn
+}
+
+// newChecker creates a checker whose requests time out after the given
+// duration, and which expands URL templates if interpolate is set. Requests are
+// sent with the given User-Agent, unless the endpoint configures its own. Up to
+// maxBodyBytes of a response body are read to verify its digest, JSON value, or
+// size. A request is retried at most retries times if the endpoint retries on
+// its status. Connections are made from localAddr, unless it is nil.
+func newChecker(timeout time.Duration, interpolate bool, userAgent string, maxBodyBytes int64, retries int, localAddr *net.TCPAddr) *checker {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 4
+	transport.IdleConnTimeout = 90 * time.Second
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.ResponseHeaderTimeout = timeout
+	var dialer *net.Dialer
+	if localAddr != nil {
+		dialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, LocalAddr: localAddr}
+		transport.DialContext = dialer.DialContext
+	}
+	return &checker{
+		client:       &http.Client{Transport: transport, CheckRedirect: checkRedirect},
+		transport:    transport,
+		timeout:      timeout,
+		interpolate:  interpolate,
+		userAgent:    userAgent,
+		maxBodyBytes: maxBodyBytes,
+		retries:      retries,
+		dialer:       dialer,
+		clients:      make(map[string]*http.Client),
+		grpcConns:    make(map[string]*grpc.ClientConn),
+	}
+}
+
+// sourceAddr returns the local address to connect from given as sourceIP, which
+// must be assigned to an interface of the host, or nil if sourceIP is empty.
+func sourceAddr(sourceIP string) (*net.TCPAddr, error) {
+	if sourceIP == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(sourceIP)
+	if ip == nil {
+		return nil, fmt.Errorf(`source IP "%s" is not an IP address`, sourceIP)
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("get interface addresses: %v", err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return &net.TCPAddr{IP: ip}, nil
+		}
+	}
+	return nil, fmt.Errorf("source IP %s is not assigned to any interface", ip)
+}
+
+// clientFor returns the client to request the endpoint with, which is shared by
+// the endpoints using the same proxy and HTTP version.
+func (c *checker) clientFor(e meow.Endpoint) *http.Client {
+	if e.Proxy == nil && e.HTTPVersion == "" {
+		return c.client
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := e.HTTPVersion + " "
+	if e.Proxy != nil {
+		key += e.Proxy.String()
+	}
+	client, ok := c.clients[key]
+	if !ok {
+		transport := c.transport.Clone()
+		if e.Proxy != nil {
+			transport.Proxy = http.ProxyURL(e.Proxy)
+		}
+		if e.HTTPVersion != "" {
+			transport.Protocols = httpProtocols(e.HTTPVersion)
+			// the shared transport adds h2 to the protocols negotiated using
+			// TLS once it is used, which the clone must not offer
+			if transport.TLSClientConfig != nil {
+				transport.TLSClientConfig.NextProtos = nil
+			}
+		}
+		client = &http.Client{Transport: transport, CheckRedirect: checkRedirect}
+		c.clients[key] = client
+	}
+	return client
+}
+
+// timeoutFor returns the timeout of the requests checking the endpoint, which
+// is the probe's, unless the endpoint configures a shorter one.
+func (c *checker) timeoutFor(e meow.Endpoint) time.Duration {
+	if e.Timeout > 0 && e.Timeout < c.timeout {
+		return e.Timeout
+	}
+	return c.timeout
+}
+
+// httpProtocols returns the protocols a transport pinned to the HTTP version
+// may use. HTTP/2 is used without TLS by prior knowledge, i.e. without
+// upgrading from HTTP/1.1.
+func httpProtocols(version string) *http.Protocols {
+	var protocols http.Protocols
+	switch version {
+	case meow.HTTPVersion11:
+		protocols.SetHTTP1(true)
+	case meow.HTTPVersion2:
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	return &protocols
+}
+
+// requestForStatus requests the endpoint and returns the status it responds
+// with, along with the first e.CaptureBodyBytes bytes of the response body. If
+// the endpoint expects a digest of the body, which the body does not match, an
+// error is returned along with the status.
+func (c *checker) requestForStatus(e meow.Endpoint) (int, []byte, error) {
+	method := e.RequestMethod()
+	status, body, err := c.request(e, method)
+	if method != e.Method && err == nil && status == http.StatusMethodNotAllowed {
+		// the server does not support HEAD requests
+		method = e.Method
+		status, body, err = c.request(e, method)
+	}
+	for retries := cmp.Or(int(e.Retries), c.retries); retries > 0 && err == nil && slices.Contains(e.RetryOnStatuses, uint16(status)); retries-- {
+		status, body, err = c.request(e, method)
+	}
+	return status, body, err
+}
+
+// request requests the endpoint using method for requestForStatus.
+func (c *checker) request(e meow.Endpoint, method string) (int, []byte, error) {
+	target, err := c.targetURL(e)
+	if err != nil {
+		return 0, nil, fmt.Errorf("resolve URL of %s: %v", e.Identifier, err)
+	}
+	maxRedirects := int(e.MaxRedirects)
+	if maxRedirects == 0 {
+		maxRedirects = meow.DefaultMaxRedirects
+	}
+	if e.ExpectRedirectTo != nil {
+		maxRedirects = 0
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeoutFor(e))
+	defer cancel()
+	ctx = context.WithValue(ctx, maxRedirectsKey{}, maxRedirects)
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("prepare request: %s %s %s: %v", e.Identifier, method, target, err)
+	}
+	userAgent := e.UserAgent
+	if userAgent == "" {
+		userAgent = c.userAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	res, err := c.clientFor(e).Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("perform request %s %s %s: %w", e.Identifier, method, target, err)
+	}
+	defer res.Body.Close()
+	locationErr := verifyLocation(e, res)
+	counted := &countingReader{r: res.Body}
+	var body []byte
+	var bodyErr error
+	switch {
+	case e.ExpectSHA256 != "":
+		body, bodyErr = c.verifyDigest(e, counted)
+	case e.ExpectJSONPath != "":
+		body, bodyErr = c.verifyJSONPath(e, counted)
+	default:
+		body = make([]byte, e.CaptureBodyBytes)
+		n, _ := io.ReadFull(counted, body)
+		body = body[:n]
+	}
+	if bodyErr == nil {
+		bodyErr = c.verifyBodySize(e, counted)
+	}
+	// drain (a reasonable amount of) the body, so that the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	return res.StatusCode, body, cmp.Or(bodyErr, locationErr)
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// bodySizeMismatch fails a check of an endpoint whose response body is smaller
+// or larger than expected. The size is only counted up to the limit.
+type bodySizeMismatch struct {
+	identifier string
+	size       int64
+	min, max   uint32
+	limit      int64
+}
+
+func (m *bodySizeMismatch) Error() string {
+	switch {
+	case m.size < int64(m.min):
+		return fmt.Sprintf("body of %s has %d bytes instead of at least %d", m.identifier, m.size, m.min)
+	case m.size > m.limit:
+		return fmt.Sprintf("body of %s has more than %d bytes instead of at most %d", m.identifier, m.limit, m.max)
+	default:
+		return fmt.Sprintf("body of %s has %d bytes instead of at most %d", m.identifier, m.size, m.max)
+	}
+}
+
+// verifyBodySize reads the rest of the response body as far as needed to count
+// its size, and returns a *bodySizeMismatch if it is out of the bounds of the
+// endpoint, if any. Bodies are counted up to maxBodyBytes, regardless of their
+// Content-Length.
+func (c *checker) verifyBodySize(e meow.Endpoint, counted *countingReader) error {
+	if e.MinBodyBytes == 0 && e.MaxBodyBytes == 0 {
+		return nil
+	}
+	limit := int64(e.MinBodyBytes)
+	if e.MaxBodyBytes > 0 {
+		limit = max(c.maxBodyBytes, int64(e.MaxBodyBytes)) + 1
+	}
+	if counted.n < limit {
+		if _, err := io.Copy(io.Discard, io.LimitReader(counted, limit-counted.n)); err != nil {
+			return fmt.Errorf("read body of %s: %v", e.Identifier, err)
+		}
+	}
+	if counted.n < int64(e.MinBodyBytes) || e.MaxBodyBytes > 0 && counted.n > int64(e.MaxBodyBytes) {
+		return &bodySizeMismatch{e.Identifier, counted.n, e.MinBodyBytes, e.MaxBodyBytes, limit - 1}
+	}
+	return nil
+}
+
+// locationMismatch fails a check of an endpoint redirecting elsewhere than
+// expected.
+type locationMismatch struct {
+	identifier string
+	location   string
+	expected   string
+}
+
+func (m *locationMismatch) Error() string {
+	return fmt.Sprintf("%s redirects to %q instead of %q", m.identifier, m.location, m.expected)
+}
+
+// verifyLocation returns a *locationMismatch if the response is a redirect to
+// another location than the one expected by the endpoint, if any.
+func verifyLocation(e meow.Endpoint, res *http.Response) error {
+	if e.ExpectRedirectTo == nil || res.StatusCode < 300 || res.StatusCode > 399 {
+		return nil
+	}
+	location := ""
+	if u, err := res.Location(); err == nil {
+		location = u.String()
+	}
+	if expected := e.ExpectRedirectTo.String(); location != expected {
+		return &locationMismatch{e.Identifier, location, expected}
+	}
+	return nil
+}
+
+// maxRedirectsKey is the key of the context value holding the maximum number of
+// redirects to be followed for a request, which are not followed if it is 0.
+type maxRedirectsKey struct{}
+
+// errTooManyRedirects fails a check exceeding the endpoint's MaxRedirects.
+var errTooManyRedirects = errors.New("too many redirects")
+
+// checkRedirect stops following redirects once the maximum number given in the
+// request's context is exceeded.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	maxRedirects, ok := req.Context().Value(maxRedirectsKey{}).(int)
+	if !ok {
+		maxRedirects = meow.DefaultMaxRedirects
+	}
+	if maxRedirects == 0 {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > maxRedirects {
+		return errTooManyRedirects
+	}
+	return nil
+}
+
+// attempt is the outcome of requesting one of the URLs of an endpoint, whose
+// password, if any, is redacted.
+type attempt struct {
+	url    string
+	status int
+	body   []byte
+	err    error
+}
+
+// requestURLs requests the URL of the endpoint, and then its failover URLs in
+// order until one responds with a status classified as up, and returns the
+// attempts made.
+func (c *checker) requestURLs(e meow.Endpoint) []attempt {
+	status, body, err := c.requestForStatus(e)
+	rawURL := e.URLTemplate
+	if rawURL == "" {
+		rawURL = e.URL.Redacted()
+	}
+	attempts := []attempt{{rawURL, status, body, err}}
+	for _, u := range e.FailoverURLs {
+		if err == nil && e.Classify(status) == meow.StateUp {
+			break
+		}
+		failover := e
+		failover.URL, failover.URLTemplate = u, ""
+		status, body, err = c.requestForStatus(failover)
+		attempts = append(attempts, attempt{u.Redacted(), status, body, err})
+	}
+	return attempts
+}
+
+// bodyMismatch fails a check of an endpoint whose response body lacks the
+// digest or JSON value expected.
+type bodyMismatch struct {
+	message string
+}
+
+func (m *bodyMismatch) Error() string {
+	return m.message
+}
+
+// bodyTooLarge fails a check of an endpoint whose response body exceeds the
+// limit of bytes read to verify it, so that it cannot be verified.
+type bodyTooLarge struct {
+	identifier string
+	verb       string
+	limit      int64
+}
+
+func (t *bodyTooLarge) Error() string {
+	return fmt.Sprintf("body of %s exceeds %d bytes to be %s (see -max-body-bytes)", t.identifier, t.limit, t.verb)
+}
+
+// failureReason returns the reason a check failed with err for.
+func failureReason(err error) meow.FailureReason {
+	var dnsErr *net.DNSError
+	var certErr x509.CertificateInvalidError
+	var verificationErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var netErr net.Error
+	var sizeMismatch *bodySizeMismatch
+	var contentMismatch *bodyMismatch
+	var tooLarge *bodyTooLarge
+	var redirectMismatch *locationMismatch
+	switch {
+	case errors.As(err, &tooLarge):
+		return meow.ReasonBodyTooLarge
+	case errors.As(err, &sizeMismatch), errors.As(err, &contentMismatch):
+		return meow.ReasonBodyMismatch
+	case errors.As(err, &redirectMismatch):
+		return meow.ReasonRedirectMismatch
+	case errors.Is(err, errTooManyRedirects):
+		return meow.ReasonTooManyRedirects
+	case errors.As(err, &certErr) && certErr.Reason == x509.Expired:
+		return meow.ReasonCertificateExpired
+	case errors.As(err, &verificationErr), errors.As(err, &recordErr):
+		return meow.ReasonTLS
+	case errors.As(err, &dnsErr):
+		return meow.ReasonDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return meow.ReasonConnectionRefused
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout(),
+		status.Code(err) == codes.DeadlineExceeded:
+		return meow.ReasonTimeout
+	default:
+		return meow.ReasonRequest
+	}
+}
+
+// verifyDigest reads the response body, and returns an error if its SHA-256
+// digest differs from the one expected by the endpoint, or if it exceeds
+// maxBodyBytes. The first e.CaptureBodyBytes bytes of the body are returned.
+func (c *checker) verifyDigest(e meow.Endpoint, r io.Reader) ([]byte, error) {
+	digest := sha256.New()
+	body := make([]byte, e.CaptureBodyBytes)
+	n, err := io.ReadFull(io.TeeReader(r, digest), body)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return body[:n], fmt.Errorf("read body of %s: %v", e.Identifier, err)
+	}
+	read, err := io.Copy(digest, io.LimitReader(r, c.maxBodyBytes-int64(n)+1))
+	if err != nil {
+		return body[:n], fmt.Errorf("read body of %s: %v", e.Identifier, err)
+	}
+	if int64(n)+read > c.maxBodyBytes {
+		return body[:n], &bodyTooLarge{e.Identifier, "hashed", c.maxBodyBytes}
+	}
+	if actual := hex.EncodeToString(digest.Sum(nil)); actual != e.ExpectSHA256 {
+		return body[:n], &bodyMismatch{fmt.Sprintf("body of %s has SHA-256 digest %s instead of %s",
+			e.Identifier, actual, e.ExpectSHA256)}
+	}
+	return body[:n], nil
+}
+
+// verifyJSONPath reads the response body as JSON, and returns an error if it
+// lacks the value expected by the endpoint at its path, or if it exceeds
+// maxBodyBytes. The first e.CaptureBodyBytes bytes of the body are returned.
+func (c *checker) verifyJSONPath(e meow.Endpoint, r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, c.maxBodyBytes+1))
+	captured := data[:min(len(data), int(e.CaptureBodyBytes))]
+	if err != nil {
+		return captured, fmt.Errorf("read body of %s: %v", e.Identifier, err)
+	}
+	if int64(len(data)) > c.maxBodyBytes {
+		return captured, &bodyTooLarge{e.Identifier, "parsed", c.maxBodyBytes}
+	}
+	var document any
+	if err := json.Unmarshal(data, &document); err != nil {
+		return captured, &bodyMismatch{fmt.Sprintf("body of %s is not JSON: %v", e.Identifier, err)}
+	}
+	// validated when the endpoint was stored
+	path, _ := meow.ParseJSONPath(e.ExpectJSONPath)
+	actual, ok := path.Lookup(document)
+	if !ok {
+		return captured, &bodyMismatch{fmt.Sprintf("body of %s has no value at %s", e.Identifier, e.ExpectJSONPath)}
+	}
+	if !reflect.DeepEqual(actual, e.ExpectJSONValue) {
+		got, _ := json.Marshal(actual)
+		expected, _ := json.Marshal(e.ExpectJSONValue)
+		return captured, &bodyMismatch{fmt.Sprintf("body of %s has %s at %s instead of %s",
+			e.Identifier, got, e.ExpectJSONPath, expected)}
+	}
+	return captured, nil
+}
+
+// targetURL returns the URL to be requested for the endpoint, including its
+// query parameters rendered for now. A URL template is expanded from the
+// environment, which requires interpolation to be enabled.
+func (c *checker) targetURL(e meow.Endpoint) (*url.URL, error) {
+	if e.URLTemplate == "" {
+		return meow.RenderQueryParams(e.URL, e.QueryParams, time.Now()), nil
+	}
+	if !c.interpolate {
+		return nil, fmt.Errorf(`URL template "%s" requires flag -interpolate`, e.URLTemplate)
+	}
+	target, err := meow.ExpandURLTemplate(e.URLTemplate, os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	return meow.RenderQueryParams(target, e.QueryParams, time.Now()), nil
+}
+
+// hasCredentials reports whether the endpoint is requested with credentials,
+// whose use might be reflected in the response body. Endpoints are requested
+// with the auth headers Authorization if the URL requested, i.e. its URL as
+// expanded from its template, or a failover URL, contains credentials, and
+// Proxy-Authorization if its proxy does.
+func (c *checker) hasCredentials(e meow.Endpoint) bool {
+	if e.Proxy != nil && e.Proxy.User != nil {
+		return true
+	}
+	if slices.ContainsFunc(e.FailoverURLs, func(u *url.URL) bool { return u.User != nil }) {
+		return true
+	}
+	// an endpoint whose URL cannot be resolved is not requested
+	target, err := c.targetURL(e)
+	return err == nil && target.User != nil
+}
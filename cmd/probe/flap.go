@@ -0,0 +1,35 @@
+package main
+
+import "time"
+
+// flapDetector tracks the state changes of an endpoint, which is considered to
+// be flapping as long as threshold changes happened within the window.
+type flapDetector struct {
+	window    time.Duration
+	threshold int
+
+	changes  []time.Time
+	flapping bool
+}
+
+// record adds a state change at the given time.
+func (d *flapDetector) record(at time.Time) {
+	d.changes = append(d.changes, at)
+}
+
+// update forgets the state changes outside the window ending now, and reports
+// whether the endpoint is flapping, and whether this changed since the last
+// update. A threshold of 0 disables flap detection.
+func (d *flapDetector) update(now time.Time) (flapping, changed bool) {
+	if d.threshold <= 0 {
+		return false, false
+	}
+	i := 0
+	for i < len(d.changes) && now.Sub(d.changes[i]) > d.window {
+		i++
+	}
+	d.changes = d.changes[i:]
+	was := d.flapping
+	d.flapping = len(d.changes) >= d.threshold
+	return d.flapping, d.flapping != was
+}
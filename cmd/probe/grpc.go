@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/patrickbucher/meow"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// checkHealth calls the gRPC health check of the endpoint and returns the
+// serving status it responds with, e.g. SERVING.
+func (c *checker) checkHealth(e meow.Endpoint) (string, error) {
+	target, err := c.targetURL(e)
+	if err != nil {
+		return "", fmt.Errorf("resolve URL of %s: %v", e.Identifier, err)
+	}
+	conn, err := c.grpcConn(target.Scheme, target.Host)
+	if err != nil {
+		return "", fmt.Errorf("connect to %s at %s: %v", e.Identifier, target.Host, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeoutFor(e))
+	defer cancel()
+	req := &healthpb.HealthCheckRequest{Service: strings.TrimPrefix(target.Path, "/")}
+	res, err := healthpb.NewHealthClient(conn).Check(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("check health of %s at %s: %w", e.Identifier, target.Host, err)
+	}
+	return res.GetStatus().String(), nil
+}
+
+// grpcConn returns the connection to the host, which is shared by the
+// endpoints checked there, using TLS for the scheme grpcs.
+func (c *checker) grpcConn(scheme, host string) (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := scheme + "://" + host
+	if conn, ok := c.grpcConns[key]; ok {
+		return conn, nil
+	}
+	creds := insecure.NewCredentials()
+	if scheme == "grpcs" {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if c.dialer != nil {
+		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return c.dialer.DialContext(ctx, "tcp", addr)
+		}))
+	}
+	conn, err := grpc.NewClient(host, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.grpcConns[key] = conn
+	return conn, nil
+}
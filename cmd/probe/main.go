@@ -2,21 +2,50 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/patrickbucher/meow"
+	"github.com/valkey-io/valkey-go"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func main() {
+	interpolate := flag.Bool("interpolate", false, "expand ${VAR} in endpoint URLs from the environment")
+	flag.DurationVar(&meow.ProbeTimeout, "timeout", meow.ProbeTimeout, "timeout for each request checking an endpoint")
+	flapWindow := flag.Duration("flap-window", 10*time.Minute, "window for counting state changes to detect flapping")
+	flapThreshold := flag.Int("flap-threshold", 5, "state changes within -flap-window to consider an endpoint flapping (0: disabled)")
+	userAgent := flag.String("user-agent", meow.DefaultUserAgent(), "User-Agent header of requests to endpoints not configuring their own")
+	maxBodyBytes := flag.Int64("max-body-bytes", 16<<20, "maximum number of bytes of a response body read to verify its SHA-256 digest, JSON value, or size")
+	retries := flag.Int("retries", 2, "number of times a check is retried on a status the endpoint retries on")
+	workers := flag.Int("workers", 100, "number of checks run concurrently at most")
+	batchSize := flag.Int("batch-size", 100, "number of state writes per shard sent to Valkey at once (1: disables batching)")
+	batchInterval := flag.Duration("batch-interval", time.Second, "interval of sending the state writes buffered to Valkey")
+	listen := flag.String("listen", "", "address to offer the HTTP API on, e.g. :9115 (default: disabled)")
+	sourceIP := flag.String("source-ip", "", "local IP address to check the endpoints from (default: chosen by the system)")
+	region := flag.String("region", "", "region the probe runs in, whose outcomes of checks are recorded separately (default: none)")
+	flag.Parse()
+
+	if *region != "" {
+		if err := meow.ValidateRegion(*region); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
 	configURL, ok := os.LookupEnv("CONFIG_URL")
 	if !ok {
 		fmt.Fprintln(os.Stderr, "environment variable CONFIG_URL must be set")
@@ -24,6 +53,12 @@ func main() {
 	}
 	endpoints := mustFetchEndpoints(configURL)
 
+	shards, err := meow.ShardsFromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	logFileName := fmt.Sprintf("meow-%v.log", time.Now().Format("2006-01-02T15-04-05"))
 	logFilePath := strings.Join([]string{os.TempDir(), logFileName}, string(os.PathSeparator))
 	logFile, err := meow.NewLogFile(logFilePath)
@@ -33,7 +68,47 @@ func main() {
 	}
 	fmt.Fprintf(os.Stderr, "started logging to %s\n", logFilePath)
 
-	go monitor(endpoints, logFile)
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	owner := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+
+	smtpServer, err := meow.SMTPServerFromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	alerter := &meow.Alerter{Client: &http.Client{Timeout: 10 * time.Second}, SMTP: smtpServer}
+
+	localAddr, err := sourceAddr(*sourceIP)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	checker := newChecker(meow.ProbeTimeout, *interpolate, *userAgent, *maxBodyBytes, *retries, localAddr)
+	if *listen != "" {
+		go func() {
+			if err := serve(*listen, checker); err != nil {
+				fmt.Fprintf(os.Stderr, "serve HTTP API on %s: %v\n", *listen, err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	flaps := flapDetector{window: *flapWindow, threshold: *flapThreshold}
+	batch := meow.NewStateBatch(shards, *batchSize, *batchInterval, func(err error) {
+		message := fmt.Sprintf("%c %v", meow.CrossMark, err)
+		fmt.Fprintln(os.Stderr, message)
+		logFile.WriteLine(message)
+	})
+	if *region != "" {
+		if err := meow.RegisterRegion(context.Background(), shards.All()[0], *region); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	go monitor(endpoints, logFile, checker, alerter, flaps, shards, batch, owner, *region, *workers)
 
 	done := make(chan struct{})
 	signals := make(chan os.Signal, 1)
@@ -41,6 +116,9 @@ func main() {
 	go func() {
 		s := <-signals
 		fmt.Fprintf(os.Stderr, "signal %v received\n", s)
+		if err := batch.Close(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "%c %v\n", meow.CrossMark, err)
+		}
 		logFile.Close()
 		// TODO: now it would be a good time to archive logFilePath to S3
 		done <- struct{}{}
@@ -49,24 +127,295 @@ func main() {
 	<-done
 }
 
-func monitor(endpoints []meow.Endpoint, logger *meow.LogFile) {
-	probe := func(e meow.Endpoint, messages chan string) {
-		messages <- fmt.Sprintf("started probing %s every %v", e.Identifier, e.Frequency)
-		freq := time.NewTicker(e.Frequency)
+// alertRetryInterval is how often the failed alerts due are retried.
+const alertRetryInterval = 10 * time.Second
+
+// monitor checks the endpoints, unless another instance of the probe holds the
+// lease on checking an endpoint, in which case owner takes over the checks once
+// the lease expires. The flap detector is copied for each endpoint. The checks
+// are run by the given number of workers, which record their outcome using the
+// batch. Alerts that could not be delivered are retried by the instance holding
+// the lease on them. If the probe runs in a region, it skips the endpoints not
+// checked from there, and records the outcome of its checks for the region,
+// too. Holding the lease on checking an endpoint in its region, it checks the
+// endpoint even if another instance holds the lease on it, but then records the
+// outcome only for the region.
+func monitor(endpoints []meow.Endpoint, logger *meow.LogFile, checker *checker, alerter *meow.Alerter, flaps flapDetector, shards *meow.Shards, batch *meow.StateBatch, owner, region string, workers int) {
+	ctx := context.Background()
+
+	// the states are read from Valkey, since endpoints may be checked by other
+	// instances of the probe
+	storedState := func(identifier string) (string, error) {
+		vk := shards.For(identifier)
+		cmd := vk.B().Hget().Key(meow.StateKey(identifier)).Field(meow.StateFieldState).Build()
+		s, err := vk.Do(ctx, cmd).ToString()
+		if valkey.IsValkeyNil(err) {
+			return meow.StateUnknown, nil
+		} else if err != nil {
+			return "", fmt.Errorf("get state of %s: %v", identifier, err)
+		}
+		return s, nil
+	}
+	storedAlertState := func(identifier string) (string, time.Time, int, error) {
+		vk := shards.For(identifier)
+		cmd := vk.B().Hmget().Key(meow.StateKey(identifier)).Field(meow.StateFieldState, meow.StateFieldLastAlerted, meow.StateFieldConsecutiveFailures).Build()
+		values, err := vk.Do(ctx, cmd).ToArray()
+		if err != nil {
+			return "", time.Time{}, 0, fmt.Errorf("get state of %s: %v", identifier, err)
+		}
+		s, err := values[0].ToString()
+		if valkey.IsValkeyNil(err) {
+			return meow.StateUnknown, time.Time{}, 0, nil
+		}
+		var lastAlerted time.Time
+		if raw, err := values[1].ToString(); err == nil && s == meow.StateDown {
+			lastAlerted, _ = time.Parse(time.RFC3339Nano, raw)
+		}
+		failures := 0
+		if raw, err := values[2].ToString(); err == nil {
+			failures, _ = strconv.Atoi(raw)
+		}
+		return s, lastAlerted, failures, nil
+	}
+	blockingDependency := func(e meow.Endpoint) (string, error) {
+		for _, dependency := range e.DependsOn {
+			s, err := storedState(dependency)
+			if err != nil {
+				return "", err
+			}
+			if s == meow.StateDown || s == meow.StateBlocked {
+				return dependency, nil
+			}
+		}
+		return "", nil
+	}
+	sender := &alertSender{shards: shards, notifier: alerter.Notifier}
+	sendAlerts := func(data meow.AlertData, channels []meow.AlertChannel, messages chan string) {
+		e := data.Endpoint
+		message, err := meow.RenderAlertMessage(e.AlertTemplate, data)
+		if err != nil {
+			messages <- fmt.Sprintf("%c alert of %s: %v", meow.CrossMark, e.Identifier, err)
+			message, _ = meow.RenderAlertMessage(meow.DefaultAlertTemplate, data)
+		}
+		alert := meow.Alert{
+			Identifier: e.Identifier,
+			State:      data.State,
+			At:         data.At,
+			Message:    message,
+			Status:     data.Status,
+			Error:      data.Error,
+		}
+		go func() {
+			for _, err := range sender.send(ctx, e, channels, alert) {
+				messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+			}
+		}()
+	}
+	retryFailedAlerts := func(messages chan string) {
+		vk := shards.All()[0]
+		for range time.Tick(alertRetryInterval) {
+			held, _, err := meow.HoldLease(ctx, vk, meow.FailedAlertsKey, owner, 2*alertRetryInterval)
+			if err != nil {
+				messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+				continue
+			} else if !held {
+				continue
+			}
+			delivered, err := sender.retry(ctx, time.Now())
+			if err != nil {
+				messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+			}
+			if delivered > 0 {
+				messages <- fmt.Sprintf("delivered %d failed alerts", delivered)
+			}
+		}
+	}
+
+	probe := func(e meow.Endpoint, messages chan string) func() {
+		if e.Offset > 0 {
+			messages <- fmt.Sprintf("started probing %s every %v at offset %v", e.Identifier, e.Frequency, e.Offset)
+		} else {
+			messages <- fmt.Sprintf("started probing %s every %v", e.Identifier, e.Frequency)
+		}
+		state := meow.StateUnknown
+		flaps := flaps
+		setState := func(newState string, at time.Time) {
+			if newState == state {
+				return
+			}
+			change := meow.StateChange{
+				Identifier: e.Identifier,
+				State:      newState,
+				Previous:   state,
+				At:         at,
+			}
+			if err := batch.RecordStateChange(ctx, change); err != nil {
+				messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+			}
+			state = newState
+			flaps.record(at)
+		}
 		errorCount := 0
+		storedErrorCount := 0
+		// outcomes of the last checks, true for failed ones, for FailWindow
+		var recent []bool
 		lastStateOK := false
 		firstTry := true
-		alerted := false
-		for {
+		var lastAlerted time.Time
+		var lastServingStatus string
+		leased := false
+		ttl := 2*e.Frequency + checker.timeout
+		return func() {
+			held, acquired, err := meow.HoldLease(ctx, shards.For(e.Identifier), e.Identifier, owner, ttl)
+			if err != nil {
+				messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+				return
+			}
+			if acquired {
+				// continue from the state recorded by the previous holder, or
+				// from the state reset through the config server
+				if state, lastAlerted, errorCount, err = storedAlertState(e.Identifier); err != nil {
+					messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+					state, lastAlerted, errorCount = meow.StateUnknown, time.Time{}, 0
+				}
+				storedErrorCount = errorCount
+				recent = nil
+				firstTry = true
+				messages <- fmt.Sprintf("holding lease on checking %s", e.Identifier)
+			} else if !held && leased {
+				messages <- fmt.Sprintf("%s is checked by another instance", e.Identifier)
+			}
+			leased = held
+			regional := false
+			if region != "" {
+				var acquired bool
+				regional, acquired, err = meow.HoldRegionLease(ctx, shards.For(e.Identifier), e.Identifier, region, owner, ttl)
+				if err != nil {
+					messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+				} else if acquired {
+					messages <- fmt.Sprintf("holding lease on checking %s in region %s", e.Identifier, region)
+				}
+			}
+			if !held && !regional {
+				return
+			}
+			if now := time.Now(); e.CheckWindow != nil && !e.CheckWindow.Contains(now) {
+				if !held {
+					return
+				}
+				if state != meow.StatePausedOffHours {
+					messages <- fmt.Sprintf("%s is outside of its check window %v, pausing checks",
+						e.Identifier, e.CheckWindow)
+				}
+				setState(meow.StatePausedOffHours, now)
+				errorCount = 0
+				firstTry = true
+				return
+			}
+			dependency, err := blockingDependency(e)
+			if err != nil {
+				messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+			}
+			if dependency != "" {
+				if held {
+					// TODO: adjust log format
+					messages <- fmt.Sprintf("%c %s is blocked by %s, skipping check",
+						meow.CatUnavailable, e.Identifier, dependency)
+					setState(meow.StateBlocked, time.Now())
+				}
+				return
+			}
 			start := time.Now()
-			status, err := requestForStatus(e)
+			var status int
+			var body []byte
+			var servingStatus string
+			var attempts []attempt
+			if e.Protocol == meow.ProtocolGRPC {
+				servingStatus, err = checker.checkHealth(e)
+				if err != nil {
+					servingStatus = healthpb.HealthCheckResponse_UNKNOWN.String()
+				}
+			} else {
+				attempts = checker.requestURLs(e)
+				last := attempts[len(attempts)-1]
+				status, body, err = last.status, last.body, last.err
+			}
 			if err != nil {
 				// TODO: adjust log format
 				messages <- fmt.Sprintf("%c request failed: %v", meow.CrossMark, err)
 			}
 			end := time.Now()
 			duration := end.Sub(start)
-			stateOK := status == int(e.StatusOnline)
+			if held {
+				if err := batch.RecordLatency(ctx, e.Identifier, end, duration); err != nil {
+					messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+				}
+				update := meow.LatencyUpdate{Identifier: e.Identifier, LatencyMS: duration.Milliseconds(), At: end}
+				if err := meow.PublishLatency(ctx, shards.For(e.Identifier), update); err != nil {
+					messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+				}
+			}
+			outcome := meow.StateDown
+			if err == nil {
+				outcome = e.Classify(status)
+			}
+			stateOK := outcome == meow.StateUp
+			// a degraded check does not count as failed, but neither as online
+			degraded := outcome == meow.StateDegraded
+			if e.Protocol == meow.ProtocolGRPC {
+				stateOK = servingStatus == healthpb.HealthCheckResponse_SERVING.String()
+				if held && servingStatus != lastServingStatus {
+					err := batch.RecordServingStatus(ctx, e.Identifier, servingStatus)
+					if err != nil {
+						messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+					}
+					lastServingStatus = servingStatus
+				}
+			}
+			var reason meow.FailureReason
+			if !stateOK && !degraded {
+				switch {
+				case err != nil:
+					reason = failureReason(err)
+				case e.Protocol == meow.ProtocolGRPC:
+					reason = meow.ReasonNotServing
+				default:
+					reason = meow.ReasonStatus
+				}
+			}
+			if regional {
+				regionState := meow.RegionState{State: meow.StateDown, CheckedAt: end, FailureReason: reason}
+				if stateOK {
+					regionState.State = meow.StateUp
+				} else if degraded {
+					regionState.State = meow.StateDegraded
+				}
+				if err := batch.RecordRegionState(ctx, e.Identifier, region, regionState, ttl); err != nil {
+					messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+				}
+			}
+			if !held {
+				return
+			}
+			if stateOK || degraded {
+				errorCount = 0
+			} else {
+				errorCount++
+			}
+			if e.FailWindow > 0 {
+				recent = append(recent, !stateOK && !degraded)
+				if len(recent) > int(e.FailWindow) {
+					recent = recent[1:]
+				}
+			}
+			if errorCount != storedErrorCount {
+				if err := batch.RecordConsecutiveFailures(ctx, e.Identifier, end, errorCount, reason); err != nil {
+					messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+				}
+				storedErrorCount = errorCount
+			}
+			offline := e.Offline(errorCount, recent)
+			inMaintenance := meow.InWindows(e.MaintenanceWindows, end)
 			if stateOK {
 				if lastStateOK || firstTry {
 					// TODO: adjust log format
@@ -77,49 +426,140 @@ func monitor(endpoints []meow.Endpoint, logger *meow.LogFile) {
 					messages <- fmt.Sprintf("%c %s is online again (took %v)",
 						meow.CatAvailableAgain, e.Identifier, duration)
 				}
+				if !offline {
+					if !lastAlerted.IsZero() {
+						notify := !flaps.flapping && !inMaintenance && e.NotifyOnRecovery
+						channels := recoveryChannels(e.Alerts, notify)
+						sendAlerts(meow.AlertData{Endpoint: e, State: meow.StateUp, At: end}, channels, messages)
+					}
+					lastAlerted = time.Time{}
+				}
+				if len(attempts) > 1 {
+					// the check succeeded, but is recorded for the failed URL
+					first, last := attempts[0], attempts[len(attempts)-1]
+					messages <- fmt.Sprintf("%s failed over from %s to %s", e.Identifier, first.url, last.url)
+					failure := meow.Failure{
+						At:          end,
+						Status:      first.status,
+						LatencyMS:   duration.Milliseconds(),
+						Reason:      meow.ReasonStatus,
+						URL:         first.url,
+						FailoverURL: last.url,
+					}
+					if first.err != nil {
+						failure.Error = first.err.Error()
+						failure.Reason = failureReason(first.err)
+					}
+					if err := batch.RecordFailure(ctx, e.Identifier, e.HistorySize, failure); err != nil {
+						messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+					}
+				}
 				lastStateOK = true
-				errorCount = 0
-				alerted = false
+			} else if degraded {
+				// TODO: adjust log format
+				messages <- fmt.Sprintf("%c %s is degraded (status %d, took %v)",
+					meow.CatUnavailable, e.Identifier, status, duration)
+				lastStateOK = false
 			} else {
-				errorCount++
+				failure := meow.Failure{
+					At:            end,
+					Status:        status,
+					LatencyMS:     duration.Milliseconds(),
+					Reason:        reason,
+					Body:          string(body),
+					ServingStatus: servingStatus,
+				}
+				if err != nil {
+					failure.Error = err.Error()
+				}
+				if len(e.FailoverURLs) > 0 {
+					failure.URL = attempts[len(attempts)-1].url
+				}
+				var mismatch *locationMismatch
+				if errors.As(err, &mismatch) {
+					failure.Location = mismatch.location
+				}
+				var sizeMismatch *bodySizeMismatch
+				if errors.As(err, &sizeMismatch) {
+					failure.BodyBytes = sizeMismatch.size
+				}
+				if len(body) > 0 && checker.hasCredentials(e) {
+					failure.Body = ""
+					failure.Redacted = true
+				}
+				if err := batch.RecordFailure(ctx, e.Identifier, e.HistorySize, failure); err != nil {
+					messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+				}
 				// TODO: adjust log format
 				messages <- fmt.Sprintf("%c %s is not online (%d times)",
 					meow.CatUnavailable, e.Identifier, errorCount)
-				if errorCount >= int(e.FailAfter) && !alerted {
-					// TODO: adjust log format
-					messages <- fmt.Sprintf("%c ALERT: %s is offline (%d failed attempts)",
-						meow.CatAlert, e.Identifier, e.FailAfter)
-					alerted = true
+				cooledDown := lastAlerted.IsZero() || end.Sub(lastAlerted) >= e.AlertCooldown
+				if offline && cooledDown {
+					if flaps.flapping {
+						messages <- fmt.Sprintf("%s is offline, alert suppressed while flapping", e.Identifier)
+					} else if inMaintenance {
+						messages <- fmt.Sprintf("%s is offline, alert suppressed during maintenance", e.Identifier)
+					} else {
+						// TODO: adjust log format
+						messages <- fmt.Sprintf("%c ALERT: %s is offline (%d failed attempts)",
+							meow.CatAlert, e.Identifier, errorCount)
+						if err := batch.RecordAlert(ctx, e.Identifier, end); err != nil {
+							messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+						}
+						sendAlerts(meow.AlertData{
+							Endpoint:       e,
+							State:          meow.StateDown,
+							At:             end,
+							FailedAttempts: errorCount,
+							Status:         failure.Status,
+							Error:          failure.Error,
+						}, e.Alerts, messages)
+					}
+					lastAlerted = end
 				}
 				lastStateOK = false
 			}
+			if offline {
+				setState(meow.StateDown, end)
+			} else if stateOK {
+				setState(meow.StateUp, end)
+			} else if degraded {
+				setState(meow.StateDegraded, end)
+			} else if state == meow.StateBlocked || state == meow.StatePausedOffHours {
+				setState(meow.StateUnknown, end)
+			}
+			if flapping, changed := flaps.update(end); changed {
+				if flapping {
+					messages <- fmt.Sprintf("%c %s is flapping, suppressing alerts", meow.CatAlert, e.Identifier)
+				} else {
+					messages <- fmt.Sprintf("%s stopped flapping", e.Identifier)
+				}
+				if err := batch.RecordFlapping(ctx, e.Identifier, flapping); err != nil {
+					messages <- fmt.Sprintf("%c %v", meow.CrossMark, err)
+				}
+			}
 			firstTry = false
-			<-freq.C
 		}
 	}
 	messages := make(chan string)
-	for _, endpoint := range endpoints {
-		go probe(endpoint, messages)
-	}
+	go retryFailedAlerts(messages)
+	go func() {
+		checks := newScheduler(workers)
+		for _, endpoint := range endpoints {
+			if !endpoint.CheckedFrom(region) {
+				messages <- fmt.Sprintf("%s is not checked from region %q, skipping it", endpoint.Identifier, region)
+				continue
+			}
+			checks.add(endpoint.Frequency, endpoint.Offset, probe(endpoint, messages))
+		}
+		checks.run()
+	}()
 	for logMessage := range messages {
 		fmt.Fprintln(os.Stderr, logMessage)
 		logger.WriteLine(logMessage)
 	}
 }
 
-func requestForStatus(e meow.Endpoint) (int, error) {
-	req, err := http.NewRequest(e.Method, e.URL.String(), nil)
-	if err != nil {
-		return 0, fmt.Errorf("prepare request: %s %s %s: %v", e.Identifier, e.Method, e.URL, err)
-	}
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return 0, fmt.Errorf("perform request %s %s %s: %v", e.Identifier, e.Method, e.URL, err)
-	}
-	defer res.Body.Close()
-	return res.StatusCode, nil
-}
-
 func mustFetchEndpoints(configURL string) []meow.Endpoint {
 	endpoints := make([]meow.Endpoint, 0)
 	configEndpoint := fmt.Sprintf("%s/endpoints", configURL)
@@ -139,9 +579,23 @@ func mustFetchEndpoints(configURL string) []meow.Endpoint {
 	for _, payload := range payloads {
 		endpoint, err := meow.EndpointFromPayload(payload)
 		if err != nil {
-			log.Fatalf("convert payload %v to endpoint: %v", payload, err)
+			// e.g. checked more often than the timeout of this probe allows
+			fmt.Fprintf(os.Stderr, "skipping endpoint %s: %v\n", payload.Identifier, err)
+			continue
 		}
 		endpoints = append(endpoints, *endpoint)
 	}
 	return endpoints
 }
+
+// recoveryChannels returns the alert channels to send an alert about an endpoint
+// coming back online to: all of them if notify is set, and otherwise only the
+// PagerDuty channels, whose incidents are resolved regardless.
+func recoveryChannels(channels []meow.AlertChannel, notify bool) []meow.AlertChannel {
+	if notify {
+		return channels
+	}
+	return slices.DeleteFunc(slices.Clone(channels), func(channel meow.AlertChannel) bool {
+		return channel.Type != meow.AlertPagerDuty
+	})
+}
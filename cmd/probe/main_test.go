@@ -0,0 +1,35 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/patrickbucher/meow"
+)
+
+func TestRecoveryChannels(t *testing.T) {
+	webhook := meow.AlertChannel{Type: meow.AlertWebhook, Target: "https://hooks.example.com/meow"}
+	pagerDuty := meow.AlertChannel{Type: meow.AlertPagerDuty, Target: "routing-key"}
+	email := meow.AlertChannel{Type: meow.AlertEmail, Target: "ops@example.com"}
+	channels := []meow.AlertChannel{webhook, pagerDuty, email}
+
+	tests := []struct {
+		name   string
+		notify bool
+		want   []meow.AlertChannel
+	}{
+		{"notify", true, []meow.AlertChannel{webhook, pagerDuty, email}},
+		{"silent", false, []meow.AlertChannel{pagerDuty}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := recoveryChannels(channels, test.notify)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got channels %v, want %v", got, test.want)
+			}
+		})
+	}
+	if !slices.Equal(channels, []meow.AlertChannel{webhook, pagerDuty, email}) {
+		t.Errorf("channels of the endpoint were modified: %v", channels)
+	}
+}
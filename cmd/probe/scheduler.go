@@ -0,0 +1,155 @@
+package main
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// scheduledCheck is a check run periodically, which is due at the given time.
+type scheduledCheck struct {
+	due   time.Time
+	every time.Duration
+	run   func()
+}
+
+// checkQueue orders the scheduled checks by their due time, earliest first.
+type checkQueue []*scheduledCheck
+
+func (q checkQueue) Len() int           { return len(q) }
+func (q checkQueue) Less(i, j int) bool { return q[i].due.Before(q[j].due) }
+func (q checkQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *checkQueue) Push(x any)        { *q = append(*q, x.(*scheduledCheck)) }
+
+func (q *checkQueue) Pop() any {
+	old := *q
+	n := len(old)
+	check := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return check
+}
+
+// scheduler runs checks when they are due using a fixed number of workers. A
+// check due while all workers are busy waits for one to become available, and
+// is only scheduled again once it completed, so that an overloaded probe checks
+// less often rather than piling up checks.
+type scheduler struct {
+	workers int
+
+	mu    sync.Mutex
+	queue checkQueue
+	wake  chan struct{}
+	done  chan struct{}
+}
+
+// newScheduler creates a scheduler running at most workers checks at a time.
+func newScheduler(workers int) *scheduler {
+	return &scheduler{workers: max(workers, 1), wake: make(chan struct{}, 1), done: make(chan struct{})}
+}
+
+// add schedules run to be called every given duration. Without an offset, it
+// is called right away; otherwise, at the next time the given offset into an
+// interval of the duration, counted from the Unix epoch, so that checks with
+// the same duration but different offsets are staggered predictably.
+func (s *scheduler) add(every, offset time.Duration, run func()) {
+	s.push(&scheduledCheck{due: firstDue(time.Now(), every, offset), every: every, run: run})
+}
+
+// firstDue returns the first time from now on which lies offset into an
+// interval of every, counted from the Unix epoch, or now without an offset.
+// Unlike time.Truncate, which counts from the zero time, this keeps the phase
+// for durations not dividing a day, e.g. 7m.
+func firstDue(now time.Time, every, offset time.Duration) time.Time {
+	if offset <= 0 || every <= 0 {
+		return now
+	}
+	phase := time.Duration(now.UnixNano() % int64(every))
+	due := now.Add(offset - phase)
+	if due.Before(now) {
+		due = due.Add(every)
+	}
+	return due
+}
+
+func (s *scheduler) push(check *scheduledCheck) {
+	s.mu.Lock()
+	heap.Push(&s.queue, check)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// reschedule schedules the completed check for the next due time after now,
+// skipping the due times missed while waiting for or running the check. A check
+// without a positive duration is not scheduled again.
+func (s *scheduler) reschedule(check *scheduledCheck) {
+	if check.every <= 0 {
+		return
+	}
+	now := time.Now()
+	for !check.due.After(now) {
+		check.due = check.due.Add(check.every)
+	}
+	s.push(check)
+}
+
+// stop makes run return. Checks already handed over to the workers are still
+// completed.
+func (s *scheduler) stop() {
+	close(s.done)
+}
+
+// run hands the checks over to the workers as they become due, until the
+// scheduler is stopped.
+func (s *scheduler) run() {
+	jobs := make(chan *scheduledCheck)
+	defer close(jobs)
+	for range s.workers {
+		go func() {
+			for check := range jobs {
+				check.run()
+				s.reschedule(check)
+			}
+		}()
+	}
+	timer := time.NewTimer(0)
+	for {
+		s.mu.Lock()
+		var wait time.Duration
+		var next *scheduledCheck
+		if len(s.queue) == 0 {
+			wait = -1
+		} else if wait = time.Until(s.queue[0].due); wait <= 0 {
+			next = heap.Pop(&s.queue).(*scheduledCheck)
+		}
+		s.mu.Unlock()
+		switch {
+		case next != nil:
+			// blocks until a worker is available
+			select {
+			case jobs <- next:
+			case <-s.done:
+				return
+			}
+		case wait < 0:
+			select {
+			case <-s.wake:
+			case <-s.done:
+				return
+			}
+		default:
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-s.wake:
+				timer.Stop()
+			case <-s.done:
+				timer.Stop()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerRunsChecksWithoutDurationOnce(t *testing.T) {
+	s := newScheduler(1)
+	var runs atomic.Int32
+	ran := make(chan struct{}, 2)
+	s.add(0, 0, func() {
+		runs.Add(1)
+		ran <- struct{}{}
+	})
+	go s.run()
+	defer s.stop()
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("check was not run")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := runs.Load(); n != 1 {
+		t.Errorf("check without duration was run %d times, want once", n)
+	}
+}
+
+func TestSchedulerReschedulesSkippingMissedChecks(t *testing.T) {
+	s := newScheduler(1)
+	due := time.Now().Add(-time.Hour)
+	check := &scheduledCheck{due: due, every: time.Minute, run: func() {}}
+	s.reschedule(check)
+	if !check.due.After(time.Now()) || check.due.After(time.Now().Add(time.Minute)) {
+		t.Errorf("rescheduled check is due at %v, want within the next minute", check.due)
+	}
+	if len(s.queue) != 1 {
+		t.Errorf("got %d scheduled checks, want 1", len(s.queue))
+	}
+}
+
+func TestFirstDueLandsAtOffsetFromUnixEpoch(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 3, 20, 0, time.UTC)
+	tests := []struct {
+		every, offset time.Duration
+		want          time.Time
+	}{
+		{time.Minute, 0, now},
+		{time.Minute, 15 * time.Second, time.Date(2026, 10, 15, 12, 4, 15, 0, time.UTC)},
+		{time.Minute, 30 * time.Second, time.Date(2026, 10, 15, 12, 3, 30, 0, time.UTC)},
+		{time.Minute, 20 * time.Second, now},
+		{7 * time.Minute, 15 * time.Second, time.Unix(1_792_066_095, 0).UTC()},
+		{13 * time.Second, 9 * time.Second, time.Unix(1_792_065_804, 0).UTC()},
+	}
+	for _, test := range tests {
+		name := fmt.Sprintf("every %s at %s", test.every, test.offset)
+		t.Run(name, func(t *testing.T) {
+			due := firstDue(now, test.every, test.offset)
+			if !due.Equal(test.want) {
+				t.Errorf("got first due time %v, want %v", due, test.want)
+			}
+			if test.offset > 0 && time.Duration(due.UnixNano()%int64(test.every)) != test.offset {
+				t.Errorf("first due time %v is not %s into an interval of %s since the Unix epoch", due, test.offset, test.every)
+			}
+		})
+	}
+
+	s := newScheduler(1)
+	s.add(7*time.Minute, 15*time.Second, func() {})
+	if due := s.queue[0].due; time.Duration(due.UnixNano()%int64(7*time.Minute)) != 15*time.Second {
+		t.Errorf("added check is first due at %v, want 15s into an interval of 7m since the Unix epoch", due)
+	}
+}
+
+// benchmarkEndpoints are the numbers of endpoints the schedulers are compared
+// at.
+var benchmarkEndpoints = []int{10_000, 50_000}
+
+// BenchmarkScheduler measures how long it takes to schedule the checks of all
+// endpoints and run each of them once, using a fixed number of workers.
+func BenchmarkScheduler(b *testing.B) {
+	for _, n := range benchmarkEndpoints {
+		b.Run(fmt.Sprintf("endpoints=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				var wg sync.WaitGroup
+				wg.Add(n)
+				s := newScheduler(100)
+				for range n {
+					var once sync.Once
+					s.add(time.Hour, 0, func() { once.Do(wg.Done) })
+				}
+				go s.run()
+				wg.Wait()
+				s.stop()
+			}
+		})
+	}
+}
+
+// BenchmarkGoroutinePerEndpoint is the baseline for BenchmarkScheduler, which
+// checks every endpoint in a goroutine of its own driven by a ticker, like the
+// probe did before the scheduler was introduced.
+func BenchmarkGoroutinePerEndpoint(b *testing.B) {
+	for _, n := range benchmarkEndpoints {
+		b.Run(fmt.Sprintf("endpoints=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				var wg sync.WaitGroup
+				wg.Add(n)
+				done := make(chan struct{})
+				for range n {
+					go func() {
+						ticker := time.NewTicker(time.Hour)
+						defer ticker.Stop()
+						check := func() { wg.Done() }
+						check()
+						for {
+							select {
+							case <-ticker.C:
+								check()
+							case <-done:
+								return
+							}
+						}
+					}()
+				}
+				wg.Wait()
+				close(done)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patrickbucher/meow"
+)
+
+// serve offers the HTTP API of the probe on addr.
+func serve(addr string, checker *checker) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /probe", func(w http.ResponseWriter, r *http.Request) {
+		getProbe(checker, w, r)
+	})
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return server.ListenAndServe()
+}
+
+// getProbe checks the target given as query parameter on the fly, like the
+// blackbox exporter of Prometheus, and responds with the result as metrics in
+// the Prometheus text format. The target is online if it responds with the
+// status given (default: 200) to a request using the method given (default:
+// GET).
+func getProbe(checker *checker, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	payload := meow.EndpointPayload{
+		Identifier:   "probe",
+		URL:          query.Get("target"),
+		Method:       http.MethodGet,
+		StatusOnline: http.StatusOK,
+	}
+	if method := query.Get("method"); method != "" {
+		payload.Method = strings.ToUpper(method)
+	}
+	if status := query.Get("status"); status != "" {
+		parsed, err := strconv.ParseUint(status, 10, 16)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("status %q is not a number", status), http.StatusBadRequest)
+			return
+		}
+		payload.StatusOnline = uint16(parsed)
+	}
+	if payload.URL == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	endpoint, err := meow.EndpointFromPayload(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if endpoint.URLTemplate != "" || (endpoint.URL.Scheme != "http" && endpoint.URL.Scheme != "https") {
+		http.Error(w, fmt.Sprintf("target %q is not an HTTP URL", payload.URL), http.StatusBadRequest)
+		return
+	}
+
+	start := time.Now()
+	status, _, err := checker.requestForStatus(*endpoint)
+	duration := time.Since(start)
+	success := 0
+	if err == nil && status == int(endpoint.StatusOnline) {
+		success = 1
+	}
+
+	var metrics strings.Builder
+	gauge := func(name, help string, value any) {
+		fmt.Fprintf(&metrics, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+	gauge("probe_success", "Whether the probe was a success", success)
+	gauge("probe_duration_seconds", "How long the probe took to complete in seconds", duration.Seconds())
+	gauge("probe_http_status_code", "Response HTTP status code", status)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(metrics.String()))
+}
@@ -0,0 +1,159 @@
+package meow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// FailedAlertsKey is the key of the list holding the alerts that could not be
+// delivered to one of their channels, which is kept in the first shard.
+const FailedAlertsKey = "meow:alerts:failed"
+
+// MaxFailedAlerts is the number of failed alerts kept, the oldest of which are
+// dropped when more fail.
+const MaxFailedAlerts = 1000
+
+// AlertRetries is the number of times the delivery of a failed alert is
+// retried, and AlertRetryDelay how long to wait before the first retry, which
+// doubles with every retry.
+const (
+	AlertRetries    = 5
+	AlertRetryDelay = time.Minute
+)
+
+// FailedAlert is an alert that could not be delivered to the channel.
+type FailedAlert struct {
+	Channel AlertChannel `json:"channel"`
+	Alert   Alert        `json:"alert"`
+
+	// Error describes why the last attempt to deliver the alert failed, and
+	// FailedAt when it did.
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+
+	// Retries is the number of times the delivery was retried so far.
+	Retries int `json:"retries"`
+
+	// RetryAt is when the delivery is retried next, which is not set once it
+	// was retried AlertRetries times.
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+}
+
+// NewFailedAlert returns the alert that failed to be delivered to the channel
+// with err at the given time for the first time.
+func NewFailedAlert(channel AlertChannel, alert Alert, err error, at time.Time) FailedAlert {
+	failed := FailedAlert{Channel: channel, Alert: alert}
+	failed.fail(err, at)
+	return failed
+}
+
+// Retried returns the failed alert after its delivery was retried at the given
+// time, and failed again with err.
+func (f FailedAlert) Retried(err error, at time.Time) FailedAlert {
+	f.Retries++
+	f.fail(err, at)
+	return f
+}
+
+// fail records the failed delivery, and schedules the next retry, if any.
+func (f *FailedAlert) fail(err error, at time.Time) {
+	f.Error = err.Error()
+	f.FailedAt = at
+	f.RetryAt = nil
+	if f.Retries < AlertRetries {
+		retryAt := at.Add(AlertRetryDelay << f.Retries)
+		f.RetryAt = &retryAt
+	}
+}
+
+// Due reports whether the delivery of the failed alert is to be retried at the
+// given time.
+func (f FailedAlert) Due(at time.Time) bool {
+	return f.RetryAt != nil && !at.Before(*f.RetryAt)
+}
+
+// PushFailedAlert appends the failed alert to the list of failed alerts, and
+// drops the oldest ones exceeding MaxFailedAlerts.
+func PushFailedAlert(ctx context.Context, vk valkey.Client, failed FailedAlert) error {
+	data, err := json.Marshal(failed)
+	if err != nil {
+		return fmt.Errorf("marshal failed alert of %s: %v", failed.Alert.Identifier, err)
+	}
+	results := vk.DoMulti(ctx,
+		vk.B().Rpush().Key(FailedAlertsKey).Element(string(data)).Build(),
+		vk.B().Ltrim().Key(FailedAlertsKey).Start(-MaxFailedAlerts).Stop(-1).Build())
+	for _, result := range results {
+		if err := result.Error(); err != nil {
+			return fmt.Errorf("push failed alert of %s: %v", failed.Alert.Identifier, err)
+		}
+	}
+	return nil
+}
+
+// FailedAlerts returns the alerts whose delivery failed, oldest first.
+func FailedAlerts(ctx context.Context, vk valkey.Client) ([]FailedAlert, error) {
+	values, err := vk.Do(ctx, vk.B().Lrange().Key(FailedAlertsKey).Start(0).Stop(-1).Build()).AsStrSlice()
+	if err != nil {
+		return nil, fmt.Errorf("get failed alerts: %v", err)
+	}
+	failed := make([]FailedAlert, 0, len(values))
+	for _, value := range values {
+		var f FailedAlert
+		if err := json.Unmarshal([]byte(value), &f); err != nil {
+			return nil, fmt.Errorf("unmarshal failed alert %s: %v", value, err)
+		}
+		failed = append(failed, f)
+	}
+	return failed, nil
+}
+
+// RetryFailedAlerts retries the delivery of the failed alerts due at the given
+// time using send. Alerts delivered are removed from the list, and the others
+// are moved to its end with their next retry scheduled. Every alert in the
+// list is looked at once, so that alerts pushed concurrently, and retries by
+// other instances, are not disturbed. It returns the number of alerts
+// delivered.
+func RetryFailedAlerts(ctx context.Context, vk valkey.Client, at time.Time, send func(FailedAlert) error) (int, error) {
+	n, err := vk.Do(ctx, vk.B().Llen().Key(FailedAlertsKey).Build()).AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("count failed alerts: %v", err)
+	}
+	delivered := 0
+	for range n {
+		// rotate the list, so that an alert is not lost if its retry is
+		// interrupted
+		value, err := vk.Do(ctx, vk.B().Lmove().Source(FailedAlertsKey).Destination(FailedAlertsKey).Left().Right().Build()).ToString()
+		if valkey.IsValkeyNil(err) {
+			break
+		} else if err != nil {
+			return delivered, fmt.Errorf("rotate failed alerts: %v", err)
+		}
+		var failed FailedAlert
+		if err := json.Unmarshal([]byte(value), &failed); err != nil {
+			return delivered, fmt.Errorf("unmarshal failed alert %s: %v", value, err)
+		}
+		if !failed.Due(at) {
+			continue
+		}
+		cmds := valkey.Commands{vk.B().Lrem().Key(FailedAlertsKey).Count(-1).Element(value).Build()}
+		if err := send(failed); err != nil {
+			data, err := json.Marshal(failed.Retried(err, at))
+			if err != nil {
+				return delivered, fmt.Errorf("marshal failed alert of %s: %v", failed.Alert.Identifier, err)
+			}
+			cmds = append(cmds, vk.B().Rpush().Key(FailedAlertsKey).Element(string(data)).Build())
+		} else {
+			delivered++
+		}
+		for _, result := range vk.DoMulti(ctx, cmds...) {
+			if err := result.Error(); err != nil {
+				return delivered, fmt.Errorf("update failed alert of %s: %v", failed.Alert.Identifier, err)
+			}
+		}
+	}
+	return delivered, nil
+}
@@ -1,13 +1,20 @@
 package meow
 
 import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
 )
 
 // Endpoint is something to monitor with according rules.
@@ -18,35 +25,263 @@ type Endpoint struct {
 	// URL is the URL to be requested.
 	URL *url.URL
 
+	// URLTemplate is the URL as configured, if it refers to environment
+	// variables like ${REGION}, which are only expanded at check time. URL then
+	// holds the template with the variables substituted by their names.
+	URLTemplate string
+
+	// FailoverURLs are requested in order if URL does not respond as
+	// expected. The endpoint is online if any of the URLs does.
+	FailoverURLs []*url.URL
+
 	// Method is the HTTP method to be used for the request.
 	Method string
 
+	// UseHEADWhenPossible makes GET requests HEAD requests if the body of the
+	// response is not needed, i.e. neither checked nor captured. A response
+	// with status 405 is requested again using GET.
+	UseHEADWhenPossible bool
+
 	// StatusOnline is the status indicating that the endpoint is online.
 	StatusOnline uint16
 
+	// StatusClasses maps statuses to the outcome of a check responding with
+	// them: StateUp, StateDegraded, or StateDown. Other statuses are up if
+	// they equal StatusOnline, and down otherwise.
+	StatusClasses map[uint16]string
+
+	// RetryOnStatuses lists the statuses a check is retried on right away,
+	// e.g. 503 during deployments, up to the probe's limit of retries, rather
+	// than counting as failed.
+	RetryOnStatuses []uint16
+
+	// Retries is the number of times a check is retried on one of
+	// RetryOnStatuses, or 0 for the probe's limit of retries.
+	Retries uint8
+
 	// Frequency is how often the endpoint is being tried.
 	Frequency time.Duration
 
+	// Offset is the phase within each interval of Frequency, counted from
+	// the Unix epoch, at which the endpoint is checked, e.g. 15s to check an
+	// endpoint with a frequency of 1m at 15 seconds past every minute. If it
+	// is 0, the endpoint is checked right away and then every Frequency.
+	Offset time.Duration
+
+	// Timeout is the timeout of the requests checking the endpoint, which is
+	// at most ProbeTimeout, or 0 for the timeout of the probe.
+	Timeout time.Duration
+
 	// FailAfter is the number of failed requests after which the endpoint is
 	// considered to be offline.
 	FailAfter uint8
+
+	// FailWindow and FailRatio are the alternative to FailAfter: the endpoint
+	// is considered to be offline if more than FailRatio (between 0 and 1) of
+	// the last FailWindow checks failed. FailWindow is 0 if FailAfter applies.
+	FailWindow uint8
+	FailRatio  float64
+
+	// DependsOn lists the identifiers of the endpoints this endpoint depends
+	// on. The endpoint is not checked while any of them is down.
+	DependsOn []string
+
+	// Proxy is the URL of the HTTP proxy the endpoint is requested through, or
+	// nil if the endpoint is requested directly.
+	Proxy *url.URL
+
+	// MaxRedirects is the maximum number of redirects followed when
+	// requesting the endpoint, or 0 for DefaultMaxRedirects. Exceeding it
+	// fails the check.
+	MaxRedirects uint8
+
+	// ExpectRedirectTo is the URL the endpoint must redirect to with the
+	// status StatusOnline, in which case redirects are not followed, or nil.
+	ExpectRedirectTo *url.URL
+
+	// UserAgent is the User-Agent header the endpoint is requested with, or
+	// empty for the one the probe uses by default.
+	UserAgent string
+
+	// CaptureBodyBytes is the number of bytes of the response body recorded
+	// with a failed check. No body is captured if it is 0.
+	CaptureBodyBytes uint32
+
+	// ExpectSHA256 is the hex-encoded SHA-256 digest the response body must
+	// have for the endpoint to be online, or empty if the body is not checked.
+	ExpectSHA256 string
+
+	// ExpectJSONPath is the path into the JSON response body, e.g.
+	// $.data.healthy, at which the body must hold ExpectJSONValue for the
+	// endpoint to be online, or empty if the body is not checked this way.
+	ExpectJSONPath  string
+	ExpectJSONValue any
+
+	// MinBodyBytes and MaxBodyBytes bound the size of the response body for
+	// the endpoint to be online, e.g. to detect truncated responses. Neither
+	// bound applies if it is 0.
+	MinBodyBytes uint32
+	MaxBodyBytes uint32
+
+	// QueryParams are added to the URL when requesting the endpoint, whose
+	// values may refer to tokens like {{now_unix}} rendered at request time,
+	// e.g. to bust caches.
+	QueryParams map[string]string
+
+	// HistorySize is the number of failed checks kept in the endpoint's
+	// history, or 0 for HistoryLength.
+	HistorySize uint16
+
+	// HTTPVersion is HTTPVersion11 or HTTPVersion2 to request the endpoint
+	// only using that version of HTTP, or empty to negotiate it.
+	HTTPVersion string
+
+	// Labels are key/value pairs endpoints can be selected by, e.g. env=prod.
+	Labels map[string]string
+
+	// Regions restricts the endpoint to be checked only by probes in one of
+	// these regions, or by probes in any region if empty.
+	Regions []string
+
+	// WebhookSecret is the secret alerts sent to the endpoint's webhook
+	// channels are signed with, or empty if they are not signed. It is never
+	// returned by the config server.
+	WebhookSecret string
+
+	// AlertCooldown is how long to wait before alerting again about the
+	// endpoint still being offline.
+	AlertCooldown time.Duration
+
+	// Alerts lists the channels alerts about the endpoint are sent to.
+	Alerts []AlertChannel
+
+	// NotifyOnRecovery is whether an alert is sent when the endpoint comes
+	// back online, in addition to those about it going offline.
+	NotifyOnRecovery bool
+
+	// AlertTemplate is the text/template rendering the message of alerts
+	// about the endpoint with AlertData. DefaultAlertTemplate is used if empty.
+	AlertTemplate string
+
+	// MaintenanceWindows are the recurring windows during which the endpoint
+	// is still checked, but no alerts are sent about it.
+	MaintenanceWindows []Window
+
+	// CheckWindow is the recurring window the endpoint is only checked
+	// within, or nil if it is checked all the time.
+	CheckWindow *Window
+
+	// Protocol is ProtocolGRPC for endpoints checked using the gRPC health
+	// protocol, and empty for endpoints checked by an HTTP request.
+	Protocol string
 }
 
 // EndpointPayload contains the same fields as Endpoint, but only as
 // serializable primitives with JSON tags.
 type EndpointPayload struct {
-	Identifier   string `json:"identifier"`
-	URL          string `json:"url"`
-	Method       string `json:"method"`
-	StatusOnline uint16 `json:"status_online"`
-	Frequency    string `json:"frequency"`
-	FailAfter    uint8  `json:"fail_after"`
+	Identifier   string   `json:"identifier"`
+	URL          string   `json:"url"`
+	URLs         []string `json:"urls,omitempty"`
+	Method       string   `json:"method"`
+	StatusOnline uint16   `json:"status_online"`
+	Frequency    string   `json:"frequency"`
+	FailAfter    uint8    `json:"fail_after"`
+	FailWindow   uint8    `json:"fail_window,omitempty"`
+	FailRatio    float64  `json:"fail_ratio,omitempty"`
+	DependsOn    []string `json:"depends_on,omitempty"`
+	Proxy        string   `json:"proxy,omitempty"`
+	UserAgent    string   `json:"user_agent,omitempty"`
+	MaxRedirects uint8    `json:"max_redirects,omitempty"`
+
+	ExpectRedirectTo string `json:"expect_redirect_to,omitempty"`
+
+	CaptureBodyBytes uint32 `json:"capture_body_bytes,omitempty"`
+	ExpectSHA256     string `json:"expect_sha256,omitempty"`
+	AlertCooldown    string `json:"alert_cooldown,omitempty"`
+
+	Alerts        []AlertChannel `json:"alerts,omitempty"`
+	AlertTemplate string         `json:"alert_template,omitempty"`
+
+	MaintenanceWindows []Window `json:"maintenance_windows,omitempty"`
+	CheckWindow        *Window  `json:"check_window,omitempty"`
+
+	Protocol string `json:"protocol,omitempty"`
+
+	UseHEADWhenPossible bool `json:"use_head_when_possible,omitempty"`
+
+	StatusClasses map[uint16]string `json:"status_classes,omitempty"`
+
+	RetryOnStatuses []uint16 `json:"retry_on_statuses,omitempty"`
+
+	ExpectJSONPath  string          `json:"expect_json_path,omitempty"`
+	ExpectJSONValue json.RawMessage `json:"expect_json_value,omitempty"`
+
+	Offset string `json:"offset,omitempty"`
+
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+
+	// ModifiedAt is set by the config server and ignored when posted.
+	ModifiedAt string `json:"modified_at,omitempty"`
+
+	NotifyOnRecovery *bool `json:"notify_on_recovery,omitempty"`
+
+	MinBodyBytes uint32 `json:"min_body_bytes,omitempty"`
+	MaxBodyBytes uint32 `json:"max_body_bytes,omitempty"`
+
+	QueryParams map[string]string `json:"query_params,omitempty"`
+
+	HistorySize uint16 `json:"history_size,omitempty"`
+
+	HTTPVersion string `json:"http_version,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+
+	Regions []string `json:"regions,omitempty"`
+
+	Timeout string `json:"timeout,omitempty"`
+	Retries uint8  `json:"retries,omitempty"`
 }
 
 const idPatternRaw = "^[a-z][-a-z0-9]+$"
 
+// DefaultFrequency is the frequency of endpoints whose payload omits it.
+var DefaultFrequency = 60 * time.Second
+
+// ProbeTimeout is the timeout of the probe's requests checking endpoints, which
+// their frequency must not be shorter than, so that checks do not overlap.
+var ProbeTimeout = 10 * time.Second
+
+// DefaultAlertCooldown is the alert cooldown of endpoints whose payload omits
+// it.
+var DefaultAlertCooldown = 30 * time.Minute
+
+// DefaultTimeout and DefaultRetries are the timeout and the number of retries
+// of endpoints whose payload omits them, or 0 to leave them to the probe.
+var (
+	DefaultTimeout time.Duration
+	DefaultRetries uint8
+)
+
+// MaxRetries limits the number of times a check of an endpoint is retried.
+const MaxRetries = 10
+
+// DefaultMaxRedirects is the number of redirects followed when requesting
+// endpoints not configuring it, and MaxMaxRedirects the most they can configure.
+const (
+	DefaultMaxRedirects = 10
+	MaxMaxRedirects     = 50
+)
+
+// MaxCaptureBodyBytes limits the number of response body bytes recorded with a
+// failed check.
+const MaxCaptureBodyBytes = 64 << 10
+
 var idPattern = regexp.MustCompile(idPatternRaw)
 
+// reservedIdentifiers are not allowed for endpoints, since they are part of the
+// routes of the config server, e.g. GET /endpoints/ids.
+var reservedIdentifiers = []string{"ids"}
+
 // NewDefaultEndpoint creates a new Endpoint from rawURL, which is parsed. An
 // endpoint is returned, if the rawURL is valid, and an error (indicating the
 // parse error) otherwise.
@@ -65,22 +300,143 @@ func NewDefaultEndpoint(id string, rawURL string) (*Endpoint, error) {
 	}, nil
 }
 
+// RawURL returns the URL as configured, i.e. the template, if there is one.
+func (e Endpoint) RawURL() string {
+	if e.URLTemplate != "" {
+		return e.URLTemplate
+	}
+	return e.URL.String()
+}
+
+// Offline reports whether the endpoint is considered to be offline according
+// to its failure policy, given the number of consecutive failed checks, and the
+// outcomes of the recent checks, oldest first, which are true for failed ones.
+// A window policy only applies once there are enough recent checks.
+func (e Endpoint) Offline(consecutiveFailures int, recent []bool) bool {
+	if e.FailWindow == 0 {
+		return consecutiveFailures > 0 && consecutiveFailures >= int(e.FailAfter)
+	}
+	if len(recent) < int(e.FailWindow) {
+		return false
+	}
+	failed := 0
+	for _, f := range recent[len(recent)-int(e.FailWindow):] {
+		if f {
+			failed++
+		}
+	}
+	return float64(failed)/float64(e.FailWindow) > e.FailRatio
+}
+
+// URLs returns the URL as configured followed by the failover URLs.
+func (e Endpoint) URLs() []string {
+	urls := []string{e.RawURL()}
+	for _, u := range e.FailoverURLs {
+		urls = append(urls, u.String())
+	}
+	return urls
+}
+
+// Classify returns the outcome of a check the endpoint responded to with
+// status according to its StatusClasses: StateUp, StateDegraded, or StateDown.
+func (e Endpoint) Classify(status int) string {
+	if class, ok := e.StatusClasses[uint16(status)]; ok {
+		return class
+	}
+	if status == int(e.StatusOnline) {
+		return StateUp
+	}
+	return StateDown
+}
+
+// RequestMethod returns the method the endpoint is requested with, which is
+// HEAD instead of GET if UseHEADWhenPossible applies.
+func (e Endpoint) RequestMethod() string {
+	if e.UseHEADWhenPossible && e.Method == http.MethodGet && e.ExpectSHA256 == "" && e.ExpectJSONPath == "" &&
+		e.MinBodyBytes == 0 && e.MaxBodyBytes == 0 && e.CaptureBodyBytes == 0 {
+		return http.MethodHead
+	}
+	return e.Method
+}
+
 // String returns the Endpoint's fields separated by a space.
 func (e Endpoint) String() string {
 	return fmt.Sprintf("%s %s %s %d %v %d", e.Identifier,
-		e.URL, e.Method, e.StatusOnline, e.Frequency, e.FailAfter)
+		e.RawURL(), e.Method, e.StatusOnline, e.Frequency, e.FailAfter)
 }
 
 // JSON returns the Endpoint's fields as a JSON data, or an error, if it cannot
 // be serialized.
 func (e Endpoint) JSON() ([]byte, error) {
 	payload := EndpointPayload{
-		e.Identifier,
-		e.URL.String(),
-		e.Method,
-		e.StatusOnline,
-		e.Frequency.String(),
-		e.FailAfter,
+		Identifier:   e.Identifier,
+		URL:          e.RawURL(),
+		Method:       e.Method,
+		StatusOnline: e.StatusOnline,
+		Frequency:    e.Frequency.String(),
+		FailAfter:    e.FailAfter,
+		FailWindow:   e.FailWindow,
+		FailRatio:    e.FailRatio,
+		DependsOn:    e.DependsOn,
+		UserAgent:    e.UserAgent,
+		MaxRedirects: e.MaxRedirects,
+
+		CaptureBodyBytes: e.CaptureBodyBytes,
+		ExpectSHA256:     e.ExpectSHA256,
+		AlertCooldown:    e.AlertCooldown.String(),
+
+		Alerts:        e.Alerts,
+		AlertTemplate: e.AlertTemplate,
+
+		MaintenanceWindows: e.MaintenanceWindows,
+		CheckWindow:        e.CheckWindow,
+
+		Protocol: e.Protocol,
+
+		UseHEADWhenPossible: e.UseHEADWhenPossible,
+
+		StatusClasses: e.StatusClasses,
+
+		RetryOnStatuses: e.RetryOnStatuses,
+
+		WebhookSecret: e.WebhookSecret,
+
+		Retries: e.Retries,
+
+		MinBodyBytes: e.MinBodyBytes,
+		MaxBodyBytes: e.MaxBodyBytes,
+
+		QueryParams: e.QueryParams,
+
+		HistorySize: e.HistorySize,
+
+		HTTPVersion: e.HTTPVersion,
+
+		Labels: e.Labels,
+
+		Regions: e.Regions,
+	}
+	if !e.NotifyOnRecovery {
+		payload.NotifyOnRecovery = &e.NotifyOnRecovery
+	}
+	if len(e.FailoverURLs) > 0 {
+		payload.URLs = e.URLs()
+	}
+	if e.ExpectRedirectTo != nil {
+		payload.ExpectRedirectTo = e.ExpectRedirectTo.String()
+	}
+	if e.ExpectJSONPath != "" {
+		payload.ExpectJSONPath = e.ExpectJSONPath
+		payload.ExpectJSONValue, _ = json.Marshal(e.ExpectJSONValue)
+	}
+	if e.Proxy != nil {
+		payload.Proxy = e.Proxy.String()
+	}
+	if e.Offset > 0 {
+		payload.Offset = e.Offset.String()
+	}
+	if e.Timeout > 0 {
+		payload.Timeout = e.Timeout.String()
 	}
 	data, err := json.Marshal(payload)
 	if err != nil {
@@ -89,6 +445,30 @@ func (e Endpoint) JSON() ([]byte, error) {
 	return data, nil
 }
 
+// Protocols used to check endpoints.
+const (
+	// ProtocolHTTP checks an endpoint by requesting its URL, and is the
+	// default, which is stored as an empty protocol.
+	ProtocolHTTP = "http"
+
+	// ProtocolGRPC checks an endpoint by calling the standard gRPC health
+	// check grpc.health.v1.Health/Check at its URL, e.g. grpc://host:50051 or
+	// grpcs://host:443 using TLS. The path of the URL names the service to be
+	// checked, if any. The endpoint is online if it is SERVING.
+	ProtocolGRPC = "grpc"
+)
+
+// HTTP versions endpoints can be pinned to.
+const (
+	// HTTPVersion11 requests an endpoint using HTTP/1.1, even if it supports
+	// HTTP/2.
+	HTTPVersion11 = "1.1"
+
+	// HTTPVersion2 requests an endpoint using HTTP/2, which is negotiated
+	// using TLS for https URLs, and assumed without negotiation for http URLs.
+	HTTPVersion2 = "2"
+)
+
 var methodsAllowed = map[string]bool{
 	http.MethodGet:  true,
 	http.MethodHead: true,
@@ -106,31 +486,434 @@ func EndpointFromJSON(rawJSON string) (*Endpoint, error) {
 // EndpointFromPayload creates an endpoint from the given payload.
 func EndpointFromPayload(payload EndpointPayload) (*Endpoint, error) {
 	if !idPattern.MatchString(payload.Identifier) {
-		return nil, fmt.Errorf(`identifier "%s" does not match pattern "%s"`,
+		return nil, validationErrorf("identifier", `identifier "%s" does not match pattern "%s"`,
 			payload.Identifier, idPatternRaw)
 	}
-	parsedURL, err := url.Parse(payload.URL)
+	if slices.Contains(reservedIdentifiers, payload.Identifier) {
+		return nil, validationErrorf("identifier", `identifier "%s" is reserved`, payload.Identifier)
+	}
+	if len(payload.URLs) > 0 {
+		if payload.URL == "" {
+			payload.URL = payload.URLs[0]
+		} else if payload.URL != payload.URLs[0] {
+			return nil, validationErrorf("urls", `first URL "%s" differs from URL "%s"`, payload.URLs[0], payload.URL)
+		}
+	}
+	parsedURL, urlTemplate, err := parseURL(payload.URL)
 	if err != nil {
-		return nil, fmt.Errorf(`parse URL "%s": %v`, payload.URL, err)
+		return nil, validationErrorf("url", `parse URL "%s": %v`, payload.URL, err)
+	}
+	protocol := payload.Protocol
+	switch protocol {
+	case "", ProtocolHTTP:
+		protocol = ""
+		if allowed, ok := methodsAllowed[payload.Method]; !allowed || !ok {
+			return nil, validationErrorf("method", `"%s" is not an allowed method`, payload.Method)
+		}
+		if payload.StatusOnline < 100 || payload.StatusOnline > 999 {
+			return nil, validationErrorf("status_online", `"%d" is not a valid status code`, payload.StatusOnline)
+		}
+	case ProtocolGRPC:
+		if err := validateGRPCPayload(payload, parsedURL); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, validationErrorf("protocol", `"%s" is not a supported protocol (use http or grpc)`, payload.Protocol)
+	}
+	failoverURLs, err := parseFailoverURLs(payload)
+	if err != nil {
+		return nil, err
+	}
+	for status, class := range payload.StatusClasses {
+		if status < 100 || status > 999 {
+			return nil, validationErrorf("status_classes", `"%d" is not a valid status code`, status)
+		}
+		if class != StateUp && class != StateDegraded && class != StateDown {
+			return nil, validationErrorf("status_classes", `"%s" is not a status class (use up, degraded, or down)`, class)
+		}
 	}
-	if allowed, ok := methodsAllowed[payload.Method]; !allowed || !ok {
-		return nil, fmt.Errorf(`"%s" is not an allowed method`, payload.Method)
+	for i, status := range payload.RetryOnStatuses {
+		if status < 100 || status > 999 {
+			return nil, validationErrorf("retry_on_statuses", `"%d" is not a valid status code`, status)
+		}
+		if status == payload.StatusOnline {
+			return nil, validationErrorf("retry_on_statuses", `status_online %d cannot be retried on`, status)
+		}
+		if slices.Contains(payload.RetryOnStatuses[:i], status) {
+			return nil, validationErrorf("retry_on_statuses", `status %d is listed twice`, status)
+		}
 	}
-	if payload.StatusOnline < 100 || payload.StatusOnline > 999 {
-		return nil, fmt.Errorf(`"%d" is not a valid status code`, payload.StatusOnline)
+	frequency := DefaultFrequency
+	if payload.Frequency != "" {
+		frequency, err = time.ParseDuration(payload.Frequency)
+		if err != nil {
+			return nil, validationErrorf("frequency", `"%s" is not a valid duration`, payload.Frequency)
+		}
 	}
-	frequency, err := time.ParseDuration(payload.Frequency)
+	if frequency < ProbeTimeout {
+		return nil, validationErrorf("frequency", `frequency %s is shorter than the probe's timeout %s`, frequency, ProbeTimeout)
+	}
+	timeout := DefaultTimeout
+	if payload.Timeout != "" {
+		timeout, err = time.ParseDuration(payload.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, validationErrorf("timeout", `"%s" is not a valid duration`, payload.Timeout)
+		}
+	}
+	if timeout > ProbeTimeout {
+		return nil, validationErrorf("timeout", `timeout %s exceeds the probe's timeout %s`, timeout, ProbeTimeout)
+	}
+	var retries uint8
+	if protocol == "" {
+		// gRPC endpoints are not retried
+		retries = cmp.Or(payload.Retries, DefaultRetries)
+	}
+	if retries > MaxRetries {
+		return nil, validationErrorf("retries", "%d exceeds the maximum of %d retries", retries, MaxRetries)
+	}
+	var offset time.Duration
+	if payload.Offset != "" {
+		offset, err = time.ParseDuration(payload.Offset)
+		if err != nil || offset < 0 {
+			return nil, validationErrorf("offset", `"%s" is not a valid duration`, payload.Offset)
+		}
+		if offset >= frequency {
+			return nil, validationErrorf("offset", `offset %s is not shorter than frequency %s`, offset, frequency)
+		}
+	}
+	if err := validateFailurePolicy(payload); err != nil {
+		return nil, err
+	}
+	for _, dependency := range payload.DependsOn {
+		if !idPattern.MatchString(dependency) {
+			return nil, validationErrorf("depends_on", `dependency "%s" does not match pattern "%s"`,
+				dependency, idPatternRaw)
+		}
+		if dependency == payload.Identifier {
+			return nil, validationErrorf("depends_on", `endpoint "%s" cannot depend on itself`, dependency)
+		}
+	}
+	alertCooldown := DefaultAlertCooldown
+	if payload.AlertCooldown != "" {
+		alertCooldown, err = time.ParseDuration(payload.AlertCooldown)
+		if err != nil || alertCooldown < 0 {
+			return nil, validationErrorf("alert_cooldown", `"%s" is not a valid duration`, payload.AlertCooldown)
+		}
+	}
+	for _, channel := range payload.Alerts {
+		if err := validateAlertChannel(channel); err != nil {
+			return nil, validationErrorf("alerts", "%v", err)
+		}
+	}
+	if payload.WebhookSecret != "" && !slices.ContainsFunc(payload.Alerts, func(channel AlertChannel) bool {
+		return channel.Type == AlertWebhook
+	}) {
+		return nil, validationErrorf("webhook_secret", "webhook_secret requires a webhook alert channel")
+	}
+	maintenanceWindows, err := compileWindows(payload.MaintenanceWindows)
 	if err != nil {
-		return nil, fmt.Errorf(`"%s" is not a valid duration`, payload.Frequency)
+		return nil, validationErrorf("maintenance_windows", "%v", err)
 	}
-	return &Endpoint{
-		payload.Identifier,
-		parsedURL,
-		payload.Method,
-		payload.StatusOnline,
-		frequency,
-		payload.FailAfter,
-	}, nil
+	var checkWindow *Window
+	if payload.CheckWindow != nil {
+		w, err := payload.CheckWindow.compile()
+		if err != nil {
+			return nil, validationErrorf("check_window", "%v", err)
+		}
+		checkWindow = &w
+	}
+	if payload.CaptureBodyBytes > MaxCaptureBodyBytes {
+		return nil, validationErrorf("capture_body_bytes", `%d exceeds the maximum of %d bytes`,
+			payload.CaptureBodyBytes, MaxCaptureBodyBytes)
+	}
+	expectSHA256 := strings.ToLower(payload.ExpectSHA256)
+	if expectSHA256 != "" {
+		if digest, err := hex.DecodeString(expectSHA256); err != nil || len(digest) != sha256.Size {
+			return nil, validationErrorf("expect_sha256", `"%s" is not a hex-encoded SHA-256 digest`, payload.ExpectSHA256)
+		}
+		if payload.Method == http.MethodHead {
+			return nil, validationErrorf("expect_sha256", "responses to HEAD requests have no body to be checked")
+		}
+	}
+	var expectJSONValue any
+	if payload.ExpectJSONPath != "" || len(payload.ExpectJSONValue) > 0 {
+		if _, err := ParseJSONPath(payload.ExpectJSONPath); err != nil {
+			return nil, validationErrorf("expect_json_path", "%v", err)
+		}
+		if len(payload.ExpectJSONValue) == 0 {
+			return nil, validationErrorf("expect_json_value", "expect_json_path requires a value to be expected")
+		}
+		if err := json.Unmarshal(payload.ExpectJSONValue, &expectJSONValue); err != nil {
+			return nil, validationErrorf("expect_json_value", `"%s" is not a JSON value`, payload.ExpectJSONValue)
+		}
+		if payload.Method == http.MethodHead {
+			return nil, validationErrorf("expect_json_path", "responses to HEAD requests have no body to be checked")
+		}
+		if expectSHA256 != "" {
+			return nil, validationErrorf("expect_json_path", "expect_json_path cannot be combined with expect_sha256")
+		}
+	}
+	for name, value := range payload.QueryParams {
+		if err := validateQueryParam(name, value); err != nil {
+			return nil, validationErrorf("query_params", "%v", err)
+		}
+	}
+	if payload.MinBodyBytes > 0 || payload.MaxBodyBytes > 0 {
+		if payload.MaxBodyBytes > 0 && payload.MinBodyBytes > payload.MaxBodyBytes {
+			return nil, validationErrorf("min_body_bytes", "min_body_bytes %d exceeds max_body_bytes %d",
+				payload.MinBodyBytes, payload.MaxBodyBytes)
+		}
+		if payload.Method == http.MethodHead {
+			return nil, validationErrorf("min_body_bytes", "responses to HEAD requests have no body to be checked")
+		}
+	}
+	if payload.HTTPVersion != "" && payload.HTTPVersion != HTTPVersion11 && payload.HTTPVersion != HTTPVersion2 {
+		return nil, validationErrorf("http_version", `"%s" is not an HTTP version (use %s or %s)`,
+			payload.HTTPVersion, HTTPVersion11, HTTPVersion2)
+	}
+	for key, value := range payload.Labels {
+		if err := validateLabel(key, value); err != nil {
+			return nil, validationErrorf("labels", "%v", err)
+		}
+	}
+	for _, region := range payload.Regions {
+		if err := ValidateRegion(region); err != nil {
+			return nil, validationErrorf("regions", "%v", err)
+		}
+	}
+	if payload.HistorySize > MaxHistoryLength {
+		return nil, validationErrorf("history_size", "%d exceeds the maximum of %d failed checks",
+			payload.HistorySize, MaxHistoryLength)
+	}
+	if payload.MaxRedirects > MaxMaxRedirects {
+		return nil, validationErrorf("max_redirects", "%d exceeds the maximum of %d redirects",
+			payload.MaxRedirects, MaxMaxRedirects)
+	}
+	expectRedirectTo, err := parseExpectRedirectTo(payload)
+	if err != nil {
+		return nil, err
+	}
+	if payload.UseHEADWhenPossible && protocol == "" && payload.Method != http.MethodGet {
+		return nil, validationErrorf("use_head_when_possible", "only applies to GET requests")
+	}
+	if strings.ContainsFunc(payload.UserAgent, unicode.IsControl) {
+		return nil, validationErrorf("user_agent", "user agent %q contains control characters", payload.UserAgent)
+	}
+	var proxy *url.URL
+	if payload.Proxy != "" {
+		proxy, err = parseProxyURL(payload.Proxy)
+		if err != nil {
+			return nil, validationErrorf("proxy", `parse proxy URL "%s": %v`, payload.Proxy, err)
+		}
+	}
+	endpoint := &Endpoint{
+		Identifier:   payload.Identifier,
+		URL:          parsedURL,
+		URLTemplate:  urlTemplate,
+		FailoverURLs: failoverURLs,
+		Method:       payload.Method,
+		StatusOnline: payload.StatusOnline,
+		Frequency:    frequency,
+		Offset:       offset,
+		Timeout:      timeout,
+		FailAfter:    payload.FailAfter,
+		FailWindow:   payload.FailWindow,
+		FailRatio:    payload.FailRatio,
+		DependsOn:    slices.Clone(payload.DependsOn),
+		Proxy:        proxy,
+		UserAgent:    payload.UserAgent,
+		MaxRedirects: payload.MaxRedirects,
+
+		ExpectRedirectTo: expectRedirectTo,
+
+		CaptureBodyBytes: payload.CaptureBodyBytes,
+		ExpectSHA256:     expectSHA256,
+		AlertCooldown:    alertCooldown,
+
+		Alerts:        slices.Clone(payload.Alerts),
+		AlertTemplate: payload.AlertTemplate,
+
+		MaintenanceWindows: maintenanceWindows,
+		CheckWindow:        checkWindow,
+
+		Protocol: protocol,
+
+		UseHEADWhenPossible: payload.UseHEADWhenPossible,
+
+		StatusClasses: maps.Clone(payload.StatusClasses),
+
+		RetryOnStatuses: slices.Clone(payload.RetryOnStatuses),
+		Retries:         retries,
+
+		ExpectJSONPath:  payload.ExpectJSONPath,
+		ExpectJSONValue: expectJSONValue,
+
+		WebhookSecret: payload.WebhookSecret,
+
+		NotifyOnRecovery: payload.NotifyOnRecovery == nil || *payload.NotifyOnRecovery,
+
+		MinBodyBytes: payload.MinBodyBytes,
+		MaxBodyBytes: payload.MaxBodyBytes,
+
+		QueryParams: maps.Clone(payload.QueryParams),
+
+		HistorySize: payload.HistorySize,
+
+		HTTPVersion: payload.HTTPVersion,
+
+		Labels: maps.Clone(payload.Labels),
+
+		Regions: slices.Clone(payload.Regions),
+	}
+	if err := validateAlertTemplate(payload.AlertTemplate, *endpoint); err != nil {
+		return nil, validationErrorf("alert_template", "%v", err)
+	}
+	return endpoint, nil
+}
+
+// parseFailoverURLs parses the URLs of the payload following the first one,
+// which cannot refer to environment variables.
+func parseFailoverURLs(payload EndpointPayload) ([]*url.URL, error) {
+	if len(payload.URLs) < 2 {
+		return nil, nil
+	}
+	failoverURLs := make([]*url.URL, 0, len(payload.URLs)-1)
+	for _, rawURL := range payload.URLs[1:] {
+		if IsURLTemplate(rawURL) {
+			return nil, validationErrorf("urls", `failover URL "%s" cannot refer to environment variables`, rawURL)
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, validationErrorf("urls", `parse URL "%s": %v`, rawURL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, validationErrorf("urls", `failover URL "%s" must use scheme http or https`, rawURL)
+		}
+		failoverURLs = append(failoverURLs, u)
+	}
+	return failoverURLs, nil
+}
+
+// parseExpectRedirectTo parses the URL the payload expects to be redirected to,
+// if any, which requires StatusOnline to be a redirect. Since redirects are not
+// followed then, MaxRedirects cannot be set.
+func parseExpectRedirectTo(payload EndpointPayload) (*url.URL, error) {
+	if payload.ExpectRedirectTo == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(payload.ExpectRedirectTo)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, validationErrorf("expect_redirect_to", `"%s" is not an absolute HTTP URL`, payload.ExpectRedirectTo)
+	}
+	if payload.StatusOnline < 300 || payload.StatusOnline > 399 {
+		return nil, validationErrorf("status_online", "%d is not a redirect status as required by expect_redirect_to",
+			payload.StatusOnline)
+	}
+	if payload.MaxRedirects != 0 {
+		return nil, validationErrorf("max_redirects", "redirects are not followed if expect_redirect_to is set")
+	}
+	return u, nil
+}
+
+// validateFailurePolicy checks that the payload either configures FailAfter, or
+// both FailWindow and FailRatio.
+func validateFailurePolicy(payload EndpointPayload) error {
+	if payload.FailWindow == 0 && payload.FailRatio == 0 {
+		return nil
+	}
+	if payload.FailWindow == 0 {
+		return validationErrorf("fail_window", "fail_ratio requires fail_window to be set")
+	}
+	if payload.FailRatio <= 0 || payload.FailRatio >= 1 {
+		return validationErrorf("fail_ratio", "%v is not a ratio between 0 and 1 (exclusive)", payload.FailRatio)
+	}
+	if payload.FailAfter != 0 {
+		return validationErrorf("fail_after", "fail_after cannot be combined with fail_window and fail_ratio")
+	}
+	return nil
+}
+
+// validateGRPCPayload checks the URL of an endpoint checked using the gRPC
+// health protocol, and that no fields only applying to HTTP are set.
+func validateGRPCPayload(payload EndpointPayload, parsedURL *url.URL) error {
+	if parsedURL.Scheme != "grpc" && parsedURL.Scheme != "grpcs" {
+		return validationErrorf("url", `URL "%s" of gRPC endpoint must use scheme grpc or grpcs`, payload.URL)
+	}
+	if parsedURL.Port() == "" {
+		return validationErrorf("url", `URL "%s" of gRPC endpoint lacks a port`, payload.URL)
+	}
+	if payload.Method != "" {
+		return validationErrorf("method", "method cannot be set for gRPC endpoints")
+	}
+	if payload.StatusOnline != 0 {
+		return validationErrorf("status_online", "status_online cannot be set for gRPC endpoints")
+	}
+	if payload.Proxy != "" {
+		return validationErrorf("proxy", "proxy cannot be set for gRPC endpoints")
+	}
+	if payload.CaptureBodyBytes != 0 {
+		return validationErrorf("capture_body_bytes", "capture_body_bytes cannot be set for gRPC endpoints")
+	}
+	if payload.UserAgent != "" {
+		return validationErrorf("user_agent", "user_agent cannot be set for gRPC endpoints")
+	}
+	if payload.MaxRedirects != 0 {
+		return validationErrorf("max_redirects", "max_redirects cannot be set for gRPC endpoints")
+	}
+	if payload.ExpectRedirectTo != "" {
+		return validationErrorf("expect_redirect_to", "expect_redirect_to cannot be set for gRPC endpoints")
+	}
+	if payload.ExpectSHA256 != "" {
+		return validationErrorf("expect_sha256", "expect_sha256 cannot be set for gRPC endpoints")
+	}
+	if len(payload.URLs) > 1 {
+		return validationErrorf("urls", "failover URLs cannot be set for gRPC endpoints")
+	}
+	if payload.UseHEADWhenPossible {
+		return validationErrorf("use_head_when_possible", "use_head_when_possible cannot be set for gRPC endpoints")
+	}
+	if len(payload.StatusClasses) > 0 {
+		return validationErrorf("status_classes", "status_classes cannot be set for gRPC endpoints")
+	}
+	if len(payload.RetryOnStatuses) > 0 {
+		return validationErrorf("retry_on_statuses", "retry_on_statuses cannot be set for gRPC endpoints")
+	}
+	if payload.Retries != 0 {
+		return validationErrorf("retries", "retries cannot be set for gRPC endpoints")
+	}
+	if payload.ExpectJSONPath != "" {
+		return validationErrorf("expect_json_path", "expect_json_path cannot be set for gRPC endpoints")
+	}
+	if payload.MinBodyBytes > 0 || payload.MaxBodyBytes > 0 {
+		return validationErrorf("min_body_bytes", "body size bounds cannot be set for gRPC endpoints")
+	}
+	if len(payload.QueryParams) > 0 {
+		return validationErrorf("query_params", "query_params cannot be set for gRPC endpoints")
+	}
+	if payload.HTTPVersion != "" {
+		return validationErrorf("http_version", "http_version cannot be set for gRPC endpoints")
+	}
+	return nil
+}
+
+var proxySchemesAllowed = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"socks5": true,
+}
+
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if !proxySchemesAllowed[u.Scheme] {
+		return nil, fmt.Errorf(`scheme "%s" is not supported (use http, https, or socks5)`, u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host")
+	}
+	return u, nil
 }
 
 // EndpointFromRecord creates a new Endpoint from the given record, which must
@@ -143,31 +926,35 @@ func EndpointFromRecord(record []string) (*Endpoint, error) {
 	}
 	id := record[0]
 	if !idPattern.MatchString(id) {
-		return nil, fmt.Errorf(`id "%s" does not match pattern %s`, id, idPatternRaw)
+		return nil, validationErrorf("identifier", `id "%s" does not match pattern %s`, id, idPatternRaw)
+	}
+	if slices.Contains(reservedIdentifiers, id) {
+		return nil, validationErrorf("identifier", `id "%s" is reserved`, id)
 	}
-	parsedURL, err := url.Parse(record[1])
+	parsedURL, urlTemplate, err := parseURL(record[1])
 	if err != nil {
-		return nil, fmt.Errorf(`parse URL "%s": %v`, record[1], err)
+		return nil, validationErrorf("url", `parse URL "%s": %v`, record[1], err)
 	}
 	method := record[2]
 	if allowed, ok := methodsAllowed[method]; !allowed || !ok {
-		return nil, fmt.Errorf(`"%s" is not an allowed method`, method)
+		return nil, validationErrorf("method", `"%s" is not an allowed method`, method)
 	}
 	statusOnline, err := strconv.Atoi(record[3])
 	if err != nil || statusOnline < 100 || statusOnline > 999 {
-		return nil, fmt.Errorf(`"%s" is not a valid status code`, record[3])
+		return nil, validationErrorf("status_online", `"%s" is not a valid status code`, record[3])
 	}
 	frequency, err := time.ParseDuration(record[4])
 	if err != nil {
-		return nil, fmt.Errorf(`"%s" is not a valid duration`, record[4])
+		return nil, validationErrorf("frequency", `"%s" is not a valid duration`, record[4])
 	}
 	failAfter, err := strconv.Atoi(record[5])
 	if err != nil {
-		return nil, fmt.Errorf(`"%s" is not a number`, record[5])
+		return nil, validationErrorf("fail_after", `"%s" is not a number`, record[5])
 	}
 	return &Endpoint{
 		Identifier:   id,
 		URL:          parsedURL,
+		URLTemplate:  urlTemplate,
 		Method:       method,
 		StatusOnline: uint16(statusOnline),
 		Frequency:    frequency,
@@ -0,0 +1,450 @@
+package meow
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEndpointFromPayloadFrequencyNotShorterThanTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { ProbeTimeout = timeout }(ProbeTimeout)
+	ProbeTimeout = 10 * time.Second
+
+	tests := []struct {
+		frequency string
+		valid     bool
+	}{
+		{"9s", false},
+		{"9.999s", false},
+		{"10s", true},
+		{"10.001s", true},
+		{"1m", true},
+	}
+	for _, test := range tests {
+		t.Run(test.frequency, func(t *testing.T) {
+			payload := EndpointPayload{
+				Identifier:   "libvirt",
+				URL:          "https://libvirt.org/",
+				Method:       "GET",
+				StatusOnline: 200,
+				Frequency:    test.frequency,
+				FailAfter:    3,
+			}
+			_, err := EndpointFromPayload(payload)
+			if test.valid && err != nil {
+				t.Errorf("got error %v, want none", err)
+			}
+			var validationErr *ValidationError
+			if !test.valid && (!errors.As(err, &validationErr) || validationErr.Field != "frequency") {
+				t.Errorf("got error %v, want one about the frequency", err)
+			}
+		})
+	}
+}
+
+func TestEndpointFromPayloadRejectsReservedIdentifiers(t *testing.T) {
+	payload := EndpointPayload{
+		Identifier:   "ids",
+		URL:          "https://libvirt.org/",
+		Method:       "GET",
+		StatusOnline: 200,
+		Frequency:    "1m",
+		FailAfter:    3,
+	}
+	_, err := EndpointFromPayload(payload)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "identifier" {
+		t.Errorf("got error %v, want one about the identifier", err)
+	}
+	payload.Identifier = "ids-west"
+	if _, err := EndpointFromPayload(payload); err != nil {
+		t.Errorf("got error %v for identifier %s, want none", err, payload.Identifier)
+	}
+}
+
+func TestEndpointFromJSONDefaultsOmittedFrequency(t *testing.T) {
+	defer func(frequency time.Duration) { DefaultFrequency = frequency }(DefaultFrequency)
+	DefaultFrequency = 90 * time.Second
+
+	tests := map[string]string{
+		"omitted": `{"identifier":"libvirt","url":"https://libvirt.org/","method":"GET","status_online":200,"fail_after":3}`,
+		"empty":   `{"identifier":"libvirt","url":"https://libvirt.org/","method":"GET","status_online":200,"frequency":"","fail_after":3}`,
+	}
+	for name, rawJSON := range tests {
+		t.Run(name, func(t *testing.T) {
+			endpoint, err := EndpointFromJSON(rawJSON)
+			if err != nil {
+				t.Fatalf("got error %v, want none", err)
+			}
+			if endpoint.Frequency != DefaultFrequency {
+				t.Errorf("got frequency %s, want default of %s", endpoint.Frequency, DefaultFrequency)
+			}
+			rawPayload, err := endpoint.JSON()
+			if err != nil {
+				t.Fatalf("marshal endpoint: %v", err)
+			}
+			if !strings.Contains(string(rawPayload), `"frequency":"1m30s"`) {
+				t.Errorf("got payload %s, want it to hold the default frequency", rawPayload)
+			}
+		})
+	}
+}
+
+func TestEndpointFromPayloadMergesDefaults(t *testing.T) {
+	defer func(frequency, timeout time.Duration, retries uint8) {
+		DefaultFrequency, DefaultTimeout, DefaultRetries = frequency, timeout, retries
+	}(DefaultFrequency, DefaultTimeout, DefaultRetries)
+	DefaultFrequency, DefaultTimeout, DefaultRetries = 5*time.Minute, 5*time.Second, 3
+
+	tests := []struct {
+		name      string
+		frequency string
+		timeout   string
+		retries   uint8
+		want      Endpoint
+	}{
+		{"omitted", "", "", 0, Endpoint{Frequency: 5 * time.Minute, Timeout: 5 * time.Second, Retries: 3}},
+		{"overridden", "1m", "2s", 1, Endpoint{Frequency: time.Minute, Timeout: 2 * time.Second, Retries: 1}},
+		{"partly overridden", "", "8s", 0, Endpoint{Frequency: 5 * time.Minute, Timeout: 8 * time.Second, Retries: 3}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := EndpointPayload{
+				Identifier:   "libvirt",
+				URL:          "https://libvirt.org/",
+				Method:       "GET",
+				StatusOnline: 200,
+				Frequency:    test.frequency,
+				Timeout:      test.timeout,
+				Retries:      test.retries,
+			}
+			endpoint, err := EndpointFromPayload(payload)
+			if err != nil {
+				t.Fatalf("got error %v, want none", err)
+			}
+			if endpoint.Frequency != test.want.Frequency {
+				t.Errorf("got frequency %s, want %s", endpoint.Frequency, test.want.Frequency)
+			}
+			if endpoint.Timeout != test.want.Timeout {
+				t.Errorf("got timeout %s, want %s", endpoint.Timeout, test.want.Timeout)
+			}
+			if endpoint.Retries != test.want.Retries {
+				t.Errorf("got %d retries, want %d", endpoint.Retries, test.want.Retries)
+			}
+		})
+	}
+}
+
+func TestEndpointFromPayloadRejectsTimeoutsAndRetriesOutOfBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout string
+		retries uint8
+		field   string
+	}{
+		{"timeout exceeding the probe's", "11s", 0, "timeout"},
+		{"zero timeout", "0s", 0, "timeout"},
+		{"malformed timeout", "soon", 0, "timeout"},
+		{"too many retries", "", MaxRetries + 1, "retries"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := EndpointPayload{
+				Identifier:   "libvirt",
+				URL:          "https://libvirt.org/",
+				Method:       "GET",
+				StatusOnline: 200,
+				Frequency:    "1m",
+				Timeout:      test.timeout,
+				Retries:      test.retries,
+			}
+			_, err := EndpointFromPayload(payload)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Field != test.field {
+				t.Errorf("got error %v, want one about the %s", err, test.field)
+			}
+		})
+	}
+}
+
+func TestEndpointOffline(t *testing.T) {
+	failAfter := Endpoint{FailAfter: 3}
+	// offline if more than half of the last 4 checks failed
+	failRatio := Endpoint{FailWindow: 4, FailRatio: 0.5}
+	tests := []struct {
+		name                string
+		e                   Endpoint
+		consecutiveFailures int
+		recent              []bool
+		offline             bool
+	}{
+		{"too few consecutive failures", failAfter, 2, nil, false},
+		{"enough consecutive failures", failAfter, 3, nil, true},
+		{"no failures without fail_after", Endpoint{}, 0, nil, false},
+		{"too few checks", failRatio, 3, []bool{true, true, true}, false},
+		{"half failed", failRatio, 0, []bool{true, false, true, false}, false},
+		{"most failed", failRatio, 1, []bool{true, false, true, true}, true},
+		{"most failed in window", failRatio, 0, []bool{false, true, true, true, false}, true},
+		{"failures out of window", failRatio, 0, []bool{true, true, true, false, false, true, false}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if offline := test.e.Offline(test.consecutiveFailures, test.recent); offline != test.offline {
+				t.Errorf("got offline %t, want %t", offline, test.offline)
+			}
+		})
+	}
+}
+
+func TestEndpointFromPayloadValidatesFailurePolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		failAfter  uint8
+		failWindow uint8
+		failRatio  float64
+		field      string
+	}{
+		{"fail_after", 3, 0, 0, ""},
+		{"fail_window", 0, 10, 0.5, ""},
+		{"ratio without window", 0, 0, 0.5, "fail_window"},
+		{"window without ratio", 0, 10, 0, "fail_ratio"},
+		{"ratio of all", 0, 10, 1, "fail_ratio"},
+		{"both policies", 3, 10, 0.5, "fail_after"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := EndpointPayload{
+				Identifier:   "libvirt",
+				URL:          "https://libvirt.org/",
+				Method:       "GET",
+				StatusOnline: 200,
+				Frequency:    "1m",
+				FailAfter:    test.failAfter,
+				FailWindow:   test.failWindow,
+				FailRatio:    test.failRatio,
+			}
+			_, err := EndpointFromPayload(payload)
+			if test.field == "" && err != nil {
+				t.Errorf("got error %v, want none", err)
+			}
+			var validationErr *ValidationError
+			if test.field != "" && (!errors.As(err, &validationErr) || validationErr.Field != test.field) {
+				t.Errorf("got error %v, want one about %s", err, test.field)
+			}
+		})
+	}
+}
+
+func TestEndpointFromPayloadValidatesExpectRedirectTo(t *testing.T) {
+	tests := []struct {
+		name             string
+		expectRedirectTo string
+		statusOnline     uint16
+		maxRedirects     uint8
+		field            string
+	}{
+		{"redirect", "https://libvirt.org/docs/", 301, 0, ""},
+		{"relative location", "/docs/", 301, 0, "expect_redirect_to"},
+		{"no redirect status", "https://libvirt.org/docs/", 200, 0, "status_online"},
+		{"redirects followed", "https://libvirt.org/docs/", 302, 3, "max_redirects"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := EndpointPayload{
+				Identifier:       "libvirt",
+				URL:              "https://libvirt.org/",
+				Method:           "GET",
+				StatusOnline:     test.statusOnline,
+				Frequency:        "1m",
+				FailAfter:        3,
+				MaxRedirects:     test.maxRedirects,
+				ExpectRedirectTo: test.expectRedirectTo,
+			}
+			endpoint, err := EndpointFromPayload(payload)
+			if test.field == "" {
+				if err != nil {
+					t.Fatalf("got error %v, want none", err)
+				}
+				if endpoint.ExpectRedirectTo.String() != test.expectRedirectTo {
+					t.Errorf("got expected location %s, want %s", endpoint.ExpectRedirectTo, test.expectRedirectTo)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Field != test.field {
+				t.Errorf("got error %v, want one about %s", err, test.field)
+			}
+		})
+	}
+}
+
+func TestEndpointClassify(t *testing.T) {
+	e := Endpoint{
+		StatusOnline:  200,
+		StatusClasses: map[uint16]string{204: StateUp, 429: StateDegraded, 503: StateDown},
+	}
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{200, StateUp},
+		{204, StateUp},
+		{429, StateDegraded},
+		{503, StateDown},
+		{500, StateDown},
+	}
+	for _, test := range tests {
+		if got := e.Classify(test.status); got != test.want {
+			t.Errorf("classify status %d: got %s, want %s", test.status, got, test.want)
+		}
+	}
+
+	// without status classes, only StatusOnline is up
+	e.StatusClasses = nil
+	for status, want := range map[int]string{200: StateUp, 204: StateDown, 429: StateDown} {
+		if got := e.Classify(status); got != want {
+			t.Errorf("classify status %d without classes: got %s, want %s", status, got, want)
+		}
+	}
+}
+
+func TestEndpointFromPayloadValidatesStatusClasses(t *testing.T) {
+	tests := []struct {
+		name    string
+		classes map[uint16]string
+		valid   bool
+	}{
+		{"valid", map[uint16]string{429: StateDegraded, 503: StateDown}, true},
+		{"invalid status", map[uint16]string{42: StateDegraded}, false},
+		{"invalid class", map[uint16]string{429: "slow"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := EndpointPayload{
+				Identifier:    "libvirt",
+				URL:           "https://libvirt.org/",
+				Method:        "GET",
+				StatusOnline:  200,
+				Frequency:     "1m",
+				FailAfter:     3,
+				StatusClasses: test.classes,
+			}
+			_, err := EndpointFromPayload(payload)
+			if test.valid && err != nil {
+				t.Errorf("got error %v, want none", err)
+			}
+			var validationErr *ValidationError
+			if !test.valid && (!errors.As(err, &validationErr) || validationErr.Field != "status_classes") {
+				t.Errorf("got error %v, want one about the status classes", err)
+			}
+		})
+	}
+}
+
+func TestEndpointFromPayloadValidatesRetryOnStatuses(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []uint16
+		valid    bool
+	}{
+		{"valid", []uint16{502, 503}, true},
+		{"invalid status", []uint16{1000}, false},
+		{"status online", []uint16{200}, false},
+		{"duplicate", []uint16{503, 503}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := EndpointPayload{
+				Identifier:      "libvirt",
+				URL:             "https://libvirt.org/",
+				Method:          "GET",
+				StatusOnline:    200,
+				Frequency:       "1m",
+				FailAfter:       3,
+				RetryOnStatuses: test.statuses,
+			}
+			_, err := EndpointFromPayload(payload)
+			if test.valid && err != nil {
+				t.Errorf("got error %v, want none", err)
+			}
+			var validationErr *ValidationError
+			if !test.valid && (!errors.As(err, &validationErr) || validationErr.Field != "retry_on_statuses") {
+				t.Errorf("got error %v, want one about the statuses retried on", err)
+			}
+		})
+	}
+}
+
+func TestEndpointFromPayloadLimitsHistorySize(t *testing.T) {
+	payload := EndpointPayload{
+		Identifier:   "libvirt",
+		URL:          "https://libvirt.org/",
+		Method:       "GET",
+		StatusOnline: 200,
+		Frequency:    "1m",
+		FailAfter:    3,
+		HistorySize:  MaxHistoryLength,
+	}
+	if _, err := EndpointFromPayload(payload); err != nil {
+		t.Errorf("got error %v for the maximum history size, want none", err)
+	}
+	payload.HistorySize++
+	_, err := EndpointFromPayload(payload)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "history_size" {
+		t.Errorf("got error %v, want one about the history size", err)
+	}
+}
+
+func TestEndpointFromPayloadValidatesHTTPVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		httpVersion string
+		valid       bool
+	}{
+		{"negotiated", "", true},
+		{"HTTP/1.1", HTTPVersion11, true},
+		{"HTTP/2", HTTPVersion2, true},
+		{"HTTP/3", "3", false},
+		{"prefixed", "HTTP/1.1", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := EndpointPayload{
+				Identifier:   "libvirt",
+				URL:          "https://libvirt.org/",
+				Method:       "GET",
+				StatusOnline: 200,
+				Frequency:    "1m",
+				FailAfter:    3,
+				HTTPVersion:  test.httpVersion,
+			}
+			endpoint, err := EndpointFromPayload(payload)
+			if test.valid && err != nil {
+				t.Fatalf("got error %v, want none", err)
+			}
+			if test.valid && endpoint.HTTPVersion != test.httpVersion {
+				t.Errorf("got endpoint pinned to %q, want %q", endpoint.HTTPVersion, test.httpVersion)
+			}
+			var validationErr *ValidationError
+			if !test.valid && (!errors.As(err, &validationErr) || validationErr.Field != "http_version") {
+				t.Errorf("got error %v, want one about the HTTP version", err)
+			}
+		})
+	}
+
+	grpc := EndpointPayload{
+		Identifier:  "libvirt",
+		URL:         "grpc://libvirt.org:50051",
+		Protocol:    ProtocolGRPC,
+		Frequency:   "1m",
+		FailAfter:   3,
+		HTTPVersion: HTTPVersion2,
+	}
+	_, err := EndpointFromPayload(grpc)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "http_version" {
+		t.Errorf("got error %v for gRPC endpoint pinned to HTTP/2, want one about the HTTP version", err)
+	}
+}
@@ -0,0 +1,22 @@
+package meow
+
+import "fmt"
+
+// ValidationError indicates that a field of an endpoint has an invalid value,
+// as opposed to errors caused by malformed input, e.g. invalid JSON.
+type ValidationError struct {
+	// Field is the name of the invalid field as used in the JSON payload.
+	Field string
+
+	// Message describes why the field's value is invalid.
+	Message string
+}
+
+// Error returns the human-readable message of the validation error.
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func validationErrorf(field, format string, args ...any) *ValidationError {
+	return &ValidationError{field, fmt.Sprintf(format, args...)}
+}
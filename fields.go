@@ -0,0 +1,116 @@
+package meow
+
+// Fields of the hashes endpoints are stored as, which are written by the config
+// server and read by it to serve the endpoints to the probe. The probe also
+// reads FieldWebhookSecret, which is never served, right from the hash.
+const (
+	FieldIdentifier          = "identifier"
+	FieldURL                 = "url"
+	FieldFailoverURLs        = "failover_urls"
+	FieldMethod              = "method"
+	FieldStatusOnline        = "status_online"
+	FieldFrequency           = "frequency"
+	FieldFailAfter           = "fail_after"
+	FieldFailWindow          = "fail_window"
+	FieldFailRatio           = "fail_ratio"
+	FieldDependsOn           = "depends_on"
+	FieldProxy               = "proxy"
+	FieldCaptureBodyBytes    = "capture_body_bytes"
+	FieldExpectSHA256        = "expect_sha256"
+	FieldAlertCooldown       = "alert_cooldown"
+	FieldAlerts              = "alerts"
+	FieldAlertTemplate       = "alert_template"
+	FieldMaintenanceWindows  = "maintenance_windows"
+	FieldCheckWindow         = "check_window"
+	FieldProtocol            = "protocol"
+	FieldUserAgent           = "user_agent"
+	FieldMaxRedirects        = "max_redirects"
+	FieldExpectRedirectTo    = "expect_redirect_to"
+	FieldUseHEADWhenPossible = "use_head_when_possible"
+	FieldStatusClasses       = "status_classes"
+	FieldRetryOnStatuses     = "retry_on_statuses"
+	FieldExpectJSONPath      = "expect_json_path"
+	FieldExpectJSONValue     = "expect_json_value"
+	FieldOffset              = "offset"
+	FieldWebhookSecret       = "webhook_secret"
+	FieldNotifyOnRecovery    = "notify_on_recovery"
+	FieldMinBodyBytes        = "min_body_bytes"
+	FieldMaxBodyBytes        = "max_body_bytes"
+	FieldQueryParams         = "query_params"
+	FieldHistorySize         = "history_size"
+	FieldHTTPVersion         = "http_version"
+	FieldLabels              = "labels"
+	FieldRegions             = "regions"
+	FieldTimeout             = "timeout"
+	FieldRetries             = "retries"
+
+	// FieldModifiedAt holds when the endpoint was last modified. It is
+	// maintained when the endpoint is stored rather than being one of its
+	// fields, so it is neither compared nor removed as stale.
+	FieldModifiedAt = "modified_at"
+)
+
+// EndpointFields lists all fields of endpoint hashes, of which those holding a
+// zero value are not stored.
+var EndpointFields = []string{
+	FieldIdentifier,
+	FieldURL,
+	FieldFailoverURLs,
+	FieldMethod,
+	FieldStatusOnline,
+	FieldFrequency,
+	FieldFailAfter,
+	FieldFailWindow,
+	FieldFailRatio,
+	FieldDependsOn,
+	FieldProxy,
+	FieldCaptureBodyBytes,
+	FieldExpectSHA256,
+	FieldAlertCooldown,
+	FieldAlerts,
+	FieldAlertTemplate,
+	FieldMaintenanceWindows,
+	FieldCheckWindow,
+	FieldProtocol,
+	FieldUserAgent,
+	FieldMaxRedirects,
+	FieldExpectRedirectTo,
+	FieldUseHEADWhenPossible,
+	FieldStatusClasses,
+	FieldRetryOnStatuses,
+	FieldExpectJSONPath,
+	FieldExpectJSONValue,
+	FieldOffset,
+	FieldWebhookSecret,
+	FieldNotifyOnRecovery,
+	FieldMinBodyBytes,
+	FieldMaxBodyBytes,
+	FieldQueryParams,
+	FieldHistorySize,
+	FieldHTTPVersion,
+	FieldLabels,
+	FieldRegions,
+	FieldTimeout,
+	FieldRetries,
+	FieldModifiedAt,
+}
+
+// Fields of the hashes the states of endpoints are stored as, which are written
+// by the probe and read by both the probe and the config server.
+const (
+	StateFieldState               = "state"
+	StateFieldSince               = "since"
+	StateFieldConsecutiveFailures = "consecutive_failures"
+	StateFieldFailureReason       = "failure_reason"
+	StateFieldFlapping            = "flapping"
+	StateFieldServingStatus       = "serving_status"
+	StateFieldLastAlerted         = "last_alerted"
+
+	// StateFieldResetAt holds when the state of an endpoint was last reset,
+	// in microseconds since the Unix epoch.
+	StateFieldResetAt = "reset_at"
+
+	// StateFieldCheckedAt holds when an endpoint was last checked from a
+	// region, which is only set in the hashes of RegionStateKey.
+	StateFieldCheckedAt = "checked_at"
+)
@@ -0,0 +1,87 @@
+package meow
+
+import "slices"
+
+// Policies deriving the state of a group from the states of its members.
+const (
+	// PolicyAllUp considers a group up if all of its members are up.
+	PolicyAllUp = "all-up"
+
+	// PolicyAnyUp considers a group up if any of its members is up.
+	PolicyAnyUp = "any-up"
+
+	// PolicyQuorum considers a group up if at least Quorum of its members are
+	// up.
+	PolicyQuorum = "quorum"
+)
+
+// Group is a composite service made up of endpoints, whose state is derived
+// from the states of its members according to its policy.
+type Group struct {
+	Identifier string   `json:"identifier"`
+	Members    []string `json:"members"`
+	Policy     string   `json:"policy"`
+
+	// Quorum is the number of members that must be up, which is only set for
+	// PolicyQuorum.
+	Quorum int `json:"quorum,omitempty"`
+}
+
+// Validate returns a *ValidationError if a field of the group is invalid.
+func (g Group) Validate() error {
+	if !idPattern.MatchString(g.Identifier) {
+		return validationErrorf("identifier", `identifier "%s" does not match pattern "%s"`,
+			g.Identifier, idPatternRaw)
+	}
+	if len(g.Members) == 0 {
+		return validationErrorf("members", "a group needs members")
+	}
+	for i, member := range g.Members {
+		if !idPattern.MatchString(member) {
+			return validationErrorf("members", `member "%s" does not match pattern "%s"`, member, idPatternRaw)
+		}
+		if slices.Contains(g.Members[:i], member) {
+			return validationErrorf("members", `member "%s" is listed twice`, member)
+		}
+	}
+	switch g.Policy {
+	case PolicyAllUp, PolicyAnyUp:
+		if g.Quorum != 0 {
+			return validationErrorf("quorum", "quorum only applies to the %s policy", PolicyQuorum)
+		}
+	case PolicyQuorum:
+		if g.Quorum < 1 || g.Quorum > len(g.Members) {
+			return validationErrorf("quorum", "quorum %d is not between 1 and the %d members",
+				g.Quorum, len(g.Members))
+		}
+	default:
+		return validationErrorf("policy", `"%s" is not a policy (use %s, %s, or %s)`,
+			g.Policy, PolicyAllUp, PolicyAnyUp, PolicyQuorum)
+	}
+	return nil
+}
+
+// State returns StateUp if enough members of the group are up according to its
+// policy given the states of the members, and StateDown otherwise. Members in
+// any other state than StateUp, e.g. degraded or unknown, are not up.
+func (g Group) State(states map[string]string) string {
+	up := 0
+	for _, member := range g.Members {
+		if states[member] == StateUp {
+			up++
+		}
+	}
+	var isUp bool
+	switch g.Policy {
+	case PolicyAllUp:
+		isUp = up == len(g.Members)
+	case PolicyAnyUp:
+		isUp = up > 0
+	case PolicyQuorum:
+		isUp = up >= g.Quorum
+	}
+	if isUp {
+		return StateUp
+	}
+	return StateDown
+}
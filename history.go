@@ -0,0 +1,290 @@
+package meow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// HistoryLength is the number of failed checks kept per endpoint not
+// configuring it, and MaxHistoryLength the most they can configure.
+const (
+	HistoryLength    = 100
+	MaxHistoryLength = 10000
+)
+
+// Failure records a failed check of an endpoint.
+type Failure struct {
+	At time.Time `json:"at"`
+
+	// Status is the status the endpoint responded with, or 0 if the request
+	// failed.
+	Status int `json:"status"`
+
+	// LatencyMS is how long the check took in milliseconds.
+	LatencyMS int64 `json:"latency_ms,omitempty"`
+
+	// Error describes why the request failed, if it did.
+	Error string `json:"error,omitempty"`
+
+	// Reason is the reason the check failed for, e.g. ReasonTimeout.
+	Reason FailureReason `json:"reason,omitempty"`
+
+	// URL is the URL requested, which is only recorded for endpoints with
+	// failover URLs. FailoverURL is the one that responded as expected
+	// instead, if any, in which case the check did not fail as a whole.
+	URL         string `json:"url,omitempty"`
+	FailoverURL string `json:"failover_url,omitempty"`
+
+	// ServingStatus is the status an endpoint checked using the gRPC health
+	// protocol responded with, e.g. NOT_SERVING.
+	ServingStatus string `json:"serving_status,omitempty"`
+
+	// Location is the location the endpoint redirected to, if it differs
+	// from the one expected.
+	Location string `json:"location,omitempty"`
+
+	// BodyBytes is the size of the response body, if it is out of the bounds
+	// expected, counted up to the probe's limit.
+	BodyBytes int64 `json:"body_bytes,omitempty"`
+
+	// Body holds the beginning of the response body, if captured.
+	Body string `json:"body,omitempty"`
+
+	// Redacted indicates that the body was not captured, because the endpoint
+	// is requested with credentials.
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// FailureReason is the reason a check failed for.
+type FailureReason string
+
+// Reasons a check failed for.
+const (
+	// ReasonTimeout fails a check not completed within its timeout.
+	ReasonTimeout FailureReason = "timeout"
+
+	// ReasonDNS fails a check of an endpoint whose host could not be resolved.
+	ReasonDNS FailureReason = "dns"
+
+	// ReasonConnectionRefused fails a check of an endpoint refusing the
+	// connection.
+	ReasonConnectionRefused FailureReason = "connection_refused"
+
+	// ReasonCertificateExpired fails a check of an endpoint presenting an
+	// expired TLS certificate, and ReasonTLS one failing the TLS handshake
+	// otherwise, e.g. due to an unknown authority.
+	ReasonCertificateExpired FailureReason = "certificate_expired"
+	ReasonTLS                FailureReason = "tls"
+
+	// ReasonStatus fails a check of an endpoint responding with a status not
+	// classified as up, and ReasonNotServing one of an endpoint checked using
+	// the gRPC health protocol responding other than SERVING.
+	ReasonStatus     FailureReason = "status"
+	ReasonNotServing FailureReason = "not_serving"
+
+	// ReasonBodyMismatch fails a check of an endpoint whose response body
+	// lacks the digest, JSON value, or size expected.
+	ReasonBodyMismatch FailureReason = "body_mismatch"
+
+	// ReasonBodyTooLarge fails a check of an endpoint whose response body is
+	// too large for its digest or JSON value to be verified.
+	ReasonBodyTooLarge FailureReason = "body_too_large"
+
+	// ReasonRedirectMismatch fails a check of an endpoint redirecting
+	// elsewhere than expected.
+	ReasonRedirectMismatch FailureReason = "redirect_mismatch"
+
+	// ReasonTooManyRedirects fails a check of an endpoint redirecting more
+	// often than its MaxRedirects allows.
+	ReasonTooManyRedirects FailureReason = "too_many_redirects"
+
+	// ReasonRequest fails a check whose request failed for any other reason.
+	ReasonRequest FailureReason = "request"
+)
+
+// RecordFailure prepends the failure to the history of the endpoint with
+// identifier, which is trimmed to length failures, or HistoryLength if 0.
+func RecordFailure(ctx context.Context, vk valkey.Client, identifier string, length uint16, failure Failure) error {
+	cmds, err := failureCommands(vk, identifier, length, failure)
+	if err != nil {
+		return err
+	}
+	for _, result := range vk.DoMulti(ctx, cmds...) {
+		if err := result.Error(); err != nil {
+			return fmt.Errorf("record failure of %s: %v", identifier, err)
+		}
+	}
+	return nil
+}
+
+func failureCommands(vk valkey.Client, identifier string, length uint16, failure Failure) (valkey.Commands, error) {
+	data, err := json.Marshal(failure)
+	if err != nil {
+		return nil, fmt.Errorf("marshal failure %v: %v", failure, err)
+	}
+	if length == 0 {
+		length = HistoryLength
+	}
+	key := HistoryKey(identifier)
+	return valkey.Commands{
+		vk.B().Lpush().Key(key).Element(string(data)).Build(),
+		vk.B().Ltrim().Key(key).Start(0).Stop(int64(length) - 1).Build(),
+	}, nil
+}
+
+// HourlyFailures aggregates the failed checks of an endpoint within an hour,
+// which were compacted by CompactHistory. The latencies are the ones of the
+// failed checks, and Uptime is the percentage of the checks expected within
+// the hour, given the endpoint's frequency, that did not fail.
+type HourlyFailures struct {
+	Hour         time.Time `json:"hour"`
+	Failures     int       `json:"failures"`
+	Failovers    int       `json:"failovers,omitempty"`
+	Uptime       float64   `json:"uptime_percent"`
+	AvgLatencyMS float64   `json:"avg_latency_ms"`
+	MaxLatencyMS int64     `json:"max_latency_ms"`
+}
+
+// add includes the failure in the aggregate, of which there are expected
+// checks per hour.
+func (h *HourlyFailures) add(failure Failure, expected float64) {
+	checks := h.Failures + h.Failovers
+	h.AvgLatencyMS = (h.AvgLatencyMS*float64(checks) + float64(failure.LatencyMS)) / float64(checks+1)
+	h.MaxLatencyMS = max(h.MaxLatencyMS, failure.LatencyMS)
+	if failure.FailoverURL != "" {
+		h.Failovers++
+	} else {
+		h.Failures++
+	}
+	h.Uptime = max(0, 100*(1-float64(h.Failures)/expected))
+}
+
+// compactOldest removes the last, i.e. oldest, element of the list KEYS[1], if
+// it still is ARGV[1], and replaces the field ARGV[2] of the hash KEYS[2] by
+// the aggregate ARGV[4] including it, if the field still holds the aggregate
+// ARGV[3] it was computed from, or is missing and ARGV[3] empty. It returns 1 if
+// it did so, 0 if the element was removed in the meantime, and -1 if the
+// aggregate was changed in the meantime.
+var compactOldest = valkey.NewLuaScript(`
+if redis.call("LINDEX", KEYS[1], -1) ~= ARGV[1] then
+	return 0
+end
+if (redis.call("HGET", KEYS[2], ARGV[2]) or "") ~= ARGV[3] then
+	return -1
+end
+redis.call("RPOP", KEYS[1])
+redis.call("HSET", KEYS[2], ARGV[2], ARGV[4])
+return 1
+`)
+
+// CompactHistory removes the failed checks before the given time from the
+// history of the endpoint with identifier, which is checked every frequency,
+// and adds them to its hourly aggregates. Every failed check is removed along
+// with updating its aggregate in one step, so that it is neither lost nor
+// counted twice if compacting fails midway, or the history is compacted
+// concurrently. It returns the number of failed checks compacted.
+func CompactHistory(ctx context.Context, vk valkey.Client, identifier string, before time.Time, frequency time.Duration) (int, error) {
+	key := HistoryKey(identifier)
+	hourlyKey := HourlyHistoryKey(identifier)
+	expected := float64(time.Hour) / float64(max(frequency, time.Second))
+	// the aggregates by hour as last read or written
+	aggregates := make(map[string]string)
+	compacted := 0
+	for {
+		record, err := vk.Do(ctx, vk.B().Lindex().Key(key).Index(-1).Build()).ToString()
+		if valkey.IsValkeyNil(err) {
+			break
+		} else if err != nil {
+			return compacted, fmt.Errorf("get oldest failure of %s: %v", identifier, err)
+		}
+		var failure Failure
+		if err := json.Unmarshal([]byte(record), &failure); err != nil {
+			return compacted, fmt.Errorf("unmarshal failure of %s: %v", identifier, err)
+		}
+		if !failure.At.Before(before) {
+			break
+		}
+		hour := failure.At.UTC().Truncate(time.Hour).Format(time.RFC3339)
+		stored, ok := aggregates[hour]
+		if !ok {
+			stored, err = vk.Do(ctx, vk.B().Hget().Key(hourlyKey).Field(hour).Build()).ToString()
+			if err != nil && !valkey.IsValkeyNil(err) {
+				return compacted, fmt.Errorf("get hourly failures of %s: %v", identifier, err)
+			}
+			aggregates[hour] = stored
+		}
+		aggregate := HourlyFailures{Hour: failure.At.UTC().Truncate(time.Hour)}
+		if stored != "" {
+			if err := json.Unmarshal([]byte(stored), &aggregate); err != nil {
+				return compacted, fmt.Errorf("unmarshal hourly failures of %s: %v", identifier, err)
+			}
+		}
+		aggregate.add(failure, expected)
+		data, err := json.Marshal(aggregate)
+		if err != nil {
+			return compacted, fmt.Errorf("marshal hourly failures of %s: %v", identifier, err)
+		}
+		args := []string{record, hour, stored, string(data)}
+		result, err := compactOldest.Exec(ctx, vk, []string{key, hourlyKey}, args).AsInt64()
+		if err != nil {
+			return compacted, fmt.Errorf("compact oldest failure of %s: %v", identifier, err)
+		}
+		switch result {
+		case 1:
+			aggregates[hour] = string(data)
+			compacted++
+		case -1:
+			// the aggregate is read again
+			delete(aggregates, hour)
+		}
+		// otherwise, the history was trimmed in the meantime
+	}
+	return compacted, nil
+}
+
+// HourlyHistory returns the hourly aggregates of the compacted history of the
+// endpoint with identifier, most recent first.
+func HourlyHistory(ctx context.Context, vk valkey.Client, identifier string) ([]HourlyFailures, error) {
+	values, err := vk.Do(ctx, vk.B().Hvals().Key(HourlyHistoryKey(identifier)).Build()).AsStrSlice()
+	if err != nil {
+		return nil, fmt.Errorf("get hourly failures of %s: %v", identifier, err)
+	}
+	hourly := make([]HourlyFailures, 0, len(values))
+	for _, value := range values {
+		var aggregate HourlyFailures
+		if err := json.Unmarshal([]byte(value), &aggregate); err != nil {
+			return nil, fmt.Errorf("unmarshal hourly failures of %s: %v", identifier, err)
+		}
+		hourly = append(hourly, aggregate)
+	}
+	slices.SortFunc(hourly, func(a, b HourlyFailures) int { return b.Hour.Compare(a.Hour) })
+	return hourly, nil
+}
+
+// PruneHourlyHistory removes the hourly aggregates of the endpoint with
+// identifier for the hours before the given time, and returns their number.
+func PruneHourlyHistory(ctx context.Context, vk valkey.Client, identifier string, before time.Time) (int, error) {
+	key := HourlyHistoryKey(identifier)
+	hours, err := vk.Do(ctx, vk.B().Hkeys().Key(key).Build()).AsStrSlice()
+	if err != nil {
+		return 0, fmt.Errorf("get hours of %s: %v", key, err)
+	}
+	var old []string
+	for _, hour := range hours {
+		if t, err := time.Parse(time.RFC3339, hour); err == nil && t.Before(before) {
+			old = append(old, hour)
+		}
+	}
+	if len(old) == 0 {
+		return 0, nil
+	}
+	if err := vk.Do(ctx, vk.B().Hdel().Key(key).Field(old...).Build()).Error(); err != nil {
+		return 0, fmt.Errorf("delete hours of %s: %v", key, err)
+	}
+	return len(old), nil
+}
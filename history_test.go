@@ -0,0 +1,114 @@
+package meow
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/valkey-io/valkey-go"
+)
+
+func TestCompactHistoryConcurrently(t *testing.T) {
+	server := miniredis.RunT(t)
+	// miniredis does not support client-side caching
+	vk, err := valkey.NewClient(valkey.ClientOption{InitAddress: []string{server.Addr()}, DisableCache: true})
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	defer vk.Close()
+	ctx := context.Background()
+
+	hour := time.Date(2025, 11, 20, 16, 0, 0, 0, time.UTC)
+	const failures = 120
+	for i := range failures {
+		failure := Failure{At: hour.Add(time.Duration(i) * time.Minute), Status: 503, LatencyMS: int64(i)}
+		if err := RecordFailure(ctx, vk, "libvirt", MaxHistoryLength, failure); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	compacted := make([]int, 4)
+	for i := range compacted {
+		wg.Go(func() {
+			n, err := CompactHistory(ctx, vk, "libvirt", hour.Add(3*time.Hour), time.Minute)
+			if err != nil {
+				t.Error(err)
+			}
+			compacted[i] = n
+		})
+	}
+	wg.Wait()
+
+	total := 0
+	for _, n := range compacted {
+		total += n
+	}
+	if total != failures {
+		t.Errorf("compacted %d failures in total, want %d", total, failures)
+	}
+	if n, _ := server.List(HistoryKey("libvirt")); len(n) != 0 {
+		t.Errorf("%d failures left in the history, want none", len(n))
+	}
+	hourly, err := HourlyHistory(ctx, vk, "libvirt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hourly) != 2 || hourly[0].Failures != 60 || hourly[1].Failures != 60 {
+		t.Errorf("got hourly failures %+v, want 60 in each of two hours", hourly)
+	}
+	if hourly[1].MaxLatencyMS != 59 || hourly[1].AvgLatencyMS != 29.5 {
+		t.Errorf("got latencies %+v of the first hour, want a maximum of 59 and an average of 29.5", hourly[1])
+	}
+}
+
+func TestFailureReasonsAreTyped(t *testing.T) {
+	reasons := []any{
+		ReasonTimeout, ReasonDNS, ReasonConnectionRefused, ReasonCertificateExpired, ReasonTLS, ReasonStatus,
+		ReasonNotServing, ReasonBodyMismatch, ReasonBodyTooLarge, ReasonRedirectMismatch, ReasonTooManyRedirects,
+		ReasonRequest,
+	}
+	for _, reason := range reasons {
+		if _, ok := reason.(FailureReason); !ok {
+			t.Errorf("reason %q is a %T, want a FailureReason", reason, reason)
+		}
+	}
+}
+
+func TestRecordFailureTrimsHistoryPerEndpoint(t *testing.T) {
+	batch, shards, server := newTestBatch(t)
+	ctx := context.Background()
+	lengths := map[string]uint16{"payments": 250, "libvirt": 0, "toy": 5}
+	at := time.Date(2025, 11, 20, 16, 0, 0, 0, time.UTC)
+	for identifier, length := range lengths {
+		for i := range 300 {
+			failure := Failure{At: at.Add(time.Duration(i) * time.Minute), Status: 503}
+			// both direct and batched writes are trimmed
+			var err error
+			if i%2 == 0 {
+				err = RecordFailure(ctx, shards.For(identifier), identifier, length, failure)
+			} else {
+				err = batch.RecordFailure(ctx, identifier, length, failure)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := batch.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{"payments": 250, "libvirt": HistoryLength, "toy": 5}
+	for identifier, n := range want {
+		history, err := server.List(HistoryKey(identifier))
+		if err != nil {
+			t.Fatalf("list history of %s: %v", identifier, err)
+		}
+		if len(history) != n {
+			t.Errorf("history of %s has %d failures, want %d", identifier, len(history), n)
+		}
+	}
+}
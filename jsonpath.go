@@ -0,0 +1,82 @@
+package meow
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONPath is a path into a JSON document like $.data.items[0].healthy, whose
+// steps are the names of object members, or indices into arrays. Names that
+// are not made up of letters, digits, underscores, and hyphens are given in
+// brackets, e.g. $['health status'].
+type JSONPath []any
+
+// ParseJSONPath parses the path, which starts with $ for the whole document.
+func ParseJSONPath(path string) (JSONPath, error) {
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, fmt.Errorf("path %q does not start with $", path)
+	}
+	var steps JSONPath
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := 1
+			for end < len(rest) && isNameChar(rest[end]) {
+				end++
+			}
+			if end == 1 {
+				return nil, fmt.Errorf("path %q lacks a name after '.'", path)
+			}
+			steps = append(steps, rest[1:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q lacks a closing ']'", path)
+			}
+			inner := rest[1:end]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, inner[1:len(inner)-1])
+			} else if index, err := strconv.Atoi(inner); err == nil && index >= 0 {
+				steps = append(steps, index)
+			} else {
+				return nil, fmt.Errorf("path %q has invalid subscript [%s]", path, inner)
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("path %q has unexpected %q", path, rest[0])
+		}
+	}
+	return steps, nil
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '-' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// Lookup returns the value at the path within the document decoded using
+// encoding/json, and whether there is one.
+func (p JSONPath) Lookup(document any) (any, bool) {
+	value := document
+	for _, step := range p {
+		switch step := step.(type) {
+		case string:
+			object, ok := value.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if value, ok = object[step]; !ok {
+				return nil, false
+			}
+		case int:
+			array, ok := value.([]any)
+			if !ok || step >= len(array) {
+				return nil, false
+			}
+			value = array[step]
+		}
+	}
+	return value, true
+}
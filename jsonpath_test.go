@@ -0,0 +1,51 @@
+package meow
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONPathLookup(t *testing.T) {
+	var document any
+	const raw = `{"data":{"healthy":true,"items":[{"name":"db","up":1},{"name":"cache","up":0}],"health status":"ok"}}`
+	if err := json.Unmarshal([]byte(raw), &document); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path  string
+		want  any
+		found bool
+	}{
+		{"$", document, true},
+		{"$.data.healthy", true, true},
+		{"$.data.items[1].name", "cache", true},
+		{"$.data.items[0].up", 1.0, true},
+		{"$['data']['health status']", "ok", true},
+		{`$.data["items"][0]`, map[string]any{"name": "db", "up": 1.0}, true},
+		{"$.data.items[2]", nil, false},
+		{"$.data.healthy.value", nil, false},
+		{"$.data[0]", nil, false},
+		{"$.status", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			path, err := ParseJSONPath(test.path)
+			if err != nil {
+				t.Fatalf("parse path: %v", err)
+			}
+			got, found := path.Lookup(document)
+			if found != test.found || !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v (found %t), want %v (found %t)", got, found, test.want, test.found)
+			}
+		})
+	}
+}
+
+func TestParseJSONPathRejectsInvalidPaths(t *testing.T) {
+	for _, path := range []string{"data.healthy", "$.", "$.data[", "$.data[-1]", "$.data[x]", "$data", "$.health status"} {
+		if steps, err := ParseJSONPath(path); err == nil {
+			t.Errorf("parse %q: got steps %v, want an error", path, steps)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package meow
+
+import (
+	"context"
+	"strings"
+)
+
+// The keys of an endpoint enclose its identifier in a hash tag, so that they
+// all belong to the same slot when using a Valkey cluster.
+
+// EndpointKey returns the key of the hash holding the endpoint with identifier.
+func EndpointKey(identifier string) string {
+	return "endpoints:{" + identifier + "}"
+}
+
+// StateKey returns the key of the hash holding the current state of the
+// endpoint with identifier.
+func StateKey(identifier string) string {
+	return "state:{" + identifier + "}"
+}
+
+// LeaseKey returns the key of the lease on checking the endpoint with
+// identifier.
+func LeaseKey(identifier string) string {
+	return "lease:{" + identifier + "}"
+}
+
+// RegionLeaseKey returns the key of the lease on checking the endpoint with
+// identifier from the region.
+func RegionLeaseKey(identifier, region string) string {
+	return "lease:{" + identifier + "}:" + region
+}
+
+// RegionStateKey returns the key of the hash holding the outcome of the last
+// check of the endpoint with identifier from the region.
+func RegionStateKey(identifier, region string) string {
+	return "state:{" + identifier + "}:" + region
+}
+
+// HistoryKey returns the key of the list holding the failed checks of the
+// endpoint with identifier, most recent first.
+func HistoryKey(identifier string) string {
+	return "history:{" + identifier + "}"
+}
+
+// HourlyHistoryKey returns the key of the hash holding the hourly aggregates
+// of the compacted history of the endpoint with identifier.
+func HourlyHistoryKey(identifier string) string {
+	return "hourly:{" + identifier + "}"
+}
+
+// LatencyKey returns the key of the sorted set holding the latencies of the
+// checks of the endpoint with identifier.
+func LatencyKey(identifier string) string {
+	return "latency:{" + identifier + "}"
+}
+
+// GroupKey returns the key of the hash holding the group with identifier.
+func GroupKey(identifier string) string {
+	return "groups:{" + identifier + "}"
+}
+
+// IdempotencyKey returns the key holding the response to a request with the
+// given Idempotency-Key header concerning the endpoint with identifier.
+func IdempotencyKey(identifier, requestKey string) string {
+	return "idempotency:{" + identifier + "}:" + requestKey
+}
+
+// KeyIdentifier returns the identifier of the endpoint the key belongs to. Keys
+// stored before hash tags were introduced, e.g. endpoints:libvirt, are
+// supported, too.
+func KeyIdentifier(key string) string {
+	_, tagged, ok := strings.Cut(key, "{")
+	if !ok {
+		_, identifier, _ := strings.Cut(key, ":")
+		return identifier
+	}
+	identifier, _, _ := strings.Cut(tagged, "}")
+	return identifier
+}
+
+// LegacyKeys returns the keys of the endpoints and their states stored before
+// hash tags were introduced, which are not found by their identifier anymore,
+// and are to be renamed using cmd/migrate.
+func LegacyKeys(ctx context.Context, shards *Shards) ([]string, error) {
+	legacy := make([]string, 0)
+	for _, pattern := range []string{"endpoints:*", "state:*"} {
+		keys, err := shards.Keys(ctx, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if !strings.Contains(key, "{") {
+				legacy = append(legacy, key)
+			}
+		}
+	}
+	return legacy, nil
+}
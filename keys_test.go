@@ -0,0 +1,72 @@
+package meow
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/valkey-io/valkey-go"
+)
+
+func TestKeysEncloseIdentifierInHashTag(t *testing.T) {
+	keys := []string{
+		EndpointKey("libvirt"),
+		StateKey("libvirt"),
+		LeaseKey("libvirt"),
+		RegionLeaseKey("libvirt", "eu-west"),
+		RegionStateKey("libvirt", "eu-west"),
+		HistoryKey("libvirt"),
+		HourlyHistoryKey("libvirt"),
+		LatencyKey("libvirt"),
+		GroupKey("libvirt"),
+		IdempotencyKey("libvirt", "4f2a"),
+	}
+	for _, key := range keys {
+		if !strings.Contains(key, "{libvirt}") {
+			t.Errorf("key %s does not enclose the identifier in a hash tag", key)
+		}
+		if identifier := KeyIdentifier(key); identifier != "libvirt" {
+			t.Errorf("got identifier %q of key %s, want libvirt", identifier, key)
+		}
+	}
+}
+
+func TestKeyIdentifierOfLegacyKeys(t *testing.T) {
+	for key, want := range map[string]string{
+		"endpoints:libvirt": "libvirt",
+		"state:go-dev":      "go-dev",
+		"endpoints:":        "",
+	} {
+		if identifier := KeyIdentifier(key); identifier != want {
+			t.Errorf("got identifier %q of key %s, want %q", identifier, key, want)
+		}
+	}
+}
+
+func TestLegacyKeys(t *testing.T) {
+	server := miniredis.RunT(t)
+	// miniredis does not support client-side caching
+	options := valkey.ClientOption{InitAddress: []string{server.Addr()}, DisableCache: true}
+	shards, err := NewShardsWithOptions(options, 2)
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	defer shards.Close()
+
+	server.DB(0).HSet(EndpointKey("libvirt"), FieldIdentifier, "libvirt")
+	server.DB(0).HSet(RegionStateKey("libvirt", "eu-west"), StateFieldState, StateUp)
+	server.DB(1).HSet(StateKey("go-dev"), StateFieldState, StateUp)
+	server.DB(0).HSet("endpoints:legacy", FieldIdentifier, "legacy")
+	server.DB(1).HSet("state:legacy", StateFieldState, StateDown)
+
+	legacy, err := LegacyKeys(context.Background(), shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(legacy)
+	if want := []string{"endpoints:legacy", "state:legacy"}; !slices.Equal(legacy, want) {
+		t.Errorf("got legacy keys %v, want %v", legacy, want)
+	}
+}
@@ -0,0 +1,228 @@
+package meow
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Label keys consist of an optional DNS subdomain prefix followed by a slash,
+// e.g. example.com/, and a name, e.g. env. Names and values consist of at most
+// 63 alphanumeric characters, dashes, underscores, and dots, and begin and end
+// with an alphanumeric character, like Kubernetes labels.
+const (
+	labelPrefixPatternRaw = `^[a-z0-9]([-a-z0-9.]{0,251}[a-z0-9])?$`
+	labelNamePatternRaw   = `^[A-Za-z0-9]([-A-Za-z0-9_.]{0,61}[A-Za-z0-9])?$`
+)
+
+var (
+	labelPrefixPattern = regexp.MustCompile(labelPrefixPatternRaw)
+	labelNamePattern   = regexp.MustCompile(labelNamePatternRaw)
+)
+
+// validateLabel returns an error if the key or value of a label is malformed.
+// Values may be empty.
+func validateLabel(key, value string) error {
+	name := key
+	if prefix, rest, ok := strings.Cut(key, "/"); ok {
+		if !labelPrefixPattern.MatchString(prefix) {
+			return fmt.Errorf(`prefix of label key "%s" does not match pattern "%s"`, key, labelPrefixPatternRaw)
+		}
+		name = rest
+	}
+	if !labelNamePattern.MatchString(name) {
+		return fmt.Errorf(`label key "%s" does not match pattern "%s"`, key, labelNamePatternRaw)
+	}
+	if value != "" && !labelNamePattern.MatchString(value) {
+		return fmt.Errorf(`value "%s" of label "%s" does not match pattern "%s"`, value, key, labelNamePatternRaw)
+	}
+	return nil
+}
+
+// Operators of the requirements of a label selector.
+const (
+	SelectEquals    = "="
+	SelectNotEquals = "!="
+	SelectIn        = "in"
+	SelectNotIn     = "notin"
+	SelectExists    = "exists"
+	SelectNotExists = "!"
+)
+
+// Requirement is a condition on the labels of an endpoint, which is met if the
+// label with Key
+//   - has the value Values[0] for SelectEquals,
+//   - has another value, or is not set, for SelectNotEquals,
+//   - has one of the Values for SelectIn,
+//   - has none of the Values, or is not set, for SelectNotIn,
+//   - is set for SelectExists, or not set for SelectNotExists.
+type Requirement struct {
+	Key      string
+	Operator string
+	Values   []string
+}
+
+// Matches reports whether the labels meet the requirement.
+func (r Requirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case SelectEquals, SelectIn:
+		return ok && slices.Contains(r.Values, value)
+	case SelectNotEquals, SelectNotIn:
+		return !ok || !slices.Contains(r.Values, value)
+	case SelectExists:
+		return ok
+	case SelectNotExists:
+		return !ok
+	}
+	return false
+}
+
+// Selector selects endpoints by their labels, which must meet all of its
+// requirements.
+type Selector []Requirement
+
+// Matches reports whether the labels meet all requirements of the selector.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseSelector parses a comma-separated list of requirements like Kubernetes
+// label selectors, e.g. "env=prod,tier!=cache", "env in (prod,staging)",
+// "tier notin (cache)", "canary", or "!canary". The operator == is the same as
+// =. An empty selector selects all endpoints.
+func ParseSelector(raw string) (Selector, error) {
+	p := selectorParser{input: raw}
+	selector := make(Selector, 0)
+	if p.skipSpace(); p.done() {
+		return selector, nil
+	}
+	for {
+		r, err := p.requirement()
+		if err != nil {
+			return nil, fmt.Errorf(`selector "%s": %v`, raw, err)
+		}
+		selector = append(selector, r)
+		p.skipSpace()
+		if p.done() {
+			return selector, nil
+		}
+		if !p.consume(",") {
+			return nil, fmt.Errorf(`selector "%s": expected "," at position %d`, raw, p.pos)
+		}
+	}
+}
+
+// selectorParser reads the requirements of a selector from input, whose next
+// character to be read is at pos.
+type selectorParser struct {
+	input string
+	pos   int
+}
+
+func (p *selectorParser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *selectorParser) skipSpace() {
+	for !p.done() && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// consume skips the token if the input continues with it, and reports whether
+// it did.
+func (p *selectorParser) consume(token string) bool {
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+// word reads a label key or value, which ends at a space, an operator, a comma,
+// or a parenthesis.
+func (p *selectorParser) word() string {
+	start := p.pos
+	for !p.done() && !strings.ContainsRune(" =!,()", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *selectorParser) requirement() (Requirement, error) {
+	p.skipSpace()
+	if p.consume("!") {
+		p.skipSpace()
+		key := p.word()
+		if err := validateLabel(key, ""); err != nil {
+			return Requirement{}, err
+		}
+		return Requirement{Key: key, Operator: SelectNotExists}, nil
+	}
+	key := p.word()
+	if err := validateLabel(key, ""); err != nil {
+		return Requirement{}, err
+	}
+	p.skipSpace()
+	var operator string
+	switch {
+	case p.done() || p.input[p.pos] == ',':
+		return Requirement{Key: key, Operator: SelectExists}, nil
+	case p.consume("=="), p.consume("="):
+		operator = SelectEquals
+	case p.consume("!="):
+		operator = SelectNotEquals
+	default:
+		switch word := p.word(); word {
+		case SelectIn, SelectNotIn:
+			values, err := p.values(key)
+			if err != nil {
+				return Requirement{}, err
+			}
+			return Requirement{Key: key, Operator: word, Values: values}, nil
+		default:
+			return Requirement{}, fmt.Errorf(`expected operator after "%s" at position %d`, key, p.pos-len(word))
+		}
+	}
+	p.skipSpace()
+	value := p.word()
+	if err := validateLabel(key, value); err != nil {
+		return Requirement{}, err
+	}
+	return Requirement{Key: key, Operator: operator, Values: []string{value}}, nil
+}
+
+// values reads the parenthesized, comma-separated values of a set-based
+// requirement on the label with key.
+func (p *selectorParser) values(key string) ([]string, error) {
+	p.skipSpace()
+	if !p.consume("(") {
+		return nil, fmt.Errorf(`expected "(" at position %d`, p.pos)
+	}
+	values := make([]string, 0)
+	for {
+		p.skipSpace()
+		value := p.word()
+		if value == "" {
+			return nil, fmt.Errorf("expected value at position %d", p.pos)
+		}
+		if err := validateLabel(key, value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		p.skipSpace()
+		if p.consume(")") {
+			return values, nil
+		}
+		if !p.consume(",") {
+			return nil, fmt.Errorf(`expected "," or ")" at position %d`, p.pos)
+		}
+	}
+}
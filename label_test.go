@@ -0,0 +1,101 @@
+package meow
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want Selector
+	}{
+		{"", Selector{}},
+		{"  ", Selector{}},
+		{"env=prod", Selector{{Key: "env", Operator: SelectEquals, Values: []string{"prod"}}}},
+		{"env==prod", Selector{{Key: "env", Operator: SelectEquals, Values: []string{"prod"}}}},
+		{"env = prod", Selector{{Key: "env", Operator: SelectEquals, Values: []string{"prod"}}}},
+		{"tier!=cache", Selector{{Key: "tier", Operator: SelectNotEquals, Values: []string{"cache"}}}},
+		{"env=", Selector{{Key: "env", Operator: SelectEquals, Values: []string{""}}}},
+		{"env in (prod, staging)", Selector{{Key: "env", Operator: SelectIn, Values: []string{"prod", "staging"}}}},
+		{"tier notin (cache)", Selector{{Key: "tier", Operator: SelectNotIn, Values: []string{"cache"}}}},
+		{"canary", Selector{{Key: "canary", Operator: SelectExists}}},
+		{"!canary", Selector{{Key: "canary", Operator: SelectNotExists}}},
+		{"example.com/team=ops", Selector{{Key: "example.com/team", Operator: SelectEquals, Values: []string{"ops"}}}},
+		{"env=prod,tier!=cache, !canary", Selector{
+			{Key: "env", Operator: SelectEquals, Values: []string{"prod"}},
+			{Key: "tier", Operator: SelectNotEquals, Values: []string{"cache"}},
+			{Key: "canary", Operator: SelectNotExists},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			got, err := ParseSelector(test.raw)
+			if err != nil {
+				t.Fatalf("got error %v, want none", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseSelectorRejectsMalformedSelectors(t *testing.T) {
+	for _, raw := range []string{
+		"=prod",
+		"env=prod,",
+		",env=prod",
+		"env=prod tier=cache",
+		"env>prod",
+		"env in prod",
+		"env in ()",
+		"env in (prod",
+		"env in (prod staging)",
+		"env notin (prod,)",
+		"env=pr*d",
+		"-env=prod",
+		"env=prod-",
+		"Example.com/env=prod",
+		"!",
+	} {
+		t.Run(raw, func(t *testing.T) {
+			if selector, err := ParseSelector(raw); err == nil {
+				t.Errorf("got %+v, want an error", selector)
+			}
+		})
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	labels := map[string]string{"env": "prod", "tier": "web"}
+	tests := []struct {
+		raw  string
+		want bool
+	}{
+		{"", true},
+		{"env=prod", true},
+		{"env=staging", false},
+		{"tier!=cache", true},
+		{"canary!=true", true},
+		{"env in (prod,staging)", true},
+		{"env notin (prod)", false},
+		{"region notin (eu)", true},
+		{"tier", true},
+		{"canary", false},
+		{"!canary", true},
+		{"!env", false},
+		{"env=prod,tier=cache", false},
+	}
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			selector, err := ParseSelector(test.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := selector.Matches(labels); got != test.want {
+				t.Errorf("got %t for labels %v, want %t", got, labels, test.want)
+			}
+		})
+	}
+}
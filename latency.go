@@ -0,0 +1,89 @@
+package meow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// LatencyRetention is how long the latencies of the checks of an endpoint are
+// kept.
+const LatencyRetention = 24 * time.Hour
+
+// LatencyChannel is the Valkey pub/sub channel the latencies of the checks are
+// published on.
+const LatencyChannel = "meow:latencies"
+
+// LatencyUpdate indicates that a check of an endpoint completed with a latency
+// in milliseconds.
+type LatencyUpdate struct {
+	Identifier string    `json:"identifier"`
+	LatencyMS  int64     `json:"latency_ms"`
+	At         time.Time `json:"at"`
+}
+
+// PublishLatency publishes the latency update on the LatencyChannel. It is not
+// part of the commands recording the latency, which are buffered and sent with
+// those of other endpoints, since a cluster client rejects pipelines mixing
+// commands on keys of different slots and commands without key.
+func PublishLatency(ctx context.Context, vk valkey.Client, update LatencyUpdate) error {
+	data, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("marshal latency update %v: %v", update, err)
+	}
+	if err := vk.Do(ctx, vk.B().Publish().Channel(LatencyChannel).Message(string(data)).Build()).Error(); err != nil {
+		return fmt.Errorf("publish latency of %s: %v", update.Identifier, err)
+	}
+	return nil
+}
+
+// RecordLatency adds the latency of a check of the endpoint with identifier
+// completed at the given time, and removes the latencies older than
+// LatencyRetention.
+func RecordLatency(ctx context.Context, vk valkey.Client, identifier string, at time.Time, latency time.Duration) error {
+	for _, result := range vk.DoMulti(ctx, latencyCommands(vk, identifier, at, latency)...) {
+		if err := result.Error(); err != nil {
+			return fmt.Errorf("record latency of %s: %v", identifier, err)
+		}
+	}
+	return nil
+}
+
+// latencyCommands add the latency to a sorted set scored by the time of the
+// check in milliseconds. The member is prefixed with the time in nanoseconds,
+// so that equal latencies are kept apart.
+func latencyCommands(vk valkey.Client, identifier string, at time.Time, latency time.Duration) valkey.Commands {
+	key := LatencyKey(identifier)
+	member := strconv.FormatInt(at.UnixNano(), 10) + ":" + strconv.FormatInt(latency.Milliseconds(), 10)
+	expired := strconv.FormatInt(at.Add(-LatencyRetention).UnixMilli(), 10)
+	return valkey.Commands{
+		vk.B().Zadd().Key(key).ScoreMember().ScoreMember(float64(at.UnixMilli()), member).Build(),
+		vk.B().Zremrangebyscore().Key(key).Min("-inf").Max("(" + expired).Build(),
+	}
+}
+
+// Latencies returns the latencies in milliseconds of the checks of the endpoint
+// with identifier completed since the given time, oldest first.
+func Latencies(ctx context.Context, vk valkey.Client, identifier string, since time.Time) ([]int64, error) {
+	key := LatencyKey(identifier)
+	cmd := vk.B().Zrange().Key(key).Min(strconv.FormatInt(since.UnixMilli(), 10)).Max("+inf").Byscore().Build()
+	members, err := vk.Do(ctx, cmd).AsStrSlice()
+	if err != nil {
+		return nil, fmt.Errorf("get latencies of %s: %v", identifier, err)
+	}
+	latencies := make([]int64, 0, len(members))
+	for _, member := range members {
+		_, raw, _ := strings.Cut(member, ":")
+		latency, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("latency %q of %s not a number: %v", member, identifier, err)
+		}
+		latencies = append(latencies, latency)
+	}
+	return latencies, nil
+}
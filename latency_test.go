@@ -0,0 +1,64 @@
+package meow
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/valkey-io/valkey-go"
+)
+
+func TestRecordLatencyKeepsRetention(t *testing.T) {
+	server := miniredis.RunT(t)
+	// miniredis does not support client-side caching
+	vk, err := valkey.NewClient(valkey.ClientOption{InitAddress: []string{server.Addr()}, DisableCache: true})
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	defer vk.Close()
+	ctx := context.Background()
+
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	checks := []struct {
+		at      time.Time
+		latency time.Duration
+	}{
+		{now.Add(-LatencyRetention - time.Minute), 900 * time.Millisecond},
+		{now.Add(-2 * time.Hour), 120 * time.Millisecond},
+		{now.Add(-30 * time.Minute), 80 * time.Millisecond},
+		// equal latencies of different checks are kept apart
+		{now.Add(-20 * time.Minute), 80 * time.Millisecond},
+		{now, 45 * time.Millisecond},
+	}
+	for _, check := range checks {
+		if err := RecordLatency(ctx, vk, "libvirt", check.at, check.latency); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		since time.Time
+		want  []int64
+	}{
+		{"retention", now.Add(-LatencyRetention - time.Hour), []int64{120, 80, 80, 45}},
+		{"last hour", now.Add(-time.Hour), []int64{80, 80, 45}},
+		{"future", now.Add(time.Minute), []int64{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Latencies(ctx, vk, "libvirt", test.since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got latencies %v since %v, want %v", got, test.since, test.want)
+			}
+		})
+	}
+	if got, err := Latencies(ctx, vk, "go-dev", now.Add(-time.Hour)); err != nil || len(got) > 0 {
+		t.Errorf("got latencies %v (%v) of endpoint never checked, want none", got, err)
+	}
+}
@@ -0,0 +1,44 @@
+package meow
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// renewOrAcquire extends the lease if held by the owner (ARGV[1]), or acquires
+// it if nobody holds it, for ARGV[2] milliseconds. It returns 1 if the lease was
+// renewed, 2 if it was acquired, and 0 otherwise.
+var renewOrAcquire = valkey.NewLuaScript(`
+local owner = redis.call("GET", KEYS[1])
+if owner == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+if not owner then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 2
+end
+return 0
+`)
+
+// HoldLease reports whether owner holds the lease on checking the endpoint with
+// identifier for the given duration, which is renewed if owner already holds
+// it, and acquired if nobody does, and whether it was acquired rather than
+// renewed. A lease not renewed in time expires, so that another owner can take
+// it over. A lease deleted by ResetState is acquired again.
+func HoldLease(ctx context.Context, vk valkey.Client, identifier, owner string, ttl time.Duration) (held, acquired bool, err error) {
+	return holdLease(ctx, vk, LeaseKey(identifier), owner, ttl)
+}
+
+func holdLease(ctx context.Context, vk valkey.Client, key, owner string, ttl time.Duration) (held, acquired bool, err error) {
+	args := []string{owner, strconv.FormatInt(ttl.Milliseconds(), 10)}
+	result, err := renewOrAcquire.Exec(ctx, vk, []string{key}, args).AsInt64()
+	if err != nil {
+		return false, false, fmt.Errorf("hold lease %s: %v", key, err)
+	}
+	return result > 0, result == 2, nil
+}
@@ -0,0 +1,79 @@
+package meow
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/valkey-io/valkey-go"
+)
+
+func TestHoldLeaseOfCompetingProbes(t *testing.T) {
+	server := miniredis.RunT(t)
+	// every probe has a client of its own, and miniredis does not support
+	// client-side caching
+	probes := make(map[string]valkey.Client)
+	for _, owner := range []string{"probe-a", "probe-b"} {
+		vk, err := valkey.NewClient(valkey.ClientOption{InitAddress: []string{server.Addr()}, DisableCache: true})
+		if err != nil {
+			t.Fatalf("connect to miniredis: %v", err)
+		}
+		defer vk.Close()
+		probes[owner] = vk
+	}
+	ctx := context.Background()
+	const ttl = 10 * time.Second
+
+	var mu sync.Mutex
+	var holders []string
+	var wg sync.WaitGroup
+	for owner, vk := range probes {
+		wg.Go(func() {
+			held, acquired, err := HoldLease(ctx, vk, "libvirt", owner, ttl)
+			if err != nil {
+				t.Errorf("hold lease as %s: %v", owner, err)
+			}
+			if held != acquired {
+				t.Errorf("%s holds lease %t, acquired %t, want both or neither", owner, held, acquired)
+			}
+			if held {
+				mu.Lock()
+				holders = append(holders, owner)
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	if len(holders) != 1 {
+		t.Fatalf("lease is held by %v, want exactly one probe", holders)
+	}
+	holder, other := holders[0], "probe-a"
+	if holder == other {
+		other = "probe-b"
+	}
+	if owner, _ := server.Get(LeaseKey("libvirt")); owner != holder {
+		t.Errorf("lease is stored as held by %q, want %q", owner, holder)
+	}
+
+	// the holder renews the lease before it expires, so that the other probe
+	// cannot take it over
+	server.FastForward(ttl / 2)
+	if held, acquired, err := HoldLease(ctx, probes[holder], "libvirt", holder, ttl); err != nil || !held || acquired {
+		t.Errorf("renew lease as %s: got held %t, acquired %t (%v), want it renewed", holder, held, acquired, err)
+	}
+	server.FastForward(ttl / 2)
+	if held, _, err := HoldLease(ctx, probes[other], "libvirt", other, ttl); err != nil || held {
+		t.Errorf("hold renewed lease as %s: got held %t (%v), want it refused", other, held, err)
+	}
+
+	// once the holder stops renewing the lease, it expires and is taken over
+	server.FastForward(ttl)
+	if held, acquired, err := HoldLease(ctx, probes[other], "libvirt", other, ttl); err != nil || !held || !acquired {
+		t.Errorf("hold expired lease as %s: got held %t, acquired %t (%v), want it acquired", other, held, acquired, err)
+	}
+	if held, _, err := HoldLease(ctx, probes[holder], "libvirt", holder, ttl); err != nil || held {
+		t.Errorf("hold lease taken over as %s: got held %t (%v), want it refused", holder, held, err)
+	}
+}
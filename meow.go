@@ -1,5 +1,15 @@
 package meow
 
+// Version is the version of meow, which is set when building a release, e.g.
+// using -ldflags "-X github.com/patrickbucher/meow.Version=v1.2.0".
+var Version = "dev"
+
+// DefaultUserAgent is the User-Agent header endpoints are requested with,
+// unless configured otherwise.
+func DefaultUserAgent() string {
+	return "meow-monitor/" + Version
+}
+
 // Emojis indicating endpoints being available, unavailable, and available again.
 const (
 	CatAvailable      = '\U0001f431'
@@ -0,0 +1,96 @@
+package meow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CamelCaseJSON returns the payload as JSON like json.Marshal, but with
+// camelCase field names, e.g. statusOnline instead of status_online.
+func (p EndpointPayload) CamelCaseJSON() ([]byte, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("marshal payload %v: %v", p, err)
+	}
+	return CamelCaseKeys(data)
+}
+
+// CamelCaseKeys rewrites the keys of all objects in the JSON data from
+// snake_case to camelCase, keeping their order.
+func CamelCaseKeys(data []byte) ([]byte, error) {
+	// level is an object or array being rewritten
+	type level struct {
+		object bool
+		key    bool // whether the next token is a key of the object
+		n      int  // number of keys or elements written
+	}
+	var stack []*level
+	var out bytes.Buffer
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	for {
+		token, err := dec.Token()
+		if err == io.EOF && len(stack) > 0 {
+			return nil, fmt.Errorf("rewrite keys of JSON: %v", io.ErrUnexpectedEOF)
+		}
+		if err == io.EOF {
+			return out.Bytes(), nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rewrite keys of JSON: %v", err)
+		}
+		if delim, ok := token.(json.Delim); ok && (delim == '}' || delim == ']') {
+			out.WriteByte(byte(delim))
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 && stack[len(stack)-1].object {
+				stack[len(stack)-1].key = true
+			}
+			continue
+		}
+		var top *level
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+			if top.n > 0 && (top.key || !top.object) {
+				out.WriteByte(',')
+			}
+			if top.key {
+				top.n++
+				top.key = false
+				key, _ := json.Marshal(camelCase(token.(string)))
+				out.Write(key)
+				out.WriteByte(':')
+				continue
+			}
+			if !top.object {
+				top.n++
+			}
+		}
+		if delim, ok := token.(json.Delim); ok {
+			out.WriteByte(byte(delim))
+			stack = append(stack, &level{object: delim == '{', key: delim == '{'})
+			continue
+		}
+		value, err := json.Marshal(token)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite keys of JSON: %v", err)
+		}
+		out.Write(value)
+		if top != nil && top.object {
+			top.key = true
+		}
+	}
+}
+
+// camelCase converts a snake_case name to camelCase.
+func camelCase(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,33 @@
+package meow
+
+import "testing"
+
+func TestCamelCaseKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"flat", `{"status_online":200,"fail_after":3}`, `{"statusOnline":200,"failAfter":3}`},
+		{"nested", `{"check_window":{"start":"09:00","time_zone":"UTC"},"alerts":[{"alert_type":"webhook"}]}`,
+			`{"checkWindow":{"start":"09:00","timeZone":"UTC"},"alerts":[{"alertType":"webhook"}]}`},
+		{"values kept", `{"user_agent":"snake_case/1.0","labels":{"env":"prod"},"list":["a_b",1.50,true,null]}`,
+			`{"userAgent":"snake_case/1.0","labels":{"env":"prod"},"list":["a_b",1.50,true,null]}`},
+		{"array of objects", `[{"fail_after":1},{"fail_after":2}]`, `[{"failAfter":1},{"failAfter":2}]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := CamelCaseKeys([]byte(test.data))
+			if err != nil {
+				t.Fatalf("got error %v, want none", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+
+	if _, err := CamelCaseKeys([]byte(`{"fail_after":`)); err == nil {
+		t.Error("got no error for malformed JSON")
+	}
+}
@@ -0,0 +1,146 @@
+package meow
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Notifier sends alerts somewhere.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// MultiNotifier sends alerts to all of its notifiers concurrently.
+type MultiNotifier []Notifier
+
+// Notify sends the alert to all notifiers, and returns their errors joined
+// using errors.Join.
+func (m MultiNotifier) Notify(ctx context.Context, alert Alert) error {
+	return errors.Join(m.NotifyEach(ctx, alert)...)
+}
+
+// NotifyEach sends the alert to all notifiers, and returns the error of each
+// notifier at its index, which is nil if it succeeded, e.g. to retry sending
+// the alert to the notifiers that failed.
+func (m MultiNotifier) NotifyEach(ctx context.Context, alert Alert) []error {
+	errs := make([]error, len(m))
+	var wg sync.WaitGroup
+	for i, notifier := range m {
+		wg.Go(func() {
+			errs[i] = notifier.Notify(ctx, alert)
+		})
+	}
+	wg.Wait()
+	return errs
+}
+
+// WebhookNotifier posts alerts as JSON to a URL. Alerts with a webhook secret
+// are signed (see SignWebhook).
+type WebhookNotifier struct {
+	Client *http.Client
+	URL    string
+}
+
+// Notify posts the alert to the URL.
+func (n *WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	var sign func(*http.Request, []byte)
+	if alert.WebhookSecret != "" {
+		sign = func(req *http.Request, data []byte) {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			nonce := rand.Text()
+			req.Header.Set(WebhookTimestampHeader, timestamp)
+			req.Header.Set(WebhookNonceHeader, nonce)
+			req.Header.Set(WebhookSignatureHeader, SignWebhook(alert.WebhookSecret, timestamp, nonce, data))
+		}
+	}
+	return postAlert(ctx, n.Client, AlertWebhook, n.URL, alert, alert, sign)
+}
+
+// SlackNotifier posts the messages of alerts to the URL of a Slack incoming
+// webhook.
+type SlackNotifier struct {
+	Client *http.Client
+	URL    string
+}
+
+// Notify posts the alert's message to the URL.
+func (n *SlackNotifier) Notify(ctx context.Context, alert Alert) error {
+	body := struct {
+		Text string `json:"text"`
+	}{alert.Message}
+	return postAlert(ctx, n.Client, AlertSlack, n.URL, alert, body, nil)
+}
+
+// PagerDutyNotifier sends alerts as events to PagerDutyEventsURL, triggering an
+// incident when the endpoint goes offline and resolving it once it comes back
+// online.
+type PagerDutyNotifier struct {
+	Client     *http.Client
+	RoutingKey string
+}
+
+// Notify sends the event of the alert.
+func (n *PagerDutyNotifier) Notify(ctx context.Context, alert Alert) error {
+	event := newPagerDutyEvent(n.RoutingKey, alert)
+	return postAlert(ctx, n.Client, AlertPagerDuty, PagerDutyEventsURL, alert, event, nil)
+}
+
+// EmailNotifier sends alerts by email to a comma-separated list of recipients.
+type EmailNotifier struct {
+	SMTP       *SMTPServer
+	Recipients string
+}
+
+// Notify sends the alert by email, which fails without an SMTP server.
+func (n *EmailNotifier) Notify(ctx context.Context, alert Alert) error {
+	if n.SMTP == nil {
+		return fmt.Errorf("send %s alert of %s: no SMTP server configured", AlertEmail, alert.Identifier)
+	}
+	if err := n.SMTP.SendAlert(ctx, n.Recipients, alert); err != nil {
+		return fmt.Errorf("send %s alert of %s: %v", AlertEmail, alert.Identifier, err)
+	}
+	return nil
+}
+
+// unsupportedNotifier fails to send alerts to channels of its type.
+type unsupportedNotifier string
+
+func (n unsupportedNotifier) Notify(ctx context.Context, alert Alert) error {
+	return fmt.Errorf(`"%s" is not a supported alert channel type`, string(n))
+}
+
+// postAlert posts the body as JSON to the target on behalf of a channel of the
+// given type, after signing the request if sign is not nil.
+func postAlert(ctx context.Context, client *http.Client, channelType, target string, alert Alert, body any, sign func(*http.Request, []byte)) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal alert %v: %v", alert, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("prepare %s alert of %s: %v", channelType, alert.Identifier, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sign != nil {
+		sign(req, data)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send %s alert of %s: %v", channelType, alert.Identifier, err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("send %s alert of %s: status %d", channelType, alert.Identifier, res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package meow
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPagerDutyNotifierSendsEventsOfOneIncident(t *testing.T) {
+	events := make(chan pagerDutyEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s request of %s, want a POST of JSON", r.Method, r.Header.Get("Content-Type"))
+		}
+		var event pagerDutyEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decode event: %v", err)
+		}
+		events <- event
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	defer func(url string) { PagerDutyEventsURL = url }(PagerDutyEventsURL)
+	PagerDutyEventsURL = server.URL
+
+	notifier := &PagerDutyNotifier{Client: server.Client(), RoutingKey: "routing-key"}
+	at := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		alert Alert
+		want  pagerDutyEvent
+	}{
+		{
+			"down",
+			Alert{Identifier: "libvirt", State: StateDown, At: at, Message: "libvirt is offline"},
+			pagerDutyEvent{
+				RoutingKey:  "routing-key",
+				EventAction: "trigger",
+				DedupKey:    "meow-libvirt",
+				Payload: &pagerDutyPayload{
+					Summary:   "libvirt is offline",
+					Source:    "libvirt",
+					Severity:  "critical",
+					Timestamp: "2026-10-15T12:00:00Z",
+				},
+			},
+		},
+		{
+			"up",
+			Alert{Identifier: "libvirt", State: StateUp, At: at, Message: "libvirt is online again"},
+			pagerDutyEvent{RoutingKey: "routing-key", EventAction: "resolve", DedupKey: "meow-libvirt"},
+		},
+		{
+			"test",
+			Alert{Identifier: "libvirt", State: StateDown, At: at, Message: "test alert", Test: true},
+			pagerDutyEvent{
+				RoutingKey:  "routing-key",
+				EventAction: "trigger",
+				DedupKey:    "meow-test-libvirt",
+				Payload: &pagerDutyPayload{
+					Summary:   "test alert",
+					Source:    "libvirt",
+					Severity:  "info",
+					Timestamp: "2026-10-15T12:00:00Z",
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := notifier.Notify(context.Background(), test.alert); err != nil {
+				t.Fatalf("notify: %v", err)
+			}
+			got := <-events
+			if got.RoutingKey != test.want.RoutingKey || got.EventAction != test.want.EventAction || got.DedupKey != test.want.DedupKey {
+				t.Errorf("got event %+v, want %+v", got, test.want)
+			}
+			if (got.Payload == nil) != (test.want.Payload == nil) ||
+				got.Payload != nil && *got.Payload != *test.want.Payload {
+				t.Errorf("got payload %+v, want %+v", got.Payload, test.want.Payload)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifierSignsAlerts(t *testing.T) {
+	type delivery struct {
+		header http.Header
+		body   []byte
+	}
+	deliveries := make(chan delivery, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{r.Header, body}
+	}))
+	defer server.Close()
+
+	notifier := &WebhookNotifier{Client: server.Client(), URL: server.URL}
+	alert := Alert{Identifier: "libvirt", State: StateDown, At: time.Now(), Message: "libvirt is offline", WebhookSecret: "s3cr3t"}
+	nonces := make(map[string]bool)
+	for range 2 {
+		if err := notifier.Notify(context.Background(), alert); err != nil {
+			t.Fatalf("notify: %v", err)
+		}
+		got := <-deliveries
+
+		timestamp := got.header.Get(WebhookTimestampHeader)
+		sent, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || time.Since(time.Unix(sent, 0)).Abs() > time.Minute {
+			t.Errorf("got timestamp %q, want the current Unix time", timestamp)
+		}
+		nonce := got.header.Get(WebhookNonceHeader)
+		if nonce == "" || nonces[nonce] {
+			t.Errorf("got nonce %q, want a fresh one", nonce)
+		}
+		nonces[nonce] = true
+
+		// the receiver computes the signature on its own rather than by
+		// SignWebhook
+		mac := hmac.New(sha256.New, []byte("s3cr3t"))
+		mac.Write([]byte(timestamp + "." + nonce + "."))
+		mac.Write(got.body)
+		want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		if signature := got.header.Get(WebhookSignatureHeader); !hmac.Equal([]byte(signature), []byte(want)) {
+			t.Errorf("got signature %q, want %q", signature, want)
+		}
+
+		var received Alert
+		if err := json.Unmarshal(got.body, &received); err != nil {
+			t.Fatalf("unmarshal %s: %v", got.body, err)
+		}
+		if received.Identifier != alert.Identifier || strings.Contains(string(got.body), alert.WebhookSecret) {
+			t.Errorf("got alert %s, want the one of %s without its secret", got.body, alert.Identifier)
+		}
+	}
+
+	alert.WebhookSecret = ""
+	if err := notifier.Notify(context.Background(), alert); err != nil {
+		t.Fatalf("notify without secret: %v", err)
+	}
+	got := <-deliveries
+	for _, header := range []string{WebhookTimestampHeader, WebhookNonceHeader, WebhookSignatureHeader} {
+		if value := got.header.Get(header); value != "" {
+			t.Errorf("alert without secret has header %s: %q", header, value)
+		}
+	}
+}
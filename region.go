@@ -0,0 +1,138 @@
+package meow
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// RegionsKey is the key of the set of regions probes were started in, which is
+// kept in the first shard.
+const RegionsKey = "meow:regions"
+
+// ValidateRegion returns an error if the name of the region is malformed. Like
+// label values, names consist of at most 63 alphanumeric characters, dashes,
+// underscores, and dots, and begin and end with an alphanumeric character.
+func ValidateRegion(region string) error {
+	if !labelNamePattern.MatchString(region) {
+		return fmt.Errorf(`region "%s" does not match pattern "%s"`, region, labelNamePatternRaw)
+	}
+	return nil
+}
+
+// CheckedFrom reports whether the endpoint is checked by probes in the region,
+// which is empty for probes not tagged with a region.
+func (e Endpoint) CheckedFrom(region string) bool {
+	return len(e.Regions) == 0 || slices.Contains(e.Regions, region)
+}
+
+// HoldRegionLease is like HoldLease, but for checking the endpoint from the
+// region, so that it is checked by one instance of the probe in each region.
+func HoldRegionLease(ctx context.Context, vk valkey.Client, identifier, region, owner string, ttl time.Duration) (held, acquired bool, err error) {
+	return holdLease(ctx, vk, RegionLeaseKey(identifier, region), owner, ttl)
+}
+
+// RegisterRegion adds the region to the set of regions probes were started in.
+func RegisterRegion(ctx context.Context, vk valkey.Client, region string) error {
+	if err := vk.Do(ctx, vk.B().Sadd().Key(RegionsKey).Member(region).Build()).Error(); err != nil {
+		return fmt.Errorf("register region %s: %v", region, err)
+	}
+	return nil
+}
+
+// RegionState is the outcome of the last check of an endpoint from a region.
+type RegionState struct {
+	State         string        `json:"state"`
+	CheckedAt     time.Time     `json:"checked_at"`
+	FailureReason FailureReason `json:"failure_reason,omitempty"`
+}
+
+// RecordRegionState writes the outcome of the check of the endpoint with
+// identifier from the region. The outcome expires after ttl, so that regions
+// no longer checking the endpoint drop out of the aggregated state.
+func RecordRegionState(ctx context.Context, vk valkey.Client, identifier, region string, state RegionState, ttl time.Duration) error {
+	for _, result := range vk.DoMulti(ctx, regionStateCommands(vk, identifier, region, state, ttl)...) {
+		if err := result.Error(); err != nil {
+			return fmt.Errorf("record state of %s in region %s: %v", identifier, region, err)
+		}
+	}
+	return nil
+}
+
+func regionStateCommands(vk valkey.Client, identifier, region string, state RegionState, ttl time.Duration) valkey.Commands {
+	key := RegionStateKey(identifier, region)
+	return valkey.Commands{
+		vk.B().Hset().Key(key).FieldValue().
+			FieldValue(StateFieldState, state.State).
+			FieldValue(StateFieldCheckedAt, state.CheckedAt.Format(time.RFC3339Nano)).
+			FieldValue(StateFieldFailureReason, string(state.FailureReason)).Build(),
+		vk.B().Pexpire().Key(key).Milliseconds(ttl.Milliseconds()).Build(),
+	}
+}
+
+// RecordRegionState buffers the writes of RecordRegionState.
+func (b *StateBatch) RecordRegionState(ctx context.Context, identifier, region string, state RegionState, ttl time.Duration) error {
+	vk := b.shards.For(identifier)
+	return b.add(ctx, identifier, regionStateCommands(vk, identifier, region, state, ttl)...)
+}
+
+// RegionStates returns the outcomes of the last checks of the endpoint with
+// identifier by region, for all regions probes were started in which checked
+// it recently.
+func RegionStates(ctx context.Context, shards *Shards, identifier string) (map[string]RegionState, error) {
+	first := shards.All()[0]
+	regions, err := first.Do(ctx, first.B().Smembers().Key(RegionsKey).Build()).AsStrSlice()
+	if err != nil {
+		return nil, fmt.Errorf("get regions: %v", err)
+	}
+	states := make(map[string]RegionState, len(regions))
+	if len(regions) == 0 {
+		return states, nil
+	}
+	vk := shards.For(identifier)
+	cmds := make(valkey.Commands, 0, len(regions))
+	for _, region := range regions {
+		cmds = append(cmds, vk.B().Hgetall().Key(RegionStateKey(identifier, region)).Build())
+	}
+	for i, result := range vk.DoMulti(ctx, cmds...) {
+		kvs, err := result.AsStrMap()
+		if err != nil {
+			return nil, fmt.Errorf("get state of %s in region %s: %v", identifier, regions[i], err)
+		}
+		if kvs[StateFieldState] == "" {
+			continue
+		}
+		checkedAt, _ := time.Parse(time.RFC3339Nano, kvs[StateFieldCheckedAt])
+		states[regions[i]] = RegionState{
+			State:         kvs[StateFieldState],
+			CheckedAt:     checkedAt,
+			FailureReason: FailureReason(kvs[StateFieldFailureReason]),
+		}
+	}
+	return states, nil
+}
+
+// AggregateRegionStates returns the state of an endpoint across the regions
+// checking it: StateUp if it is up in all of them, StateDown if it is down in
+// all of them, StateDegraded if it is down or degraded in some, and
+// StateUnknown without any region.
+func AggregateRegionStates(states map[string]RegionState) string {
+	if len(states) == 0 {
+		return StateUnknown
+	}
+	counts := make(map[string]int)
+	for _, state := range states {
+		counts[state.State]++
+	}
+	switch {
+	case counts[StateUp] == len(states):
+		return StateUp
+	case counts[StateDown] == len(states):
+		return StateDown
+	default:
+		return StateDegraded
+	}
+}
@@ -0,0 +1,141 @@
+package meow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/valkey-io/valkey-go"
+)
+
+func TestRegionStatesAreScopedByRegion(t *testing.T) {
+	server := miniredis.RunT(t)
+	// miniredis does not support client-side caching
+	options := valkey.ClientOption{InitAddress: []string{server.Addr()}, DisableCache: true}
+	shards, err := NewShardsWithOptions(options, 2)
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	defer shards.Close()
+	ctx := context.Background()
+	at := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	if states, err := RegionStates(ctx, shards, "libvirt"); err != nil || len(states) > 0 {
+		t.Errorf("got states %v (%v) without regions, want none", states, err)
+	}
+	for _, region := range []string{"eu-central", "us-east", "ap-south"} {
+		if err := RegisterRegion(ctx, shards.All()[0], region); err != nil {
+			t.Fatal(err)
+		}
+	}
+	up := RegionState{State: StateUp, CheckedAt: at}
+	down := RegionState{State: StateDown, CheckedAt: at.Add(time.Second), FailureReason: ReasonTimeout}
+	records := []struct {
+		identifier, region string
+		state              RegionState
+		ttl                time.Duration
+	}{
+		{"libvirt", "eu-central", up, time.Minute},
+		{"libvirt", "us-east", down, 3 * time.Minute},
+		{"go-dev", "ap-south", down, time.Minute},
+	}
+	for _, record := range records {
+		vk := shards.For(record.identifier)
+		if err := RecordRegionState(ctx, vk, record.identifier, record.region, record.state, record.ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	states, err := RegionStates(ctx, shards, "libvirt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 || states["eu-central"] != up || states["us-east"] != down {
+		t.Errorf("got states %v of libvirt, want it up in eu-central and down in us-east only", states)
+	}
+
+	// regions no longer checking the endpoint drop out
+	server.FastForward(2 * time.Minute)
+	states, err = RegionStates(ctx, shards, "libvirt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states["us-east"] != down {
+		t.Errorf("got states %v of libvirt after eu-central stopped checking it, want it down in us-east only", states)
+	}
+}
+
+func TestAggregateRegionStates(t *testing.T) {
+	tests := []struct {
+		name   string
+		states []string
+		want   string
+	}{
+		{"no regions", nil, StateUnknown},
+		{"up everywhere", []string{StateUp, StateUp}, StateUp},
+		{"down everywhere", []string{StateDown, StateDown}, StateDown},
+		{"down somewhere", []string{StateUp, StateDown}, StateDegraded},
+		{"degraded somewhere", []string{StateUp, StateDegraded}, StateDegraded},
+		{"degraded in the only region", []string{StateDegraded}, StateDegraded},
+	}
+	regions := []string{"eu-central", "us-east"}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			states := make(map[string]RegionState)
+			for i, state := range test.states {
+				states[regions[i]] = RegionState{State: state}
+			}
+			if got := AggregateRegionStates(states); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEndpointCheckedFrom(t *testing.T) {
+	anywhere := Endpoint{Identifier: "libvirt"}
+	restricted := Endpoint{Identifier: "libvirt", Regions: []string{"eu-central", "us-east"}}
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		region   string
+		want     bool
+	}{
+		{"anywhere from region", anywhere, "ap-south", true},
+		{"anywhere without region", anywhere, "", true},
+		{"restricted from listed region", restricted, "us-east", true},
+		{"restricted from other region", restricted, "ap-south", false},
+		{"restricted without region", restricted, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.endpoint.CheckedFrom(test.region); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEndpointFromPayloadValidatesRegions(t *testing.T) {
+	payload := EndpointPayload{
+		Identifier:   "libvirt",
+		URL:          "https://libvirt.org/",
+		Method:       "GET",
+		StatusOnline: 200,
+		Frequency:    "1m",
+		FailAfter:    3,
+		Regions:      []string{"eu-central", "us east"},
+	}
+	_, err := EndpointFromPayload(payload)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "regions" {
+		t.Errorf("got error %v, want one about the regions", err)
+	}
+
+	payload.Regions = []string{"eu-central", "us-east"}
+	if _, err := EndpointFromPayload(payload); err != nil {
+		t.Errorf("got error %v for valid regions, want none", err)
+	}
+}
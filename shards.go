@@ -0,0 +1,198 @@
+package meow
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// Shards distributes endpoints across consecutive Valkey databases by a hash
+// of their identifier. A Valkey cluster, which distributes the keys by itself,
+// is used as a single shard.
+type Shards struct {
+	addr    string
+	clients []valkey.Client
+	dbs     []int
+}
+
+// NewShards connects to n databases of the Valkey server at addrs, starting at
+// database db. Multiple addresses refer to the nodes of a cluster, which only
+// supports a single shard in database 0; a single address is connected to as a
+// cluster if the server runs in cluster mode.
+func NewShards(addrs []string, db, n int) (*Shards, error) {
+	if len(addrs) > 1 && (db != 0 || n != 1) {
+		return nil, fmt.Errorf("a cluster only supports a single shard in db 0")
+	}
+	return NewShardsWithOptions(valkey.ClientOption{InitAddress: addrs, SelectDB: db}, n)
+}
+
+// NewShardsWithOptions is like NewShards, but connects using the client
+// options, starting at database options.SelectDB, e.g. to disable client-side
+// caching for servers not supporting it.
+func NewShardsWithOptions(options valkey.ClientOption, n int) (*Shards, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("need at least one shard, got %d", n)
+	}
+	addr := strings.Join(options.InitAddress, ",")
+	db := options.SelectDB
+	shards := &Shards{addr: addr}
+	for i := range n {
+		options.SelectDB = db + i
+		client, err := valkey.NewClient(options)
+		if err != nil {
+			shards.Close()
+			return nil, fmt.Errorf("connect to valkey at %s (db %d): %v", addr, db+i, err)
+		}
+		shards.clients = append(shards.clients, client)
+		shards.dbs = append(shards.dbs, db+i)
+	}
+	return shards, nil
+}
+
+// For returns the client of the shard holding the endpoint with identifier.
+func (s *Shards) For(identifier string) valkey.Client {
+	return s.clients[s.index(identifier)]
+}
+
+// All returns the clients of all shards.
+func (s *Shards) All() []valkey.Client {
+	return s.clients
+}
+
+// Wrap replaces the client of every shard by the one returned by wrap, e.g. to
+// trace the commands sent to Valkey.
+func (s *Shards) Wrap(wrap func(valkey.Client) valkey.Client) {
+	for i, client := range s.clients {
+		s.clients[i] = wrap(client)
+	}
+}
+
+// Keys returns the keys matching pattern of all shards, which are scanned
+// rather than blocking the server while matching all of them at once.
+func (s *Shards) Keys(ctx context.Context, pattern string) ([]string, error) {
+	all := make([]string, 0)
+	for i, client := range s.clients {
+		err := scanKeys(ctx, client, pattern, func(key string) bool {
+			all = append(all, key)
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("scan %s in db %d: %v", pattern, s.dbs[i], err)
+		}
+	}
+	return all, nil
+}
+
+// CountKeys counts the keys matching pattern of all shards like Keys, but
+// stops counting once limit keys were found, unless limit is 0.
+func (s *Shards) CountKeys(ctx context.Context, pattern string, limit int) (int, error) {
+	n := 0
+	for i, client := range s.clients {
+		err := scanKeys(ctx, client, pattern, func(key string) bool {
+			n++
+			return limit == 0 || n < limit
+		})
+		if err != nil {
+			return 0, fmt.Errorf("scan %s in db %d: %v", pattern, s.dbs[i], err)
+		}
+		if limit > 0 && n >= limit {
+			return n, nil
+		}
+	}
+	return n, nil
+}
+
+// Rebalance moves the keys starting with prefix, which belong to an endpoint
+// (see KeyIdentifier), to the shards they belong to, which is required after
+// changing the number of shards. The number of keys moved is returned, along
+// with the keys that could not be moved, since their shard already holds a key
+// of the same name, which is left as it is.
+func (s *Shards) Rebalance(ctx context.Context, prefix string) (int, []string, error) {
+	moved := 0
+	var conflicts []string
+	for i, client := range s.clients {
+		// the keys are moved once scanned, so that moving them does not
+		// interfere with scanning
+		var keys []string
+		err := scanKeys(ctx, client, prefix+"*", func(key string) bool {
+			keys = append(keys, key)
+			return true
+		})
+		if err != nil {
+			return moved, conflicts, fmt.Errorf("scan %s* in db %d: %v", prefix, s.dbs[i], err)
+		}
+		for _, key := range keys {
+			target := s.index(KeyIdentifier(key))
+			if target == i {
+				continue
+			}
+			cmd := client.B().Move().Key(key).Db(int64(s.dbs[target])).Build()
+			ok, err := client.Do(ctx, cmd).AsBool()
+			if err != nil {
+				return moved, conflicts, fmt.Errorf("move %s from db %d to %d: %v",
+					key, s.dbs[i], s.dbs[target], err)
+			}
+			if !ok {
+				conflicts = append(conflicts, key)
+				continue
+			}
+			moved++
+		}
+	}
+	return moved, conflicts, nil
+}
+
+// String returns the address and databases of the shards.
+func (s *Shards) String() string {
+	if len(s.dbs) == 1 {
+		return fmt.Sprintf("%s db=%d", s.addr, s.dbs[0])
+	}
+	return fmt.Sprintf("%s db=%d-%d", s.addr, s.dbs[0], s.dbs[len(s.dbs)-1])
+}
+
+// Close closes the clients of all shards.
+func (s *Shards) Close() {
+	for _, client := range s.clients {
+		client.Close()
+	}
+}
+
+// scanKeys passes the keys matching pattern from all nodes the client is
+// connected to, which are several for a cluster, to fn, until it returns false.
+// Every key is passed once, even though SCAN may return it several times.
+func scanKeys(ctx context.Context, client valkey.Client, pattern string, fn func(key string) bool) error {
+	seen := make(map[string]bool)
+	for _, node := range client.Nodes() {
+		var cursor uint64
+		for {
+			cmd := node.B().Scan().Cursor(cursor).Match(pattern).Count(100).Build()
+			entry, err := node.Do(ctx, cmd).AsScanEntry()
+			if err != nil {
+				return err
+			}
+			// replicas hold the same keys as their primaries
+			for _, key := range entry.Elements {
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				if !fn(key) {
+					return nil
+				}
+			}
+			if cursor = entry.Cursor; cursor == 0 {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Shards) index(identifier string) int {
+	h := fnv.New32a()
+	h.Write([]byte(identifier))
+	return int(h.Sum32() % uint32(len(s.clients)))
+}
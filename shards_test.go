@@ -0,0 +1,144 @@
+package meow
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/valkey-io/valkey-go"
+)
+
+func TestRebalanceReportsConflicts(t *testing.T) {
+	server := miniredis.RunT(t)
+	// miniredis does not support client-side caching
+	options := valkey.ClientOption{InitAddress: []string{server.Addr()}, DisableCache: true}
+	shards, err := NewShardsWithOptions(options, 2)
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	defer shards.Close()
+
+	// find endpoints belonging to the second shard, which were stored in the
+	// first one before the number of shards was increased
+	var misplaced []string
+	for _, identifier := range []string{"libvirt", "go-dev", "m346", "frickelbude", "canary", "gateway"} {
+		if shards.index(identifier) == 1 {
+			misplaced = append(misplaced, identifier)
+		}
+	}
+	if len(misplaced) < 2 {
+		t.Fatalf("need two endpoints of the second shard, got %v", misplaced)
+	}
+	moved, conflicting := misplaced[0], misplaced[1]
+	for _, identifier := range misplaced[:2] {
+		server.DB(0).HSet(EndpointKey(identifier), FieldIdentifier, identifier)
+	}
+	server.DB(1).HSet(EndpointKey(conflicting), FieldIdentifier, "newer")
+
+	n, conflicts, err := shards.Rebalance(context.Background(), "endpoints:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("moved %d keys, want 1", n)
+	}
+	if !slices.Equal(conflicts, []string{EndpointKey(conflicting)}) {
+		t.Errorf("got conflicts %v, want %s", conflicts, EndpointKey(conflicting))
+	}
+	if !server.DB(1).Exists(EndpointKey(moved)) || server.DB(0).Exists(EndpointKey(moved)) {
+		t.Errorf("%s was not moved to the second shard", EndpointKey(moved))
+	}
+	if got := server.DB(1).HGet(EndpointKey(conflicting), FieldIdentifier); got != "newer" {
+		t.Errorf("conflicting key in the second shard holds %q, want it left as it is", got)
+	}
+	if !server.DB(0).Exists(EndpointKey(conflicting)) {
+		t.Errorf("conflicting key %s was removed from the first shard", EndpointKey(conflicting))
+	}
+}
+
+func TestCountKeys(t *testing.T) {
+	server := miniredis.RunT(t)
+	// miniredis does not support client-side caching
+	options := valkey.ClientOption{InitAddress: []string{server.Addr()}, DisableCache: true}
+	shards, err := NewShardsWithOptions(options, 2)
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	defer shards.Close()
+
+	identifiers := []string{"libvirt", "go-dev", "m346", "frickelbude", "canary"}
+	for _, identifier := range identifiers {
+		server.DB(shards.index(identifier)).HSet(EndpointKey(identifier), FieldIdentifier, identifier)
+		server.DB(shards.index(identifier)).HSet(StateKey(identifier), StateFieldState, StateUp)
+	}
+	ctx := context.Background()
+	if n, err := shards.CountKeys(ctx, "endpoints:*", 0); err != nil || n != len(identifiers) {
+		t.Errorf("counted %d endpoints (%v), want %d", n, err, len(identifiers))
+	}
+	if n, err := shards.CountKeys(ctx, "endpoints:*", 3); err != nil || n < 3 || n > len(identifiers) {
+		t.Errorf("counted %d endpoints (%v) up to 3, want at least 3", n, err)
+	}
+	if n, err := shards.CountKeys(ctx, "groups:*", 3); err != nil || n != 0 {
+		t.Errorf("counted %d groups (%v), want none", n, err)
+	}
+}
+
+func TestKeysAndRebalanceScanBeyondOneBatch(t *testing.T) {
+	server := miniredis.RunT(t)
+	// miniredis does not support client-side caching
+	options := valkey.ClientOption{InitAddress: []string{server.Addr()}, DisableCache: true}
+	shards, err := NewShardsWithOptions(options, 2)
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	defer shards.Close()
+
+	// more endpoints than a single SCAN returns, all stored in the first shard
+	// before the number of shards was increased
+	var want []string
+	for i := range 250 {
+		identifier := fmt.Sprintf("endpoint-%d", i)
+		server.DB(0).HSet(EndpointKey(identifier), FieldIdentifier, identifier)
+		server.DB(0).HSet(StateKey(identifier), StateFieldState, StateUp)
+		want = append(want, EndpointKey(identifier))
+	}
+	slices.Sort(want)
+	ctx := context.Background()
+	keys := func() []string {
+		t.Helper()
+		got, err := shards.Keys(ctx, "endpoints:*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(got)
+		return got
+	}
+	if got := keys(); !slices.Equal(got, want) {
+		t.Errorf("got %d keys before rebalancing, want %d", len(got), len(want))
+	}
+
+	n, conflicts, err := shards.Rebalance(ctx, "endpoints:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) > 0 {
+		t.Errorf("got conflicts %v, want none", conflicts)
+	}
+	if n != len(server.DB(1).Keys()) || n == 0 {
+		t.Errorf("moved %d keys, but the second shard holds %d", n, len(server.DB(1).Keys()))
+	}
+	for _, key := range want {
+		target := shards.index(KeyIdentifier(key))
+		if !server.DB(target).Exists(key) || server.DB(1-target).Exists(key) {
+			t.Errorf("%s is not only in shard %d", key, target)
+		}
+	}
+	if got := keys(); !slices.Equal(got, want) {
+		t.Errorf("got %d keys after rebalancing, want %d", len(got), len(want))
+	}
+	if n, err := shards.CountKeys(ctx, "state:*", 0); err != nil || n != len(want) {
+		t.Errorf("counted %d states (%v), want them left in place", n, err)
+	}
+}
@@ -0,0 +1,177 @@
+package meow
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// SMTPServer sends emails through an SMTP server.
+type SMTPServer struct {
+	// Addr is the host and port of the server, e.g. mail.example.com:587.
+	Addr string
+
+	// Username and Password authenticate with the server, unless empty.
+	Username string
+	Password string
+
+	// From is the sender address of the emails.
+	From string
+}
+
+// SMTPServerFromEnv returns the SMTP server configured by the environment
+// variables SMTP_ADDR, SMTP_USERNAME, SMTP_PASSWORD, and SMTP_FROM, or nil if
+// SMTP_ADDR is not set.
+func SMTPServerFromEnv() (*SMTPServer, error) {
+	addr := strings.TrimSpace(os.Getenv("SMTP_ADDR"))
+	if addr == "" {
+		return nil, nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("SMTP_ADDR must be host:port, got %q: %v", addr, err)
+	}
+	from := strings.TrimSpace(os.Getenv("SMTP_FROM"))
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("SMTP_FROM must be an email address, got %q: %v", from, err)
+	}
+	return &SMTPServer{
+		Addr:     addr,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}, nil
+}
+
+// SendAlert sends the alert by email to the recipients, a comma-separated list
+// of addresses. The connection is upgraded using STARTTLS if the server
+// supports it.
+func (s *SMTPServer) SendAlert(ctx context.Context, recipients string, alert Alert) error {
+	to, err := mail.ParseAddressList(recipients)
+	if err != nil {
+		return fmt.Errorf("parse recipients %q: %v", recipients, err)
+	}
+	msg, err := s.alertMessage(to, alert)
+	if err != nil {
+		return fmt.Errorf("compose message: %v", err)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("dial %s: %v", s.Addr, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+	}
+	host, _, _ := net.SplitHostPort(s.Addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return fmt.Errorf("connect to %s: %v", s.Addr, err)
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("starttls: %v", err)
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return fmt.Errorf("authenticate as %s: %v", s.Username, err)
+		}
+	}
+	if err := client.Mail(s.From); err != nil {
+		return fmt.Errorf("mail from %s: %v", s.From, err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt.Address); err != nil {
+			return fmt.Errorf("rcpt to %s: %v", rcpt.Address, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("data: %v", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("write message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("send message: %v", err)
+	}
+	return client.Quit()
+}
+
+// alertMessage composes an email about the alert with both a plain text and
+// an HTML body.
+func (s *SMTPServer) alertMessage(to []*mail.Address, alert Alert) ([]byte, error) {
+	details := [][2]string{
+		{"Endpoint", alert.Identifier},
+		{"State", alert.State},
+		{"At", alert.At.Format(time.RFC1123Z)},
+	}
+	if alert.Status != 0 {
+		details = append(details, [2]string{"Status", fmt.Sprint(alert.Status)})
+	}
+	if alert.Error != "" {
+		details = append(details, [2]string{"Error", alert.Error})
+	}
+	var text, htm strings.Builder
+	fmt.Fprintf(&text, "%s\n\n", alert.Message)
+	fmt.Fprintf(&htm, "<p>%s</p>\n<table>\n", html.EscapeString(alert.Message))
+	for _, detail := range details {
+		fmt.Fprintf(&text, "%s: %s\n", detail[0], detail[1])
+		fmt.Fprintf(&htm, "<tr><th align=\"left\">%s</th><td>%s</td></tr>\n",
+			html.EscapeString(detail[0]), html.EscapeString(detail[1]))
+	}
+	htm.WriteString("</table>\n")
+
+	recipients := make([]string, 0, len(to))
+	for _, rcpt := range to {
+		recipients = append(recipients, rcpt.String())
+	}
+	var buf bytes.Buffer
+	body := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %s\r\n", s.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "[meow] "+alert.Message))
+	fmt.Fprintf(&buf, "Date: %s\r\n", alert.At.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", body.Boundary())
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", text.String()},
+		{"text/html; charset=utf-8", htm.String()},
+	} {
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,179 @@
+package meow
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSession is what a fakeSMTPServer received from a client.
+type smtpSession struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTPServer accepts a single SMTP session on a local port, which it
+// reports once the client quit.
+type fakeSMTPServer struct {
+	listener net.Listener
+	sessions chan smtpSession
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	s := &fakeSMTPServer{listener: listener, sessions: make(chan smtpSession, 1)}
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	var session smtpSession
+	reply("220 localhost ESMTP fake")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			_, credentials, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(credentials)
+			session.auth = string(decoded)
+			reply("235 authenticated")
+		case "MAIL":
+			session.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			reply("250 ok")
+		case "RCPT":
+			session.to = append(session.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			session.data = data.String()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			s.sessions <- session
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPServerSendsAlert(t *testing.T) {
+	fake := newFakeSMTPServer(t)
+	server := &SMTPServer{
+		Addr:     fake.listener.Addr().String(),
+		Username: "meow",
+		Password: "s3cr3t",
+		From:     "meow@example.com",
+	}
+	alert := Alert{
+		Identifier: "libvirt",
+		State:      StateDown,
+		At:         time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC),
+		Message:    "libvirt is offline <3 failed attempts>",
+		Status:     503,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.SendAlert(ctx, "Ops <ops@example.com>, dev@example.com", alert); err != nil {
+		t.Fatalf("send alert: %v", err)
+	}
+
+	session := <-fake.sessions
+	if session.auth != "\x00meow\x00s3cr3t" {
+		t.Errorf("got credentials %q, want those of meow", session.auth)
+	}
+	if session.from != "meow@example.com" {
+		t.Errorf("got sender %q, want %q", session.from, "meow@example.com")
+	}
+	if want := []string{"ops@example.com", "dev@example.com"}; !slices.Equal(session.to, want) {
+		t.Errorf("got recipients %v, want %v", session.to, want)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(session.data))
+	if err != nil {
+		t.Fatalf("read message %q: %v", session.data, err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "[meow] "+alert.Message {
+		t.Errorf("got subject %q (%v), want %q", subject, err, "[meow] "+alert.Message)
+	}
+	if to := msg.Header.Get("To"); to != `"Ops" <ops@example.com>, <dev@example.com>` {
+		t.Errorf("got To header %q", to)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("got content type %q (%v), want multipart/alternative", msg.Header.Get("Content-Type"), err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	want := map[string]string{
+		"text/plain": "Status: 503",
+		"text/html":  "<p>libvirt is offline &lt;3 failed attempts&gt;</p>",
+	}
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		// the quoted-printable encoding is undone by NextPart
+		content, _ := io.ReadAll(part)
+		if !strings.Contains(string(content), want[contentType]) {
+			t.Errorf("%s part %q lacks %q", contentType, content, want[contentType])
+		}
+		delete(want, contentType)
+	}
+	for contentType := range want {
+		t.Errorf("message lacks %s part", contentType)
+	}
+}
+
+func TestEmailNotifierFailsWithoutSMTPServer(t *testing.T) {
+	notifier := &EmailNotifier{Recipients: "ops@example.com"}
+	if err := notifier.Notify(context.Background(), Alert{Identifier: "libvirt"}); err == nil {
+		t.Error("got no error, want one about the missing SMTP server")
+	}
+}
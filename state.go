@@ -0,0 +1,257 @@
+package meow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// States of an endpoint as determined by probing it.
+const (
+	StateUnknown = "unknown"
+	StateUp      = "up"
+	StateDown    = "down"
+
+	// StateDegraded is the state of endpoints responding with a status
+	// classified as degraded, e.g. 429 when being rate limited.
+	StateDegraded = "degraded"
+
+	StatePaused  = "paused"
+	StateBlocked = "blocked"
+
+	// StatePausedOffHours is the state of endpoints outside of their check
+	// window, during which they are not checked.
+	StatePausedOffHours = "paused-offhours"
+)
+
+// StateChannel is the Valkey pub/sub channel state changes are published on.
+const StateChannel = "meow:states"
+
+// StateChange indicates that an endpoint changed its state.
+type StateChange struct {
+	Identifier string    `json:"identifier"`
+	State      string    `json:"state"`
+	Previous   string    `json:"previous"`
+	At         time.Time `json:"at"`
+}
+
+// RecordStateChange stores the new state of the endpoint and publishes the
+// state change on the StateChannel.
+func RecordStateChange(ctx context.Context, vk valkey.Client, change StateChange) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("marshal state change %v: %v", change, err)
+	}
+	key := StateKey(change.Identifier)
+	cmds := valkey.Commands{
+		vk.B().Multi().Build(),
+		vk.B().Hset().Key(key).FieldValue().
+			FieldValue(StateFieldState, change.State).
+			FieldValue(StateFieldSince, change.At.Format(time.RFC3339Nano)).Build(),
+		vk.B().Publish().Channel(StateChannel).Message(string(data)).Build(),
+		vk.B().Exec().Build(),
+	}
+	for _, result := range vk.DoMulti(ctx, cmds...) {
+		if err := result.Error(); err != nil {
+			return fmt.Errorf("record state change of %s: %v", change.Identifier, err)
+		}
+	}
+	return nil
+}
+
+// updateUnlessReset sets the field-value pairs ARGV[3..2+2*ARGV[2]] of the
+// hash KEYS[1], and deletes the fields following them, unless the hash was
+// reset after ARGV[1] (see StateFieldResetAt). It returns 1 if it updated the
+// hash, and 0 otherwise.
+var updateUnlessReset = `
+local resetAt = tonumber(redis.call("HGET", KEYS[1], "` + StateFieldResetAt + `") or "0")
+if resetAt > tonumber(ARGV[1]) then
+	return 0
+end
+local n = tonumber(ARGV[2])
+if n > 0 then
+	redis.call("HSET", KEYS[1], unpack(ARGV, 3, 2 + 2 * n))
+end
+if #ARGV > 2 + 2 * n then
+	redis.call("HDEL", KEYS[1], unpack(ARGV, 3 + 2 * n))
+end
+return 1
+`
+
+// stateUpdateCommand returns the command setting the fields of the state of
+// the endpoint with identifier to the values given as field-value pairs, and
+// deleting the fields del, unless its state was reset after the check at the
+// given time, e.g. while the write was buffered.
+func stateUpdateCommand(vk valkey.Client, identifier string, at time.Time, set []string, del ...string) valkey.Completed {
+	args := []string{strconv.FormatInt(at.UnixMicro(), 10), strconv.Itoa(len(set) / 2)}
+	args = append(append(args, set...), del...)
+	return vk.B().Eval().Script(updateUnlessReset).Numkeys(1).Key(StateKey(identifier)).Arg(args...).Build()
+}
+
+// RecordConsecutiveFailures stores the number of consecutive failed checks of
+// the endpoint with identifier, so that another instance of the probe taking
+// over the checks can continue from it, along with the reason the last of them,
+// which was completed at the given time, failed for. The reason is removed once
+// there are no failed checks. Nothing is stored if the state was reset after
+// the check.
+func RecordConsecutiveFailures(ctx context.Context, vk valkey.Client, identifier string, at time.Time, failures int, reason FailureReason) error {
+	if err := vk.Do(ctx, consecutiveFailuresCommand(vk, identifier, at, failures, reason)).Error(); err != nil {
+		return fmt.Errorf("record consecutive failures of %s: %v", identifier, err)
+	}
+	return nil
+}
+
+func consecutiveFailuresCommand(vk valkey.Client, identifier string, at time.Time, failures int, reason FailureReason) valkey.Completed {
+	if failures == 0 {
+		return stateUpdateCommand(vk, identifier, at, []string{StateFieldConsecutiveFailures, "0"}, StateFieldFailureReason)
+	}
+	return stateUpdateCommand(vk, identifier, at, []string{
+		StateFieldConsecutiveFailures, strconv.Itoa(failures),
+		StateFieldFailureReason, string(reason),
+	})
+}
+
+// ResetState sets the state of the endpoint with identifier to StateUnknown,
+// and zeroes its consecutive failed checks, so that it is evaluated afresh.
+// The lease on checking the endpoint is deleted, which makes the probe holding
+// it reload the state, and the consecutive failed checks and alerts of checks
+// before the reset, whose writes the probe may still buffer, are no longer
+// recorded. The state change is published on the StateChannel.
+func ResetState(ctx context.Context, vk valkey.Client, identifier string, at time.Time) error {
+	key := StateKey(identifier)
+	previous, err := vk.Do(ctx, vk.B().Hget().Key(key).Field(StateFieldState).Build()).ToString()
+	if valkey.IsValkeyNil(err) {
+		previous = StateUnknown
+	} else if err != nil {
+		return fmt.Errorf("get state of %s: %v", identifier, err)
+	}
+	cmds, err := resetStateCommands(vk, identifier, previous, at)
+	if err != nil {
+		return err
+	}
+	for _, result := range vk.DoMulti(ctx, cmds...) {
+		if err := result.Error(); err != nil {
+			return fmt.Errorf("reset state of %s: %v", identifier, err)
+		}
+	}
+	return nil
+}
+
+// ResetStates resets the states of the endpoints with the given identifiers
+// like ResetState, but using a pipeline per shard to read the states, and
+// sending the transactions resetting them concurrently, which the client
+// pipelines, rather than two round trips per endpoint. The transactions are
+// not sent in a single pipeline, since a cluster client rejects pipelines of
+// transactions on keys belonging to different slots.
+func ResetStates(ctx context.Context, shards *Shards, identifiers []string, at time.Time) error {
+	byClient := make(map[valkey.Client][]string)
+	for _, identifier := range identifiers {
+		vk := shards.For(identifier)
+		byClient[vk] = append(byClient[vk], identifier)
+	}
+	for vk, ids := range byClient {
+		gets := make(valkey.Commands, 0, len(ids))
+		for _, id := range ids {
+			gets = append(gets, vk.B().Hget().Key(StateKey(id)).Field(StateFieldState).Build())
+		}
+		resets := make([]valkey.Commands, len(ids))
+		for i, result := range vk.DoMulti(ctx, gets...) {
+			previous, err := result.ToString()
+			if valkey.IsValkeyNil(err) {
+				previous = StateUnknown
+			} else if err != nil {
+				return fmt.Errorf("get state of %s: %v", ids[i], err)
+			}
+			if resets[i], err = resetStateCommands(vk, ids[i], previous, at); err != nil {
+				return err
+			}
+		}
+		errs := make([]error, len(ids))
+		var wg sync.WaitGroup
+		for i, cmds := range resets {
+			wg.Go(func() {
+				for _, result := range vk.DoMulti(ctx, cmds...) {
+					if err := result.Error(); err != nil {
+						errs[i] = fmt.Errorf("reset state of %s: %v", ids[i], err)
+						return
+					}
+				}
+			})
+		}
+		wg.Wait()
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetStateCommands returns the transaction resetting the state of the
+// endpoint with identifier, which was previous.
+func resetStateCommands(vk valkey.Client, identifier, previous string, at time.Time) (valkey.Commands, error) {
+	key := StateKey(identifier)
+	change := StateChange{Identifier: identifier, State: StateUnknown, Previous: previous, At: at}
+	data, err := json.Marshal(change)
+	if err != nil {
+		return nil, fmt.Errorf("marshal state change %v: %v", change, err)
+	}
+	return valkey.Commands{
+		vk.B().Multi().Build(),
+		vk.B().Hset().Key(key).FieldValue().
+			FieldValue(StateFieldState, StateUnknown).
+			FieldValue(StateFieldSince, at.Format(time.RFC3339Nano)).
+			FieldValue(StateFieldConsecutiveFailures, "0").
+			FieldValue(StateFieldResetAt, strconv.FormatInt(at.UnixMicro(), 10)).Build(),
+		vk.B().Hdel().Key(key).Field(StateFieldLastAlerted, StateFieldFailureReason).Build(),
+		vk.B().Del().Key(LeaseKey(identifier)).Build(),
+		vk.B().Publish().Channel(StateChannel).Message(string(data)).Build(),
+		vk.B().Exec().Build(),
+	}, nil
+}
+
+// RecordFlapping stores whether the endpoint with identifier is flapping, i.e.
+// changing its state too often to be alerted about.
+func RecordFlapping(ctx context.Context, vk valkey.Client, identifier string, flapping bool) error {
+	if err := vk.Do(ctx, flappingCommand(vk, identifier, flapping)).Error(); err != nil {
+		return fmt.Errorf("record flapping of %s: %v", identifier, err)
+	}
+	return nil
+}
+
+func flappingCommand(vk valkey.Client, identifier string, flapping bool) valkey.Completed {
+	key := StateKey(identifier)
+	return vk.B().Hset().Key(key).FieldValue().FieldValue(StateFieldFlapping, strconv.FormatBool(flapping)).Build()
+}
+
+// RecordServingStatus stores the serving status the endpoint with identifier,
+// which is checked using the gRPC health protocol, responded with last.
+func RecordServingStatus(ctx context.Context, vk valkey.Client, identifier string, status string) error {
+	if err := vk.Do(ctx, servingStatusCommand(vk, identifier, status)).Error(); err != nil {
+		return fmt.Errorf("record serving status of %s: %v", identifier, err)
+	}
+	return nil
+}
+
+func servingStatusCommand(vk valkey.Client, identifier string, status string) valkey.Completed {
+	key := StateKey(identifier)
+	return vk.B().Hset().Key(key).FieldValue().FieldValue(StateFieldServingStatus, status).Build()
+}
+
+// RecordAlert stores when an alert about the endpoint with identifier was
+// raised last, unless its state was reset after that.
+func RecordAlert(ctx context.Context, vk valkey.Client, identifier string, at time.Time) error {
+	if err := vk.Do(ctx, alertCommand(vk, identifier, at)).Error(); err != nil {
+		return fmt.Errorf("record alert of %s: %v", identifier, err)
+	}
+	return nil
+}
+
+func alertCommand(vk valkey.Client, identifier string, at time.Time) valkey.Completed {
+	return stateUpdateCommand(vk, identifier, at, []string{StateFieldLastAlerted, at.Format(time.RFC3339Nano)})
+}
@@ -0,0 +1,112 @@
+package meow
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var templateVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// IsURLTemplate reports whether rawURL refers to variables like ${REGION}.
+func IsURLTemplate(rawURL string) bool {
+	return templateVarPattern.MatchString(rawURL)
+}
+
+// ExpandURLTemplate replaces the ${NAME} references in template by the values
+// returned from lookup and parses the resulting URL. A variable unknown to
+// lookup causes an error rather than an incomplete URL.
+func ExpandURLTemplate(template string, lookup func(string) (string, bool)) (*url.URL, error) {
+	var undefined []string
+	expanded := templateVarPattern.ReplaceAllStringFunc(template, func(ref string) string {
+		name := templateVarPattern.FindStringSubmatch(ref)[1]
+		value, ok := lookup(name)
+		if !ok {
+			undefined = append(undefined, name)
+		}
+		return value
+	})
+	if len(undefined) > 0 {
+		return nil, fmt.Errorf(`URL template "%s" refers to undefined variables %v`,
+			template, undefined)
+	}
+	parsedURL, err := url.Parse(expanded)
+	if err != nil {
+		return nil, fmt.Errorf(`parse expanded URL "%s": %v`, expanded, err)
+	}
+	return parsedURL, nil
+}
+
+// parseURL parses rawURL, which may be a template. The variables of a template
+// are substituted by their names for the sake of validation, and the template
+// itself is returned alongside the URL.
+func parseURL(rawURL string) (*url.URL, string, error) {
+	if !IsURLTemplate(rawURL) {
+		parsedURL, err := url.Parse(rawURL)
+		return parsedURL, "", err
+	}
+	parsedURL, err := ExpandURLTemplate(rawURL, func(name string) (string, bool) {
+		return name, true
+	})
+	return parsedURL, rawURL, err
+}
+
+var queryTokenPattern = regexp.MustCompile(`\{\{([a-z0-9_]+)\}\}`)
+
+// queryTokens render the tokens query parameters may refer to like
+// {{now_unix}}, e.g. to bust caches, when an endpoint is requested at the given
+// time.
+var queryTokens = map[string]func(time.Time) string{
+	"now_unix":    func(t time.Time) string { return strconv.FormatInt(t.Unix(), 10) },
+	"now_unix_ms": func(t time.Time) string { return strconv.FormatInt(t.UnixMilli(), 10) },
+	"now_rfc3339": func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+	"random":      func(time.Time) string { return rand.Text() },
+}
+
+// validateQueryParam returns an error if the value of a query parameter refers
+// to unknown tokens, or contains braces that are not part of a token.
+func validateQueryParam(name, value string) error {
+	if name == "" {
+		return fmt.Errorf("query parameter without name")
+	}
+	for _, match := range queryTokenPattern.FindAllStringSubmatch(value, -1) {
+		if _, ok := queryTokens[match[1]]; !ok {
+			return fmt.Errorf(`query parameter "%s" refers to unknown token {{%s}}`, name, match[1])
+		}
+	}
+	if rest := queryTokenPattern.ReplaceAllString(value, ""); strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+		return fmt.Errorf(`query parameter "%s" has a malformed token in "%s"`, name, value)
+	}
+	return nil
+}
+
+// RenderQueryParams adds the query parameters to u, replacing parameters of
+// the same name, with their tokens rendered for a request at the given time.
+func RenderQueryParams(u *url.URL, params map[string]string, at time.Time) *url.URL {
+	if len(params) == 0 {
+		return u
+	}
+	rendered := *u
+	query := rendered.Query()
+	for name, value := range params {
+		query.Set(name, RenderQueryParam(value, at))
+	}
+	rendered.RawQuery = query.Encode()
+	return &rendered
+}
+
+// RenderQueryParam renders the tokens of a query parameter's value for a
+// request at the given time.
+func RenderQueryParam(value string, at time.Time) string {
+	return queryTokenPattern.ReplaceAllStringFunc(value, func(token string) string {
+		render, ok := queryTokens[queryTokenPattern.FindStringSubmatch(token)[1]]
+		if !ok {
+			return token
+		}
+		return render(at)
+	})
+}
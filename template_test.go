@@ -0,0 +1,63 @@
+package meow
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRenderQueryParams(t *testing.T) {
+	at := time.Date(2026, 10, 15, 12, 0, 0, 250_000_000, time.FixedZone("CEST", 2*60*60))
+	u, err := url.Parse("https://libvirt.org/status?cb=old&lang=en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]string{
+		"cb":   "{{now_unix}}",
+		"ms":   "t{{now_unix_ms}}",
+		"when": "{{now_rfc3339}}",
+		"kind": "probe",
+	}
+	rendered := RenderQueryParams(u, params, at)
+	want := "https://libvirt.org/status?cb=1792058400&kind=probe&lang=en&ms=t1792058400250&when=2026-10-15T10%3A00%3A00Z"
+	if rendered.String() != want {
+		t.Errorf("got URL %s, want %s", rendered, want)
+	}
+	if u.RawQuery != "cb=old&lang=en" {
+		t.Errorf("URL rendered was modified to %s", u)
+	}
+
+	random := map[string]string{"r": "{{random}}"}
+	first, second := RenderQueryParams(u, random, at), RenderQueryParams(u, random, at)
+	if first.Query().Get("r") == "" || first.Query().Get("r") == second.Query().Get("r") {
+		t.Errorf("got random values %q and %q, want distinct ones", first.Query().Get("r"), second.Query().Get("r"))
+	}
+	if RenderQueryParams(u, nil, at) != u {
+		t.Error("URL without query parameters was copied")
+	}
+}
+
+func TestValidateQueryParam(t *testing.T) {
+	tests := []struct {
+		name, value string
+		valid       bool
+	}{
+		{"cb", "{{now_unix}}", true},
+		{"cb", "v1-{{now_unix_ms}}-{{random}}", true},
+		{"cb", "{{now_rfc3339}}", true},
+		{"cb", "plain", true},
+		{"", "plain", false},
+		{"cb", "{{tomorrow}}", false},
+		{"cb", "{{now_unix}", false},
+		{"cb", "}}{{", false},
+	}
+	for _, test := range tests {
+		err := validateQueryParam(test.name, test.value)
+		if test.valid && err != nil {
+			t.Errorf("%s=%s: got error %v, want none", test.name, test.value, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s=%s: got no error", test.name, test.value)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package meow
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ShardsFromEnv connects to the shards configured by the environment
+// variables VALKEY_URL, which lists the nodes of a cluster separated by commas,
+// and VALKEY_SHARDS, which defaults to a single shard.
+func ShardsFromEnv() (*Shards, error) {
+	rawValkeyURL, ok := os.LookupEnv("VALKEY_URL")
+	if !ok || strings.TrimSpace(rawValkeyURL) == "" {
+		return nil, fmt.Errorf("environment variable VALKEY_URL must be set (example: valkey.frickelcloud.ch:6379/4)")
+	}
+	var addrs []string
+	db := 0
+	for i, rawNodeURL := range strings.Split(rawValkeyURL, ",") {
+		addr, nodeDB, err := ParseValkeyURL(rawNodeURL)
+		if err != nil {
+			return nil, fmt.Errorf("parse VALKEY_URL %q: %v", rawValkeyURL, err)
+		}
+		if i > 0 && nodeDB != db {
+			return nil, fmt.Errorf("VALKEY_URL %q refers to different databases", rawValkeyURL)
+		}
+		addrs = append(addrs, addr)
+		db = nodeDB
+	}
+	n := 1
+	if rawShards, ok := os.LookupEnv("VALKEY_SHARDS"); ok {
+		var err error
+		n, err = strconv.Atoi(rawShards)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("VALKEY_SHARDS must be a positive number, got %q", rawShards)
+		}
+	}
+	return NewShards(addrs, db, n)
+}
+
+// ParseValkeyURL parses the address and database number from a URL like
+// valkey://localhost:6379/4, whose scheme, port, and database are optional.
+func ParseValkeyURL(raw string) (addr string, db int, err error) {
+	raw = strings.TrimSpace(raw)
+
+	// Strip scheme if present
+	raw = strings.TrimPrefix(raw, "redis://")
+	raw = strings.TrimPrefix(raw, "valkey://")
+
+	db = 0
+
+	// Extract db from trailing /<number>; the address never contains a slash
+	raw, dbStr, _ := strings.Cut(raw, "/")
+	if dbStr != "" {
+		db, err = strconv.Atoi(dbStr)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid DB number in VALKEY_URL: %v", err)
+		}
+		if db < 0 {
+			return "", 0, fmt.Errorf("negative DB number %d in VALKEY_URL", db)
+		}
+	}
+
+	// Split host and optional port; IPv6 addresses are either enclosed in
+	// brackets, or cannot have a port
+	var host, port string
+	switch {
+	case strings.HasPrefix(raw, "["):
+		end := strings.Index(raw, "]")
+		if end < 0 {
+			return "", 0, fmt.Errorf(`missing "]" in address %q`, raw)
+		}
+		host = raw[1:end]
+		if rest := raw[end+1:]; rest != "" {
+			var ok bool
+			if port, ok = strings.CutPrefix(rest, ":"); !ok {
+				return "", 0, fmt.Errorf("unexpected %q after address %q", rest, raw[:end+1])
+			}
+		}
+	case strings.Count(raw, ":") > 1:
+		host = raw
+	default:
+		host, port, _ = strings.Cut(raw, ":")
+	}
+
+	if host == "" {
+		return "", 0, fmt.Errorf("missing host in VALKEY_URL")
+	}
+
+	// Ensure host:port
+	if port == "" {
+		port = "6379"
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", 0, fmt.Errorf("invalid port %q in VALKEY_URL", port)
+	}
+
+	return net.JoinHostPort(host, port), db, nil
+}
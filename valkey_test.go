@@ -0,0 +1,53 @@
+package meow
+
+import "testing"
+
+func TestParseValkeyURL(t *testing.T) {
+	tests := []struct {
+		raw   string
+		addr  string
+		db    int
+		valid bool
+	}{
+		{"localhost", "localhost:6379", 0, true},
+		{"localhost:6380", "localhost:6380", 0, true},
+		{"valkey://localhost:6379/4", "localhost:6379", 4, true},
+		{"redis://valkey.frickelcloud.ch/2", "valkey.frickelcloud.ch:6379", 2, true},
+		{"[::1]", "[::1]:6379", 0, true},
+		{"[::1]:6379", "[::1]:6379", 0, true},
+		{"[2001:db8::1]:6379/3", "[2001:db8::1]:6379", 3, true},
+		{"valkey://[::1]/1", "[::1]:6379", 1, true},
+		{"::1", "[::1]:6379", 0, true},
+		{"[::1", "", 0, false},
+		{"[::1]6379", "", 0, false},
+		{"[::1]:port", "", 0, false},
+		{"[]:6379", "", 0, false},
+		{"", "", 0, false},
+		{"   ", "", 0, false},
+		{"/4", "", 0, false},
+		{"valkey://", "", 0, false},
+		{":6379", "", 0, false},
+		{"localhost:", "localhost:6379", 0, true},
+		{"localhost:65536", "", 0, false},
+		{"localhost:-1", "", 0, false},
+		{"localhost/db", "", 0, false},
+		{"localhost/-1", "", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			addr, db, err := ParseValkeyURL(test.raw)
+			if test.valid && err != nil {
+				t.Fatalf("got error %v, want none", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatalf("got address %q and db %d, want an error", addr, db)
+			}
+			if addr != test.addr {
+				t.Errorf("got address %q, want %q", addr, test.addr)
+			}
+			if db != test.db {
+				t.Errorf("got db %d, want %d", db, test.db)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package meow
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a recurring time range on some days of the week, e.g. every Sunday
+// from 02:00 to 04:00 in Europe/Zurich. A window ending before it starts spans
+// midnight and ends on the day after.
+type Window struct {
+	// Days lists the days of the week the window starts on, abbreviated like
+	// mon, tue, or sun. The window recurs every day if empty.
+	Days []string `json:"days,omitempty"`
+
+	// Start and End are the times of day in the format 15:04.
+	Start string `json:"start"`
+	End   string `json:"end"`
+
+	// Timezone is the name of the timezone in the tz database the times refer
+	// to, e.g. Europe/Zurich, which defaults to UTC.
+	Timezone string `json:"timezone,omitempty"`
+
+	days       [7]bool
+	start, end int
+	location   *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// compile validates the window and returns a copy of it that can be matched
+// against points in time.
+func (w Window) compile() (Window, error) {
+	if len(w.Days) == 0 {
+		for i := range w.days {
+			w.days[i] = true
+		}
+	}
+	for _, day := range w.Days {
+		weekday, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return w, fmt.Errorf(`"%s" is not a day of the week (use mon, tue, …, sun)`, day)
+		}
+		w.days[weekday] = true
+	}
+	var err error
+	if w.start, err = minuteOfDay(w.Start); err != nil {
+		return w, fmt.Errorf("start: %v", err)
+	}
+	if w.end, err = minuteOfDay(w.End); err != nil {
+		return w, fmt.Errorf("end: %v", err)
+	}
+	if w.start == w.end {
+		return w, fmt.Errorf("window from %s to %s is empty", w.Start, w.End)
+	}
+	if w.location, err = time.LoadLocation(w.Timezone); err != nil {
+		return w, fmt.Errorf(`"%s" is not a known timezone`, w.Timezone)
+	}
+	return w, nil
+}
+
+// Contains reports whether t is within the window.
+func (w Window) Contains(t time.Time) bool {
+	if w.location == nil {
+		var err error
+		if w, err = w.compile(); err != nil {
+			return false
+		}
+	}
+	local := t.In(w.location)
+	minute := local.Hour()*60 + local.Minute()
+	today := local.Weekday()
+	if w.start < w.end {
+		return w.days[today] && minute >= w.start && minute < w.end
+	}
+	yesterday := (today + 6) % 7
+	return w.days[today] && minute >= w.start || w.days[yesterday] && minute < w.end
+}
+
+// String returns the window like "sun 02:00-04:00 Europe/Zurich".
+func (w Window) String() string {
+	days := "daily"
+	if len(w.Days) > 0 {
+		days = strings.Join(w.Days, ",")
+	}
+	timezone := w.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	return fmt.Sprintf("%s %s-%s %s", days, w.Start, w.End, timezone)
+}
+
+// minuteOfDay parses a time of day like 15:04 into the minutes since midnight.
+func minuteOfDay(raw string) (int, error) {
+	t, err := time.Parse("15:04", raw)
+	if err != nil {
+		return 0, fmt.Errorf(`"%s" is not a time of day like 15:04`, raw)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// compileWindows compiles all the windows, see Window.compile.
+func compileWindows(windows []Window) ([]Window, error) {
+	compiled := make([]Window, 0, len(windows))
+	for _, w := range windows {
+		c, err := w.compile()
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// InWindows reports whether t is within any of the windows.
+func InWindows(windows []Window, t time.Time) bool {
+	for _, w := range windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
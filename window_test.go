@@ -0,0 +1,144 @@
+package meow
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// mustCompileWindow compiles the window, or fails the test.
+func mustCompileWindow(t *testing.T, w Window) Window {
+	t.Helper()
+	compiled, err := w.compile()
+	if err != nil {
+		t.Fatalf("compile window %s: %v", w, err)
+	}
+	return compiled
+}
+
+func TestInWindowsAcrossTimezones(t *testing.T) {
+	// Sunday, 02:00 to 04:00 in Zurich, which is two hours ahead of UTC in
+	// summer and one hour in winter
+	zurich := mustCompileWindow(t, Window{Days: []string{"sun"}, Start: "02:00", End: "04:00", Timezone: "Europe/Zurich"})
+	// Friday, 22:00 to Saturday, 02:00 in New York, four hours behind UTC in
+	// summer
+	newYork := mustCompileWindow(t, Window{Days: []string{"fri"}, Start: "22:00", End: "02:00", Timezone: "America/New_York"})
+	windows := []Window{zurich, newYork}
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		inside bool
+	}{
+		{"before Zurich summer window", time.Date(2026, 10, 17, 23, 59, 0, 0, time.UTC), false},
+		{"start of Zurich summer window", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC), true},
+		{"end of Zurich summer window", time.Date(2026, 10, 18, 1, 59, 0, 0, time.UTC), true},
+		{"after Zurich summer window", time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC), false},
+		{"before Zurich winter window", time.Date(2026, 11, 1, 0, 30, 0, 0, time.UTC), false},
+		{"start of Zurich winter window", time.Date(2026, 11, 1, 1, 0, 0, 0, time.UTC), true},
+		{"after Zurich winter window", time.Date(2026, 11, 1, 3, 0, 0, 0, time.UTC), false},
+		{"Thursday night in New York", time.Date(2026, 10, 16, 3, 0, 0, 0, time.UTC), false},
+		{"Friday night in New York", time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC), true},
+		{"Saturday morning in New York", time.Date(2026, 10, 17, 5, 59, 0, 0, time.UTC), true},
+		{"end of New York window", time.Date(2026, 10, 17, 6, 0, 0, 0, time.UTC), false},
+		{"Saturday night in New York", time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if inside := InWindows(windows, test.at); inside != test.inside {
+				t.Errorf("%v is in windows: got %t, want %t", test.at, inside, test.inside)
+			}
+		})
+	}
+
+	if InWindows(nil, time.Date(2026, 10, 18, 1, 0, 0, 0, time.UTC)) {
+		t.Error("got time in no windows at all")
+	}
+}
+
+func TestCompileWindowsRejectsInvalidWindows(t *testing.T) {
+	tests := map[string]Window{
+		"unknown day":      {Days: []string{"sunday"}, Start: "02:00", End: "04:00"},
+		"malformed start":  {Start: "2am", End: "04:00"},
+		"end beyond day":   {Start: "02:00", End: "24:00"},
+		"empty":            {Start: "02:00", End: "02:00"},
+		"unknown timezone": {Start: "02:00", End: "04:00", Timezone: "Europe/Atlantis"},
+	}
+	for name, w := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := compileWindows([]Window{w}); err == nil {
+				t.Errorf("compile window %s: got no error", w)
+			}
+		})
+	}
+}
+
+func TestCheckWindowBoundaries(t *testing.T) {
+	// business hours in Zurich, two hours ahead of UTC in October
+	businessHours := Window{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00", Timezone: "Europe/Zurich"}
+	nightly := Window{Start: "22:00", End: "06:00"}
+	zurich, err := time.LoadLocation("Europe/Zurich")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		w      Window
+		at     time.Time
+		inside bool
+	}{
+		{"before opening", businessHours, time.Date(2026, 10, 16, 8, 59, 59, 0, zurich), false},
+		{"at opening", businessHours, time.Date(2026, 10, 16, 9, 0, 0, 0, zurich), true},
+		{"before closing", businessHours, time.Date(2026, 10, 16, 16, 59, 59, 0, zurich), true},
+		{"at closing", businessHours, time.Date(2026, 10, 16, 17, 0, 0, 0, zurich), false},
+		{"opening in UTC", businessHours, time.Date(2026, 10, 16, 7, 0, 0, 0, time.UTC), true},
+		{"weekend", businessHours, time.Date(2026, 10, 17, 12, 0, 0, 0, zurich), false},
+		{"before night", nightly, time.Date(2026, 10, 16, 21, 59, 0, 0, time.UTC), false},
+		{"at nightfall", nightly, time.Date(2026, 10, 16, 22, 0, 0, 0, time.UTC), true},
+		{"at midnight", nightly, time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), true},
+		{"before dawn", nightly, time.Date(2026, 10, 17, 5, 59, 0, 0, time.UTC), true},
+		{"at dawn", nightly, time.Date(2026, 10, 17, 6, 0, 0, 0, time.UTC), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// windows are compiled lazily if they were not validated before
+			for _, w := range []Window{test.w, mustCompileWindow(t, test.w)} {
+				if inside := w.Contains(test.at); inside != test.inside {
+					t.Errorf("%v is in window %s: got %t, want %t", test.at, w, inside, test.inside)
+				}
+			}
+		})
+	}
+
+	invalid := Window{Start: "09:00", End: "17:00", Timezone: "Europe/Atlantis"}
+	if invalid.Contains(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("got time within invalid window %s", invalid)
+	}
+}
+
+func TestEndpointFromPayloadValidatesCheckWindow(t *testing.T) {
+	payload := EndpointPayload{
+		Identifier:   "libvirt",
+		URL:          "https://libvirt.org/",
+		Method:       "GET",
+		StatusOnline: 200,
+		Frequency:    "1m",
+		FailAfter:    3,
+		CheckWindow:  &Window{Start: "09:00", End: "17:00", Timezone: "Europe/Atlantis"},
+	}
+	_, err := EndpointFromPayload(payload)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "check_window" {
+		t.Errorf("got error %v, want one about the check window", err)
+	}
+
+	payload.CheckWindow.Timezone = "Europe/Zurich"
+	endpoint, err := EndpointFromPayload(payload)
+	if err != nil {
+		t.Fatalf("got error %v, want none", err)
+	}
+	if !endpoint.CheckWindow.Contains(time.Date(2026, 10, 16, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("check window %s of endpoint does not contain its start", endpoint.CheckWindow)
+	}
+}